@@ -0,0 +1,120 @@
+package gcloudtracer
+
+import (
+	"strconv"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// Labels of the spans aggregating sibling spans, see WithSiblingAggregation.
+const (
+	// AggregateCountLabel holds the number of aggregated spans.
+	AggregateCountLabel = "aggregate.count"
+	// AggregateMinLabel holds the shortest duration of aggregated spans.
+	AggregateMinLabel = "aggregate.min_duration"
+	// AggregateMaxLabel holds the longest duration of aggregated spans.
+	AggregateMaxLabel = "aggregate.max_duration"
+	// AggregateTotalLabel holds the sum of durations of aggregated spans.
+	AggregateTotalLabel = "aggregate.total_duration"
+)
+
+type siblingKey struct {
+	parent uint64
+	name   string
+}
+
+// aggregateSiblings replaces at least threshold spans of the same operation
+// and parent with a span aggregating them. Only provable leaves are aggregated:
+// spans without children in the bundle or uploaded before, whose parent is
+// in the bundle, so their children finished already. The aggregate has the
+// identifier of the first span, spans from its earliest start to its latest
+// end and keeps the labels the spans agree on.
+func aggregateSiblings(traces []*cloudtrace.Trace, threshold int, uploaded *uploadedSpans) {
+	for _, t := range traces {
+		if len(t.Spans) < threshold {
+			continue
+		}
+		ids := make(map[uint64]struct{}, len(t.Spans))
+		parents := make(map[uint64]struct{}, len(t.Spans))
+		for _, s := range t.Spans {
+			ids[s.SpanId] = struct{}{}
+			parents[s.ParentSpanId] = struct{}{}
+		}
+		leaf := func(s *cloudtrace.TraceSpan) bool {
+			if _, ok := parents[s.SpanId]; ok {
+				return false
+			}
+			if _, ok := ids[s.ParentSpanId]; !ok {
+				return false
+			}
+			return !uploaded.hasChildren(t.TraceId, s.SpanId)
+		}
+		siblings := make(map[siblingKey][]*cloudtrace.TraceSpan)
+		for _, s := range t.Spans {
+			if !leaf(s) {
+				continue
+			}
+			k := siblingKey{parent: s.ParentSpanId, name: s.Name}
+			siblings[k] = append(siblings[k], s)
+		}
+
+		spans := t.Spans[:0:0]
+		for _, s := range t.Spans {
+			group := siblings[siblingKey{parent: s.ParentSpanId, name: s.Name}]
+			switch {
+			case len(group) < threshold || !leaf(s):
+				spans = append(spans, s)
+			case group[0] == s:
+				spans = append(spans, aggregateSpans(group))
+			}
+		}
+		t.Spans = spans
+	}
+}
+
+// aggregateSpans returns a span aggregating the spans.
+func aggregateSpans(spans []*cloudtrace.TraceSpan) *cloudtrace.TraceSpan {
+	first := spans[0]
+	agg := &cloudtrace.TraceSpan{
+		SpanId:       first.SpanId,
+		Kind:         first.Kind,
+		Name:         first.Name,
+		ParentSpanId: first.ParentSpanId,
+		StartTime:    first.StartTime,
+		EndTime:      first.EndTime,
+		Labels:       make(map[string]string, len(first.Labels)+4),
+	}
+	for k, v := range first.Labels {
+		agg.Labels[k] = v
+	}
+
+	var min, max, total time.Duration
+	for i, s := range spans {
+		start, end := parseTimestamp(s.StartTime), parseTimestamp(s.EndTime)
+		d := end.Sub(start)
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		total += d
+		if start.Before(parseTimestamp(agg.StartTime)) {
+			agg.StartTime = s.StartTime
+		}
+		if end.After(parseTimestamp(agg.EndTime)) {
+			agg.EndTime = s.EndTime
+		}
+		for k, v := range agg.Labels {
+			if s.Labels[k] != v {
+				delete(agg.Labels, k)
+			}
+		}
+	}
+	agg.Labels[AggregateCountLabel] = strconv.Itoa(len(spans))
+	agg.Labels[AggregateMinLabel] = min.String()
+	agg.Labels[AggregateMaxLabel] = max.String()
+	agg.Labels[AggregateTotalLabel] = total.String()
+	return agg
+}
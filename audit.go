@@ -0,0 +1,54 @@
+package gcloudtracer
+
+import (
+	"context"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// ExportedSpan identifies a span uploaded to Cloud Trace or written by
+// an Exporter.
+type ExportedSpan struct {
+	TraceID string
+	SpanID  uint64
+}
+
+// AuditFunc is called with the spans exported to the project, see WithAuditHook.
+type AuditFunc func(project string, spans []ExportedSpan)
+
+// audited returns the write function calling the hook with the spans
+// of every successful write.
+func (r *Recorder) audited(project string, write writeFunc) writeFunc {
+	return func(traces []*cloudtrace.Trace) error {
+		if err := write(traces); err != nil {
+			return err
+		}
+		r.exported(project, traces)
+		return nil
+	}
+}
+
+// export writes the traces of the project with the exporter, calling
+// the hook with their spans if successful.
+func (r *Recorder) export(e Exporter, project string, traces []*cloudtrace.Trace) error {
+	if err := e.Export(context.Background(), traces); err != nil {
+		return err
+	}
+	r.exported(project, traces)
+	return nil
+}
+
+// exported calls the hook, if any, with the spans of the traces exported
+// to the project. All exports of the Recorder end up here.
+func (r *Recorder) exported(project string, traces []*cloudtrace.Trace) {
+	if r.audit == nil {
+		return
+	}
+	var spans []ExportedSpan
+	for _, t := range traces {
+		for _, s := range t.Spans {
+			spans = append(spans, ExportedSpan{TraceID: t.TraceId, SpanID: s.SpanId})
+		}
+	}
+	r.audit(project, spans)
+}
@@ -0,0 +1,65 @@
+package gcloudtracer
+
+import (
+	"sort"
+	"strings"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// BaggageLabelPrefix prefixes the labels of baggage items, see WithBaggageLabels.
+const BaggageLabelPrefix = "baggage."
+
+// baggageExport selects the baggage items of spans uploaded as labels.
+type baggageExport struct {
+	prefixes []string
+	maxSize  int
+}
+
+// allowed reports whether the key has one of the prefixes.
+func (b *baggageExport) allowed(key string) bool {
+	for _, p := range b.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// label sets the allowed items of the baggage as labels of the spans of
+// the trace, in order of their keys until the size of keys and values
+// reaches the maximum size.
+func (b *baggageExport) label(trace *cloudtrace.Trace, baggage map[string]string) {
+	if len(baggage) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(baggage))
+	for k := range baggage {
+		if b.allowed(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	labels := make(map[string]string, len(keys))
+	var size int
+	for _, k := range keys {
+		v := baggage[k]
+		if b.maxSize > 0 && size+len(k)+len(v) > b.maxSize {
+			continue
+		}
+		size += len(k) + len(v)
+		labels[BaggageLabelPrefix+k] = v
+	}
+	if len(labels) == 0 {
+		return
+	}
+	for _, s := range trace.Spans {
+		if s.Labels == nil {
+			s.Labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			s.Labels[k] = v
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package gcloudtracer
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// maxBundleBytes bounds the approximate size of an uploaded bundle,
+// a trace larger than that is uploaded in a bundle of its own.
+const maxBundleBytes = 1 << 20
+
+// errOverflow occurs if a trace doesn't fit into the buffer of the batcher.
+var errOverflow = errors.New("batcher buffer full")
+
+// batcher groups traces into bundles handed to the handler once the bundle
+// holds enough traces or bytes, or after the delay since its first trace.
+// Traces handed to the handler or waiting for it are buffered until
+// the handler returns, at most the handler limit of bundles are handled
+// at the same time, in the order the bundles are complete.
+type batcher struct {
+	handler func([]*bundledTrace)
+	delay   time.Duration
+	// jitter bounds the random duration added to the delay of every bundle,
+	// drawn from rnd.
+	jitter         time.Duration
+	rnd            *rand.Rand
+	countThreshold int
+	byteThreshold  int64
+	// bufferedLimit bounds the number of buffered traces and spans.
+	bufferedLimit int
+	// evict is called with traces evicted to make room for newer ones
+	// if set, otherwise traces above the buffered limit are rejected.
+	evict func(*bundledTrace)
+
+	handlers chan struct{}
+
+	mu       sync.Mutex
+	bundle   []*bundledTrace
+	bytes    int64
+	buffered int
+	timer    *time.Timer
+	// generation identifies the timer of the bundle, a timer that fired
+	// after its bundle was dispatched doesn't dispatch the next one.
+	generation uint64
+	// space is closed and replaced once buffered traces are handled.
+	space chan struct{}
+	// inflight holds channels closed once the dispatched bundles are handled.
+	inflight map[chan struct{}]struct{}
+	// started is closed once the last dispatched bundle is handed to
+	// the handler, so bundles are handled in the order they're dispatched.
+	started chan struct{}
+}
+
+func newBatcher(handler func([]*bundledTrace)) *batcher {
+	return &batcher{
+		handler:        handler,
+		delay:          time.Second,
+		countThreshold: 10,
+		byteThreshold:  maxBundleBytes,
+		bufferedLimit:  1e9,
+		handlers:       make(chan struct{}, 1),
+		space:          make(chan struct{}),
+		inflight:       make(map[chan struct{}]struct{}),
+	}
+}
+
+// units returns the number of traces and spans of the trace counted
+// against the buffered limit.
+func units(bt *bundledTrace) int {
+	return 1 + len(bt.trace.Spans)
+}
+
+// add buffers the trace, it returns errOverflow if the trace doesn't fit
+// into the buffer.
+func (b *batcher) add(bt *bundledTrace) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.fits(bt) {
+		return errOverflow
+	}
+	b.append(bt)
+	return nil
+}
+
+// addWait buffers the trace, waiting for room in the buffer
+// until the context is done.
+func (b *batcher) addWait(ctx context.Context, bt *bundledTrace) error {
+	b.mu.Lock()
+	for !b.fits(bt) {
+		space := b.space
+		b.mu.Unlock()
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		b.mu.Lock()
+	}
+	defer b.mu.Unlock()
+	b.append(bt)
+	return nil
+}
+
+// fits reports whether the trace fits into the buffer, evicting older
+// traces if enabled. The caller holds the lock.
+func (b *batcher) fits(bt *bundledTrace) bool {
+	for b.buffered+units(bt) > b.bufferedLimit {
+		if b.evict == nil || !b.evictOldestLocked() {
+			// A trace larger than the limit is let through into an empty buffer,
+			// so it doesn't wait forever.
+			return b.buffered == 0
+		}
+	}
+	return true
+}
+
+// evictOldest evicts the oldest trace not handed to the handler yet,
+// it returns false if there is none.
+func (b *batcher) evictOldest() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.evictOldestLocked()
+}
+
+func (b *batcher) evictOldestLocked() bool {
+	if len(b.bundle) == 0 {
+		return false
+	}
+	bt := b.bundle[0]
+	b.bundle[0] = nil
+	b.bundle = b.bundle[1:]
+	b.bytes -= bt.size
+	b.buffered -= units(bt)
+	b.evict(bt)
+	return true
+}
+
+// append adds the trace to the bundle, dispatching it if it's full.
+// The caller holds the lock.
+func (b *batcher) append(bt *bundledTrace) {
+	if len(b.bundle) > 0 && b.bytes+bt.size > b.byteThreshold {
+		b.dispatch()
+	}
+	b.bundle = append(b.bundle, bt)
+	b.bytes += bt.size
+	b.buffered += units(bt)
+	if len(b.bundle) >= b.countThreshold || b.bytes >= b.byteThreshold {
+		b.dispatch()
+		return
+	}
+	if len(b.bundle) == 1 {
+		b.stopTimer()
+		generation := b.generation
+		b.timer = time.AfterFunc(b.nextDelay(), func() { b.expire(generation) })
+	}
+}
+
+// stopTimer stops the timer of the bundle, if its callback already runs
+// it doesn't dispatch. The caller holds the lock.
+func (b *batcher) stopTimer() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.generation++
+}
+
+// nextDelay returns the delay of the next bundle, with a new jitter.
+// The caller holds the lock.
+func (b *batcher) nextDelay() time.Duration {
+	if b.jitter <= 0 {
+		return b.delay
+	}
+	return b.delay + time.Duration(b.rnd.Int63n(int64(b.jitter)))
+}
+
+// expire dispatches the bundle once its delay passed, unless the timer
+// of the generation was stopped.
+func (b *batcher) expire(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	b.dispatch()
+}
+
+// dispatch hands the bundle to the handler in background.
+// The caller holds the lock.
+func (b *batcher) dispatch() {
+	b.stopTimer()
+	if len(b.bundle) == 0 {
+		return
+	}
+
+	bundle := b.bundle
+	b.bundle, b.bytes = nil, 0
+	done := make(chan struct{})
+	b.inflight[done] = struct{}{}
+	previous, started := b.started, make(chan struct{})
+	b.started = started
+	go func() {
+		if previous != nil {
+			<-previous
+		}
+		b.handlers <- struct{}{}
+		close(started)
+		b.handler(bundle)
+		<-b.handlers
+
+		n := 0
+		for _, bt := range bundle {
+			n += units(bt)
+		}
+		b.mu.Lock()
+		b.buffered -= n
+		close(b.space)
+		b.space = make(chan struct{})
+		delete(b.inflight, done)
+		b.mu.Unlock()
+		close(done)
+	}()
+}
+
+// flush dispatches the bundle and waits for the bundles dispatched so far.
+func (b *batcher) flush() {
+	b.mu.Lock()
+	b.dispatch()
+	inflight := make([]chan struct{}, 0, len(b.inflight))
+	for done := range b.inflight {
+		inflight = append(inflight, done)
+	}
+	b.mu.Unlock()
+
+	for _, done := range inflight {
+		<-done
+	}
+}
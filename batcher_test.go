@@ -0,0 +1,165 @@
+package gcloudtracer
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+func testBundledTrace(id uint64) *bundledTrace {
+	return &bundledTrace{
+		traceID: id,
+		trace:   &cloudtrace.Trace{Spans: []*cloudtrace.TraceSpan{{SpanId: id}}},
+		size:    100,
+	}
+}
+
+// bundleRecorder records bundles handed to a batcher.
+type bundleRecorder struct {
+	mu      sync.Mutex
+	bundles [][]uint64
+}
+
+func (r *bundleRecorder) handle(bundle []*bundledTrace) {
+	ids := make([]uint64, 0, len(bundle))
+	for _, bt := range bundle {
+		ids = append(ids, bt.traceID)
+	}
+	r.mu.Lock()
+	r.bundles = append(r.bundles, ids)
+	r.mu.Unlock()
+}
+
+func (r *bundleRecorder) get() [][]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bundles
+}
+
+func TestBatcher(t *testing.T) {
+	t.Run("threshold=count", func(t *testing.T) {
+		var r bundleRecorder
+		b := newBatcher(r.handle)
+		b.delay = time.Hour
+		b.countThreshold = 2
+		for i := uint64(1); i <= 3; i++ {
+			assert.NoError(t, b.add(testBundledTrace(i)))
+		}
+		b.flush()
+		assert.Equal(t, [][]uint64{{1, 2}, {3}}, r.get())
+	})
+
+	t.Run("threshold=bytes", func(t *testing.T) {
+		var r bundleRecorder
+		b := newBatcher(r.handle)
+		b.delay = time.Hour
+		b.byteThreshold = 150
+		for i := uint64(1); i <= 3; i++ {
+			assert.NoError(t, b.add(testBundledTrace(i)))
+		}
+		b.flush()
+		assert.Equal(t, [][]uint64{{1}, {2}, {3}}, r.get())
+	})
+
+	t.Run("threshold=delay", func(t *testing.T) {
+		var r bundleRecorder
+		b := newBatcher(r.handle)
+		b.delay = 10 * time.Millisecond
+		assert.NoError(t, b.add(testBundledTrace(1)))
+		assert.Eventually(t, func() bool { return len(r.get()) == 1 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("delay=stale_timer", func(t *testing.T) {
+		var r bundleRecorder
+		b := newBatcher(r.handle)
+		b.delay = time.Hour
+		assert.NoError(t, b.add(testBundledTrace(1)))
+		b.mu.Lock()
+		stale := b.generation
+		b.mu.Unlock()
+		b.flush()
+
+		// The timer of the first bundle fires once the second one started.
+		assert.NoError(t, b.add(testBundledTrace(2)))
+		b.expire(stale)
+		assert.Equal(t, [][]uint64{{1}}, r.get())
+		b.flush()
+		assert.Equal(t, [][]uint64{{1}, {2}}, r.get())
+	})
+
+	t.Run("delay=jitter", func(t *testing.T) {
+		b := newBatcher(func([]*bundledTrace) {})
+		b.delay = time.Second
+		b.jitter = time.Second
+		b.rnd = rand.New(rand.NewSource(1))
+		delays := make(map[time.Duration]struct{})
+		for i := 0; i < 10; i++ {
+			d := b.nextDelay()
+			assert.True(t, d >= time.Second && d < 2*time.Second)
+			delays[d] = struct{}{}
+		}
+		assert.Len(t, delays, 10)
+	})
+
+	t.Run("buffered=overflow", func(t *testing.T) {
+		var r bundleRecorder
+		b := newBatcher(r.handle)
+		b.delay = time.Hour
+		b.bufferedLimit = 4
+		assert.NoError(t, b.add(testBundledTrace(1)))
+		assert.NoError(t, b.add(testBundledTrace(2)))
+		assert.Equal(t, errOverflow, b.add(testBundledTrace(3)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, b.addWait(ctx, testBundledTrace(3)))
+
+		b.flush()
+		assert.NoError(t, b.addWait(context.Background(), testBundledTrace(3)))
+	})
+
+	t.Run("buffered=evict_oldest", func(t *testing.T) {
+		var r bundleRecorder
+		var evicted []uint64
+		b := newBatcher(r.handle)
+		b.delay = time.Hour
+		b.bufferedLimit = 4
+		b.evict = func(bt *bundledTrace) { evicted = append(evicted, bt.traceID) }
+		for i := uint64(1); i <= 3; i++ {
+			assert.NoError(t, b.add(testBundledTrace(i)))
+		}
+		b.flush()
+		assert.Equal(t, []uint64{1}, evicted)
+		assert.Equal(t, [][]uint64{{2, 3}}, r.get())
+	})
+
+	t.Run("handlers=limit", func(t *testing.T) {
+		var mu sync.Mutex
+		var running, peak int
+		b := newBatcher(func([]*bundledTrace) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+		b.countThreshold = 1
+		b.handlers = make(chan struct{}, 2)
+		for i := uint64(1); i <= 6; i++ {
+			assert.NoError(t, b.add(testBundledTrace(i)))
+		}
+		b.flush()
+		assert.Equal(t, 2, peak)
+		assert.Equal(t, 0, running)
+	})
+}
@@ -0,0 +1,172 @@
+package gcloudtracer
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/stretchr/testify/assert"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+func benchmarkSpan() RawSpan {
+	sp := testSpan(1, 2)
+	sp.ParentSpanID = 1
+	sp.Tags = opentracing.Tags{
+		string(ext.SpanKind):       ext.SpanKindRPCServerEnum,
+		string(ext.HTTPMethod):     "GET",
+		string(ext.HTTPUrl):        "/orders/42",
+		string(ext.HTTPStatusCode): 200,
+		"component":                "net/http",
+	}
+	sp.Logs = []opentracing.LogRecord{
+		{Timestamp: sp.Start, Fields: []log.Field{log.String("event", "read"), log.Int("bytes", 512)}},
+		{Timestamp: sp.Start.Add(time.Microsecond), Fields: []log.Field{log.String("event", "write")}},
+	}
+	return sp
+}
+
+func BenchmarkRecordSpan(b *testing.B) {
+	rec, srv := newTestRecorder(b, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithDefaultLabels(map[string]string{"env": "bench"}), WithBlockOnOverflow(time.Second))
+	defer srv.Close()
+	defer rec.Close()
+
+	sp := benchmarkSpan()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp.Context.SpanID = uint64(i + 2)
+		rec.RecordSpan(sp)
+	}
+}
+
+func BenchmarkConvertSpan(b *testing.B) {
+	rec, srv := newTestRecorder(b, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithDefaultLabels(map[string]string{"env": "bench"}))
+	defer srv.Close()
+	defer rec.Close()
+
+	sp := benchmarkSpan()
+	set := rec.currentSettings()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec.convert(&sp, set, nil)
+	}
+}
+
+func BenchmarkConvertTags(b *testing.B) {
+	sp := benchmarkSpan()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		transposeLabels(convertTags(sp.Tags, 0), labelMerge{})
+	}
+}
+
+func BenchmarkAddLogs(b *testing.B) {
+	sp := benchmarkSpan()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		addLogs(make(map[string]string, len(sp.Logs)), sp.Logs, sp.Start)
+	}
+}
+
+func BenchmarkFormatTimestamp(b *testing.B) {
+	now := time.Now()
+	b.Run("func=formatTimestamp", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			formatTimestamp(now)
+		}
+	})
+	b.Run("func=Format", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			now.Format(time.RFC3339Nano)
+		}
+	})
+}
+
+// internSink keeps the labels of BenchmarkIntern escaping to the heap,
+// as they do once stored in the labels of a span.
+var internSink string
+
+func BenchmarkIntern(b *testing.B) {
+	b.Run("func=itoa", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			internSink = itoa(200 + i%400)
+		}
+	})
+	b.Run("func=Itoa", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			internSink = strconv.Itoa(200 + i%400)
+		}
+	})
+	b.Run("func=eventKey", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			internSink = eventKey(i % 10)
+		}
+	})
+	b.Run("func=concat", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			internSink = "event_" + strconv.Itoa(i%10)
+		}
+	})
+}
+
+func BenchmarkCoalesce(b *testing.B) {
+	traces := make([]*cloudtrace.Trace, 100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := range traces {
+			traces[j] = &cloudtrace.Trace{
+				TraceId: eventKey(j % 10),
+				Spans:   []*cloudtrace.TraceSpan{{SpanId: uint64(j)}},
+			}
+		}
+		coalesce(traces)
+	}
+}
+
+// TestConvertAllocs guards allocations of the span conversion, raise
+// the budget only for a good reason.
+func TestConvertAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not deterministic with the race detector")
+	}
+
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithDefaultLabels(map[string]string{"env": "bench"}))
+	defer srv.Close()
+	defer rec.Close()
+
+	sp := benchmarkSpan()
+	set := rec.currentSettings()
+	for _, tc := range []struct {
+		name   string
+		budget float64
+		f      func()
+	}{
+		{"convert", 15, func() { rec.convert(&sp, set, nil) }},
+		{"tags", 3, func() { transposeLabels(convertTags(sp.Tags, 0), labelMerge{}) }},
+		{"logs", 6, func() { addLogs(make(map[string]string, len(sp.Logs)), sp.Logs, sp.Start) }},
+		{"timestamp", 1, func() { formatTimestamp(sp.Start) }},
+	} {
+		t.Run("func="+tc.name, func(t *testing.T) {
+			allocs := testing.AllocsPerRun(100, tc.f)
+			assert.True(t, allocs <= tc.budget, "%v allocs/op over budget of %v", allocs, tc.budget)
+		})
+	}
+}
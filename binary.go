@@ -0,0 +1,162 @@
+package gcloudtracer
+
+import (
+	"encoding/binary"
+	"io"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// Fields of the TracerState protobuf message of basictracer, carried by
+// opentracing.Binary. The high bits of 128-bit trace identifiers are an
+// extra field, skipped by basictracer peers.
+const (
+	binaryTraceID     = 1
+	binarySpanID      = 2
+	binarySampled     = 3
+	binaryBaggage     = 4
+	binaryTraceIDHigh = 5
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// maxBinarySize bounds the size of a span context read from a carrier.
+const maxBinarySize = 1 << 20
+
+// injectBinary writes the span context as the TracerState message
+// prefixed with its size, a big-endian int32.
+func injectBinary(sc SpanContext, w io.Writer) error {
+	b := make([]byte, 4, 64)
+	b = appendFixed64(b, binaryTraceID, sc.TraceID)
+	b = appendFixed64(b, binarySpanID, sc.SpanID)
+	if sc.Sampled {
+		b = append(b, binarySampled<<3|wireVarint, 1)
+	}
+	for k, v := range sc.Baggage {
+		var item []byte
+		item = appendBytes(item, 1, k)
+		item = appendBytes(item, 2, v)
+		b = appendBytes(b, binaryBaggage, string(item))
+	}
+	if sc.TraceIDHigh != 0 {
+		b = appendFixed64(b, binaryTraceIDHigh, sc.TraceIDHigh)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	_, err := w.Write(b)
+	return err
+}
+
+// extractBinary reads the span context written by injectBinary.
+func extractBinary(r io.Reader) (opentracing.SpanContext, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		if err == io.EOF {
+			return nil, opentracing.ErrSpanContextNotFound
+		}
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxBinarySize {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+
+	var sc SpanContext
+	err := readFields(b, func(field, wire int, v uint64, data []byte) error {
+		switch {
+		case field == binaryTraceID && wire == wireFixed64:
+			sc.TraceID = v
+		case field == binarySpanID && wire == wireFixed64:
+			sc.SpanID = v
+		case field == binarySampled && wire == wireVarint:
+			sc.Sampled = v != 0
+		case field == binaryTraceIDHigh && wire == wireFixed64:
+			sc.TraceIDHigh = v
+		case field == binaryBaggage && wire == wireBytes:
+			var key, value string
+			err := readFields(data, func(field, wire int, _ uint64, data []byte) error {
+				switch {
+				case field == 1 && wire == wireBytes:
+					key = string(data)
+				case field == 2 && wire == wireBytes:
+					value = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if sc.Baggage == nil {
+				sc.Baggage = make(map[string]string)
+			}
+			sc.Baggage[key] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func appendFixed64(b []byte, field int, v uint64) []byte {
+	b = append(b, byte(field<<3|wireFixed64))
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func appendBytes(b []byte, field int, v string) []byte {
+	b = append(b, byte(field<<3|wireBytes))
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// readFields calls the function with the fields of the protobuf message,
+// the value of varint and fixed fields, or the data of bytes fields.
+func readFields(b []byte, f func(field, wire int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return opentracing.ErrSpanContextCorrupted
+		}
+		b = b[n:]
+		field, wire := int(key>>3), int(key&7)
+
+		var v uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return opentracing.ErrSpanContextCorrupted
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return opentracing.ErrSpanContextCorrupted
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return opentracing.ErrSpanContextCorrupted
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return opentracing.ErrSpanContextCorrupted
+			}
+			data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return opentracing.ErrSpanContextCorrupted
+		}
+		if err := f(field, wire, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
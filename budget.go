@@ -0,0 +1,60 @@
+package gcloudtracer
+
+import (
+	"sync"
+	"time"
+)
+
+// budgeter tracks spans accepted per day against the budget, lowering
+// the fraction of accepted traces linearly as the budget is consumed.
+type budgeter struct {
+	mu     sync.Mutex
+	budget uint64
+	day    time.Time
+	used   uint64
+}
+
+func newBudgeter(budget uint64) *budgeter {
+	return &budgeter{budget: budget}
+}
+
+// take reports whether a span of the trace fits the budget and counts it if so.
+// The decision is made by trace identifier, so traces are throttled as a whole.
+// The identifier is mixed first, so the traces the budget keeps don't depend
+// on those the sampling rate keeps by comparing identifiers with its bound.
+func (b *budgeter) take(traceID uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if day := time.Now().UTC().Truncate(24 * time.Hour); !day.Equal(b.day) {
+		b.day = day
+		b.used = 0
+	}
+	if b.used >= b.budget {
+		return false
+	}
+
+	left := 1 - float64(b.used)/float64(b.budget)
+	if !inSample(mix(traceID), sampleBound(left)) {
+		return false
+	}
+	b.used++
+	return true
+}
+
+// usage returns the number of spans accepted today.
+func (b *budgeter) usage() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// mix returns the bits of the identifier mixed by the finalizer of SplitMix64.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
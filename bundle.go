@@ -0,0 +1,387 @@
+package gcloudtracer
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
+)
+
+// bundledTrace is a trace buffered for upload to the project by the recorder.
+type bundledTrace struct {
+	rec     *Recorder
+	project string
+	traceID uint64
+	trace   *cloudtrace.Trace
+	spanV2  *cloudtracev2.Span
+	size    int64
+
+	// flushed is set on a marker queued by flush instead of a trace,
+	// it's closed once the traces queued before are bundled.
+	flushed chan struct{}
+}
+
+// ingestQueueSize is a capacity of each ingest queue shard.
+const ingestQueueSize = 1024
+
+// maxOverflowUploads bounds the number of traces uploaded in background
+// because they didn't fit into the bundler.
+const maxOverflowUploads = 8
+
+type uploadKey struct {
+	rec     *Recorder
+	project string
+}
+
+// traceBundler buffers traces of one or many recorders and uploads them
+// in bundles. Traces are sharded by trace identifier, so spans of a trace
+// are bundled together. Each shard queues traces on a channel drained
+// into its own bundler by a goroutine, so recording spans concurrently
+// doesn't contend on a bundler lock.
+type traceBundler struct {
+	pendingBytes int64 // accessed atomically, kept first for alignment
+
+	shards         []*bundlerShard
+	overflowWait   time.Duration
+	memoryLimit    int64
+	evictionPolicy EvictionPolicy
+
+	// overflow limits the background uploads of traces which didn't fit
+	// into the bundler, inflight counts them for flush. A WaitGroup isn't
+	// used, as uploads may start while flush waits.
+	overflow     chan struct{}
+	inflightMu   sync.Mutex
+	inflightDone *sync.Cond
+	inflight     int
+
+	// closed is set under closeMu once the bundler is closed, traces are
+	// queued under its read lock, so none is queued after the flush of close.
+	closeMu sync.RWMutex
+	closed  bool
+	// done stops the feeders once the bundler is closed.
+	done      chan struct{}
+	closeOnce sync.Once
+	feeders   sync.WaitGroup
+}
+
+// bundlerShard bundles traces with its own flush timer.
+type bundlerShard struct {
+	queue   chan *bundledTrace
+	batcher *batcher
+}
+
+func newTraceBundler(o *Options) *traceBundler {
+	tb := &traceBundler{
+		overflowWait:   o.overflowWait,
+		memoryLimit:    o.memoryLimit,
+		evictionPolicy: o.evictionPolicy,
+		overflow:       make(chan struct{}, maxOverflowUploads),
+		done:           make(chan struct{}),
+	}
+	tb.inflightDone = sync.NewCond(&tb.inflightMu)
+
+	n := o.bundlerShards
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	// Seeded explicitly, so replicas started together don't get the same jitter.
+	seed := time.Now().UnixNano()
+	// The upload concurrency is shared by the shards, so it's a limit
+	// for the bundler whatever the number of shards.
+	var handlers chan struct{}
+	if o.uploadConcurrency > 0 {
+		handlers = make(chan struct{}, o.uploadConcurrency)
+	}
+	tb.shards = make([]*bundlerShard, n)
+	for i := range tb.shards {
+		b := newBatcher(tb.handle)
+		b.delay = o.bundleDelay
+		if o.bundleJitter > 0 {
+			b.jitter = o.bundleJitter
+			b.rnd = rand.New(rand.NewSource(seed + int64(i)))
+		}
+		b.countThreshold = o.bundleCount
+		// The buffered limit is split between the shards.
+		b.bufferedLimit = divide(o.bufferedLimit, n)
+		if handlers != nil {
+			b.handlers = handlers
+		}
+		if o.evictionPolicy == EvictOldest {
+			b.evict = tb.evict
+		}
+
+		sh := &bundlerShard{
+			queue:   make(chan *bundledTrace, ingestQueueSize),
+			batcher: b,
+		}
+		tb.shards[i] = sh
+		tb.feeders.Add(1)
+		go tb.feed(sh)
+	}
+
+	return tb
+}
+
+// divide splits the limit into n parts of at least one.
+func divide(limit, n int) int {
+	if limit/n < 1 {
+		return 1
+	}
+	return limit / n
+}
+
+// add queues the trace, it returns ErrBufferFull if the trace was dropped,
+// or ErrRecorderClosed if the bundler is closed. It never uploads on
+// the caller's goroutine and blocks at most for the overflow wait.
+func (tb *traceBundler) add(bt *bundledTrace) error {
+	tb.closeMu.RLock()
+	defer tb.closeMu.RUnlock()
+	if tb.closed {
+		return ErrRecorderClosed
+	}
+
+	bt.size = int64(traceSize(bt.trace))
+	shard := int(bt.traceID % uint64(len(tb.shards)))
+	if !tb.reserve(shard, bt.size) {
+		if tb.evictionPolicy == EvictUpload {
+			return tb.uploadAsync(bt)
+		}
+		return ErrBufferFull
+	}
+
+	q := tb.shards[shard].queue
+	select {
+	case q <- bt:
+		return nil
+	default:
+	}
+
+	if tb.overflowWait > 0 {
+		t := time.NewTimer(tb.overflowWait)
+		defer t.Stop()
+		select {
+		case q <- bt:
+			return nil
+		case <-t.C:
+		case <-tb.done:
+		}
+		atomic.AddInt64(&tb.pendingBytes, -bt.size)
+		return ErrBufferFull
+	}
+
+	atomic.AddInt64(&tb.pendingBytes, -bt.size)
+	bt.rec.log.Errorf("trace upload queue too full. uploading immediately")
+	return tb.uploadAsync(bt)
+}
+
+// reserve accounts the bytes of a trace against the memory limit, evicting
+// the oldest buffered traces starting with the shard if the policy is
+// EvictOldest. It reports whether the trace fits into the limit.
+func (tb *traceBundler) reserve(shard int, size int64) bool {
+	for i := 0; tb.memoryLimit > 0 && atomic.LoadInt64(&tb.pendingBytes)+size > tb.memoryLimit; {
+		if tb.evictionPolicy != EvictOldest || i == len(tb.shards) {
+			return false
+		}
+		if !tb.shards[(shard+i)%len(tb.shards)].batcher.evictOldest() {
+			i++
+		}
+	}
+	atomic.AddInt64(&tb.pendingBytes, size)
+	return true
+}
+
+// evict drops the trace evicted to make room for newer ones.
+func (tb *traceBundler) evict(bt *bundledTrace) {
+	atomic.AddInt64(&tb.pendingBytes, -bt.size)
+	bt.rec.countEvicted(len(bt.trace.Spans))
+	bt.rec.debugf("trace %s evicted from full buffer", bt.trace.TraceId)
+}
+
+// feed adds the traces from the queue of the shard to its bundler,
+// until the bundler is closed.
+func (tb *traceBundler) feed(sh *bundlerShard) {
+	defer tb.feeders.Done()
+	for {
+		var bt *bundledTrace
+		select {
+		case bt = <-sh.queue:
+		case <-tb.done:
+			return
+		}
+
+		if bt.flushed != nil {
+			close(bt.flushed)
+			continue
+		}
+
+		var err error
+		if tb.overflowWait > 0 {
+			err = sh.batcher.addWait(context.Background(), bt)
+		} else {
+			err = sh.batcher.add(bt)
+		}
+		if err != nil {
+			atomic.AddInt64(&tb.pendingBytes, -bt.size)
+		}
+		if err == errOverflow {
+			bt.rec.log.Errorf("trace upload bundle too full. uploading immediately")
+			err = tb.uploadAsync(bt)
+		}
+
+		if err != nil {
+			bt.rec.countDropped(bt.trace, err)
+		}
+		if err == ErrBufferFull {
+			bt.rec.log.Errorf("trace upload buffer full. dropping trace %s", bt.trace.TraceId)
+		} else if err != nil {
+			bt.rec.log.Errorf("error buffering trace %s: %s", bt.trace.TraceId, err)
+		}
+	}
+}
+
+// uploadAsync uploads the trace in background, it returns ErrBufferFull
+// if too many traces are being uploaded this way already.
+func (tb *traceBundler) uploadAsync(bt *bundledTrace) error {
+	select {
+	case tb.overflow <- struct{}{}:
+	default:
+		return ErrBufferFull
+	}
+
+	tb.inflightMu.Lock()
+	tb.inflight++
+	tb.inflightMu.Unlock()
+	go func() {
+		defer func() {
+			<-tb.overflow
+			tb.inflightMu.Lock()
+			if tb.inflight--; tb.inflight == 0 {
+				tb.inflightDone.Broadcast()
+			}
+			tb.inflightMu.Unlock()
+		}()
+		uploadKey{rec: bt.rec, project: bt.project}.uploadTraces([]*cloudtrace.Trace{bt.trace}, newSpansV2(bt.trace, bt.spanV2))
+	}()
+	return nil
+}
+
+// flush uploads the queued and buffered traces and waits for
+// the background uploads.
+func (tb *traceBundler) flush() {
+	var wg sync.WaitGroup
+	for _, sh := range tb.shards {
+		wg.Add(1)
+		go func(sh *bundlerShard) {
+			defer wg.Done()
+			marker := &bundledTrace{flushed: make(chan struct{})}
+			select {
+			case sh.queue <- marker:
+			case <-tb.done:
+				return
+			}
+			select {
+			case <-marker.flushed:
+			case <-tb.done:
+				return
+			}
+			sh.batcher.flush()
+		}(sh)
+	}
+	wg.Wait()
+
+	tb.inflightMu.Lock()
+	for tb.inflight > 0 {
+		tb.inflightDone.Wait()
+	}
+	tb.inflightMu.Unlock()
+}
+
+// close flushes the bundler and stops its goroutines.
+// Traces added afterwards are dropped.
+func (tb *traceBundler) close() {
+	tb.closeOnce.Do(func() {
+		tb.closeMu.Lock()
+		tb.closed = true
+		tb.closeMu.Unlock()
+		tb.flush()
+		close(tb.done)
+		tb.feeders.Wait()
+	})
+}
+
+// handle uploads the bundle, grouping traces by recorder and project.
+func (tb *traceBundler) handle(bundle []*bundledTrace) {
+	var size int64
+	groups := make(map[uploadKey][]*cloudtrace.Trace)
+	var spans map[uploadKey]spansV2
+	for _, bt := range bundle {
+		size += bt.size
+		k := uploadKey{rec: bt.rec, project: bt.project}
+		groups[k] = append(groups[k], bt.trace)
+		if bt.spanV2 != nil {
+			if spans == nil {
+				spans = make(map[uploadKey]spansV2)
+			}
+			if spans[k] == nil {
+				spans[k] = make(spansV2)
+			}
+			spans[k][bt.trace.Spans[0]] = bt.spanV2
+		}
+	}
+	defer atomic.AddInt64(&tb.pendingBytes, -size)
+
+	for k, traces := range groups {
+		k.uploadTraces(traces, spans[k])
+	}
+}
+
+// uploadTraces uploads the traces of the recorder to the project,
+// logging the error.
+func (k uploadKey) uploadTraces(traces []*cloudtrace.Trace, spans spansV2) {
+	defer k.rec.recoverPanic("uploading traces", countSpans(traces))
+	if err := k.rec.upload(k.project, traces, spans); err != nil {
+		k.rec.logUploadError(err)
+	}
+}
+
+// SharedBundler buffers spans of multiple recorders, so they share one
+// upload worker pool and one memory budget instead of multiplying them
+// by the number of recorders.
+type SharedBundler struct {
+	tb *traceBundler
+}
+
+// NewSharedBundler creates new bundler configured by the bundler options:
+// WithBundleDelayThreshold, WithBundleCountThreshold, WithBufferedLimit,
+// WithBlockOnOverflow, WithMemoryLimit, WithUploadConcurrency and
+// WithBundlerShards.
+// Other options are ignored.
+func NewSharedBundler(opts ...Option) *SharedBundler {
+	options := defaultOptions()
+	for _, o := range opts {
+		o(&options)
+	}
+	return &SharedBundler{tb: newTraceBundler(&options)}
+}
+
+// Flush uploads spans buffered by all the recorders.
+func (s *SharedBundler) Flush() {
+	s.tb.flush()
+}
+
+// Close uploads spans buffered by all the recorders and stops
+// the background goroutines. Spans recorded afterwards are dropped.
+func (s *SharedBundler) Close() error {
+	s.tb.close()
+	return nil
+}
+
+// PendingBytes returns approximate number of bytes held by buffered spans.
+func (s *SharedBundler) PendingBytes() int64 {
+	return atomic.LoadInt64(&s.tb.pendingBytes)
+}
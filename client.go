@@ -0,0 +1,52 @@
+package gcloudtracer
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/option"
+)
+
+// clientFactory returns a function creating the Cloud Trace client.
+func clientFactory(ctx context.Context, o *Options) func() (*cloudtrace.Service, error) {
+	opts := clientOptions(o)
+	return func() (*cloudtrace.Service, error) {
+		return cloudtrace.NewService(ctx, opts...)
+	}
+}
+
+// clientOptions returns options of the Cloud Trace clients.
+func clientOptions(o *Options) []option.ClientOption {
+	return append(credentialOptions(o), o.clientOptions...)
+}
+
+// credentialOptions returns options authorizing clients with the credentials
+// of the Recorder, Application Default Credentials are used unless specified
+// otherwise.
+func credentialOptions(o *Options) []option.ClientOption {
+	var clientOptions []option.ClientOption
+	if o.keySource != nil {
+		clientOptions = append(clientOptions, option.WithTokenSource(o.keySource))
+	} else if o.credentials.Email != "" {
+		clientOptions = append(clientOptions, option.WithHTTPClient(jwtConfig(o.credentials).Client(oauth2.NoContext)))
+	}
+	return clientOptions
+}
+
+// client returns the Cloud Trace client, creating it on first use.
+// Creation is attempted again on the next use if it fails.
+func (r *Recorder) client() (*cloudtrace.Service, error) {
+	r.clientMu.Lock()
+	defer r.clientMu.Unlock()
+
+	if r.traceClient != nil {
+		return r.traceClient, nil
+	}
+	c, err := r.newClient()
+	if err != nil {
+		return nil, err
+	}
+	r.traceClient = c
+	return c, nil
+}
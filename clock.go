@@ -0,0 +1,39 @@
+package gcloudtracer
+
+import "time"
+
+// TimestampWarningLabel is set on spans whose timestamps were corrected
+// because of a clock anomaly, describing the anomaly.
+const TimestampWarningLabel = "timestamp.warning"
+
+// now returns the receipt time of spans, it's replaced in tests.
+var now = time.Now
+
+// spanTimes returns the start and end time of the span, and a warning
+// if they were corrected: spans without a start time end at the receipt
+// time, and spans with a negative duration end at their start time.
+// The end time is derived from the duration, which is measured by
+// the monotonic clock, so a wall clock step doesn't change it.
+func spanTimes(sp *RawSpan) (start, end time.Time, warning string) {
+	d := sp.Duration
+	if d < 0 {
+		d = 0
+		warning = "negative duration"
+	}
+	start = sp.Start
+	if start.IsZero() {
+		start = now().Add(-d)
+		warning = "missing start time"
+	}
+	return start, start.Add(d), warning
+}
+
+// logTime returns the time of a log of the span started at the start time,
+// offset from the start by the monotonic clock if both times have its reading,
+// so a wall clock step during the span doesn't move the log outside of it.
+func logTime(start, t time.Time) time.Time {
+	if start.IsZero() {
+		return t
+	}
+	return start.Add(t.Sub(start))
+}
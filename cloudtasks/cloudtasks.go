@@ -0,0 +1,115 @@
+// Package cloudtasks propagates the span context through Cloud Tasks
+// and Cloud Scheduler HTTP targets, so deferred work appears as a part
+// of the trace that enqueued it.
+//
+// The headers of the span context are set on the task when it's enqueued:
+//
+//	headers, err := cloudtasks.Headers(tracer, span.Context())
+//	// ...
+//	task := &cloudtaskspb.Task{MessageType: &cloudtaskspb.Task_HttpRequest{
+//		HttpRequest: &cloudtaskspb.HttpRequest{Url: url, Headers: headers},
+//	}}
+//
+// and the handler of the target continues the trace with StartSpan.
+package cloudtasks
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Headers set by Cloud Tasks on requests of HTTP targets.
+const (
+	QueueNameHeader      = "X-CloudTasks-QueueName"
+	TaskNameHeader       = "X-CloudTasks-TaskName"
+	RetryCountHeader     = "X-CloudTasks-TaskRetryCount"
+	ExecutionCountHeader = "X-CloudTasks-TaskExecutionCount"
+	ETAHeader            = "X-CloudTasks-TaskETA"
+)
+
+// Headers set by Cloud Scheduler on requests of HTTP targets.
+const (
+	SchedulerHeader    = "X-CloudScheduler"
+	JobNameHeader      = "X-CloudScheduler-JobName"
+	ScheduleTimeHeader = "X-CloudScheduler-ScheduleTime"
+)
+
+// Tags of spans of tasks and jobs.
+const (
+	QueueTag          = "cloudtasks.queue"
+	TaskTag           = "cloudtasks.task"
+	RetryCountTag     = "cloudtasks.retry_count"
+	ExecutionCountTag = "cloudtasks.execution_count"
+	ETATag            = "cloudtasks.eta"
+	JobTag            = "cloudscheduler.job"
+	ScheduleTimeTag   = "cloudscheduler.schedule_time"
+)
+
+// Headers returns the headers propagating the span context, to be set
+// on a Cloud Tasks task or a Cloud Scheduler job with an HTTP target.
+func Headers(tracer opentracing.Tracer, sc opentracing.SpanContext) (map[string]string, error) {
+	h := http.Header{}
+	if err := tracer.Inject(sc, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(h))
+	for k := range h {
+		headers[k] = h.Get(k)
+	}
+	return headers, nil
+}
+
+// Tags returns the tags of the task or the job of the request, it's empty
+// for requests of neither Cloud Tasks nor Cloud Scheduler.
+func Tags(r *http.Request) opentracing.Tags {
+	tags := opentracing.Tags{}
+	for header, tag := range map[string]string{
+		QueueNameHeader:    QueueTag,
+		TaskNameHeader:     TaskTag,
+		ETAHeader:          ETATag,
+		JobNameHeader:      JobTag,
+		ScheduleTimeHeader: ScheduleTimeTag,
+	} {
+		if v := r.Header.Get(header); v != "" {
+			tags[tag] = v
+		}
+	}
+	for header, tag := range map[string]string{
+		RetryCountHeader:     RetryCountTag,
+		ExecutionCountHeader: ExecutionCountTag,
+	} {
+		if v, err := strconv.Atoi(r.Header.Get(header)); err == nil {
+			tags[tag] = v
+		}
+	}
+	return tags
+}
+
+// StartSpan starts a consumer span of the task or the job of the request,
+// following from the span context extracted from the request headers if any,
+// and returns the request context with the span. The span is named after
+// the queue or the job unless the operation name is set.
+func StartSpan(tracer opentracing.Tracer, r *http.Request, operationName string) (opentracing.Span, context.Context) {
+	tags := Tags(r)
+	if operationName == "" {
+		switch {
+		case tags[QueueTag] != nil:
+			operationName = "cloudtasks " + tags[QueueTag].(string)
+		case tags[JobTag] != nil:
+			operationName = "cloudscheduler " + tags[JobTag].(string)
+		default:
+			operationName = "HTTP " + r.Method
+		}
+	}
+	opts := []opentracing.StartSpanOption{ext.SpanKindConsumer, tags}
+	if parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header)); err == nil {
+		opts = append(opts, opentracing.FollowsFrom(parent))
+	}
+	sp := tracer.StartSpan(operationName, opts...)
+	ext.Component.Set(sp, "cloudtasks")
+	return sp, opentracing.ContextWithSpan(r.Context(), sp)
+}
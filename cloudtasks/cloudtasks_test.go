@@ -0,0 +1,114 @@
+package cloudtasks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaders(t *testing.T) {
+	tracer := mocktracer.New()
+	parent := tracer.StartSpan("enqueue")
+	parent.SetBaggageItem("tenant", "de")
+
+	headers, err := Headers(tracer, parent.Context())
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/tasks", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	sc, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+	assert.NoError(t, err)
+	assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, sc.(mocktracer.MockSpanContext).SpanID)
+	assert.Equal(t, "de", sc.(mocktracer.MockSpanContext).Baggage["tenant"])
+}
+
+func TestTags(t *testing.T) {
+	t.Run("request=task", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/tasks", nil)
+		r.Header.Set(QueueNameHeader, "emails")
+		r.Header.Set(TaskNameHeader, "task-1")
+		r.Header.Set(RetryCountHeader, "2")
+		r.Header.Set(ExecutionCountHeader, "1")
+		r.Header.Set(ETAHeader, "1577934245.000000")
+
+		assert.Equal(t, opentracing.Tags{
+			QueueTag:          "emails",
+			TaskTag:           "task-1",
+			RetryCountTag:     2,
+			ExecutionCountTag: 1,
+			ETATag:            "1577934245.000000",
+		}, Tags(r))
+	})
+
+	t.Run("request=job", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/jobs", nil)
+		r.Header.Set(SchedulerHeader, "true")
+		r.Header.Set(JobNameHeader, "reports")
+		r.Header.Set(ScheduleTimeHeader, "2020-01-02T03:04:05Z")
+
+		assert.Equal(t, opentracing.Tags{JobTag: "reports", ScheduleTimeTag: "2020-01-02T03:04:05Z"}, Tags(r))
+	})
+
+	t.Run("request=plain", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(RetryCountHeader, "n/a")
+		assert.Empty(t, Tags(r))
+	})
+}
+
+func TestStartSpan(t *testing.T) {
+	t.Run("parent=headers", func(t *testing.T) {
+		tracer := mocktracer.New()
+		parent := tracer.StartSpan("enqueue")
+		headers, _ := Headers(tracer, parent.Context())
+		r := httptest.NewRequest(http.MethodPost, "/tasks", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		r.Header.Set(QueueNameHeader, "emails")
+
+		sp, ctx := StartSpan(tracer, r, "")
+		sp.Finish()
+
+		assert.Equal(t, sp, opentracing.SpanFromContext(ctx))
+		finished := tracer.FinishedSpans()[0]
+		assert.Equal(t, "cloudtasks emails", finished.OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, finished.ParentID)
+		assert.Equal(t, ext.SpanKindConsumerEnum, finished.Tags()["span.kind"])
+		assert.Equal(t, "emails", finished.Tags()[QueueTag])
+		assert.Equal(t, "cloudtasks", finished.Tags()["component"])
+	})
+
+	for _, tc := range []struct {
+		name          string
+		header        string
+		value         string
+		operationName string
+		expected      string
+	}{
+		{name: "job", header: JobNameHeader, value: "reports", expected: "cloudscheduler reports"},
+		{name: "plain", expected: "HTTP POST"},
+		{name: "operation_name", header: QueueNameHeader, value: "emails", operationName: "send", expected: "send"},
+	} {
+		t.Run("name="+tc.name, func(t *testing.T) {
+			tracer := mocktracer.New()
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			sp, _ := StartSpan(tracer, r, tc.operationName)
+			sp.Finish()
+
+			finished := tracer.FinishedSpans()[0]
+			assert.Equal(t, tc.expected, finished.OperationName)
+			assert.Equal(t, 0, finished.ParentID)
+		})
+	}
+}
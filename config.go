@@ -0,0 +1,144 @@
+package gcloudtracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config describes all the options of the Recorder,
+// so it can be shipped as a single YAML or JSON file.
+type Config struct {
+	// Project is the default project spans are uploaded to.
+	Project string `json:"project" yaml:"project"`
+	// ProjectTag is the span tag holding a project overriding the default one.
+	ProjectTag string `json:"project_tag" yaml:"project_tag"`
+	// Credentials is a path to the service account json key file.
+	Credentials string `json:"credentials" yaml:"credentials"`
+	// Endpoint overrides the Cloud Trace API endpoint.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// SamplingRate is a fraction of sampled traces uploaded, 1 if not set.
+	SamplingRate *float64 `json:"sampling_rate" yaml:"sampling_rate"`
+	// IgnoreOperations lists operations which spans are never uploaded.
+	IgnoreOperations []string `json:"ignore_operations" yaml:"ignore_operations"`
+	// Labels are added to all spans.
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	// Detectors lists environments detected for labels:
+	// gke, cloudrun, gce, appengine and buildinfo.
+	Detectors []string `json:"detectors" yaml:"detectors"`
+	// Synchronous makes every span upload as soon as it is recorded.
+	Synchronous bool `json:"synchronous" yaml:"synchronous"`
+	// Debug enables debug messages.
+	Debug bool `json:"debug" yaml:"debug"`
+	// Bundler configures buffering of spans.
+	Bundler BundlerConfig `json:"bundler" yaml:"bundler"`
+}
+
+// BundlerConfig describes buffering of spans, zero values keep the defaults.
+type BundlerConfig struct {
+	// DelayThreshold is a duration like "2s".
+	DelayThreshold string `json:"delay_threshold" yaml:"delay_threshold"`
+	// DelayJitter is a duration like "500ms".
+	DelayJitter    string `json:"delay_jitter" yaml:"delay_jitter"`
+	CountThreshold int    `json:"count_threshold" yaml:"count_threshold"`
+	BufferedLimit  int    `json:"buffered_limit" yaml:"buffered_limit"`
+}
+
+// LoadConfig reads Config from the file. Files with the .json extension
+// are decoded as JSON, others as YAML.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, &cfg)
+	} else {
+		err = yaml.Unmarshal(b, &cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config %s: %s", path, err)
+	}
+	return &cfg, nil
+}
+
+// Options converts Config into recorder options.
+func (c *Config) Options() ([]Option, error) {
+	var opts []Option
+
+	if c.Project != "" {
+		opts = append(opts, WithProject(c.Project))
+	}
+	if c.ProjectTag != "" {
+		opts = append(opts, WithProjectTag(c.ProjectTag))
+	}
+	if c.Credentials != "" {
+		credentials, err := LoadJWTCredentials(c.Credentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credentials from %s: %s", c.Credentials, err)
+		}
+		opts = append(opts, WithJWTCredentials(credentials))
+	}
+	if c.Endpoint != "" {
+		opts = append(opts, WithClientOption(option.WithEndpoint(c.Endpoint)))
+	}
+	if c.SamplingRate != nil {
+		opts = append(opts, WithSamplingRate(*c.SamplingRate))
+	}
+	if len(c.IgnoreOperations) > 0 {
+		opts = append(opts, WithFilter(IgnoreOperations(c.IgnoreOperations...)))
+	}
+	if len(c.Labels) > 0 {
+		opts = append(opts, WithDefaultLabels(c.Labels))
+	}
+	for _, name := range c.Detectors {
+		opt, ok := detectorOptions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q", name)
+		}
+		opts = append(opts, opt())
+	}
+	if c.Synchronous {
+		opts = append(opts, WithSynchronousUpload())
+	}
+	opts = append(opts, WithDebug(c.Debug))
+
+	if c.Bundler.DelayThreshold != "" {
+		d, err := time.ParseDuration(c.Bundler.DelayThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundler delay threshold: %s", err)
+		}
+		opts = append(opts, WithBundleDelayThreshold(d))
+	}
+	if c.Bundler.DelayJitter != "" {
+		d, err := time.ParseDuration(c.Bundler.DelayJitter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundler delay jitter: %s", err)
+		}
+		opts = append(opts, WithBundleDelayJitter(d))
+	}
+	if c.Bundler.CountThreshold > 0 {
+		opts = append(opts, WithBundleCountThreshold(c.Bundler.CountThreshold))
+	}
+	if c.Bundler.BufferedLimit > 0 {
+		opts = append(opts, WithBufferedLimit(c.Bundler.BufferedLimit))
+	}
+
+	return opts, nil
+}
+
+var detectorOptions = map[string]func() Option{
+	"gke":       func() Option { return WithDetector(DetectGKE) },
+	"cloudrun":  WithCloudRun,
+	"gce":       func() Option { return WithDetector(DetectGCE) },
+	"appengine": func() Option { return WithDetector(DetectAppEngine) },
+	"buildinfo": func() Option { return WithDetector(DetectBuildInfo) },
+}
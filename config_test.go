@@ -0,0 +1,208 @@
+package gcloudtracer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcloudtracer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	t.Run("format=yaml", func(t *testing.T) {
+		cfg, err := LoadConfig(write("config.yaml", `
+project: test_project
+sampling_rate: 0.5
+ignore_operations: [healthcheck]
+labels:
+  env: test
+bundler:
+  delay_threshold: 5s
+  count_threshold: 10
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, "test_project", cfg.Project)
+		assert.Equal(t, 0.5, *cfg.SamplingRate)
+		assert.Equal(t, []string{"healthcheck"}, cfg.IgnoreOperations)
+		assert.Equal(t, map[string]string{"env": "test"}, cfg.Labels)
+		assert.Equal(t, "5s", cfg.Bundler.DelayThreshold)
+		assert.Equal(t, 10, cfg.Bundler.CountThreshold)
+
+		opts, err := cfg.Options()
+		assert.NoError(t, err)
+
+		options := defaultOptions()
+		for _, o := range opts {
+			o(&options)
+		}
+		assert.Equal(t, "test_project", options.projectID)
+		assert.Equal(t, 0.5, options.samplingRate)
+		assert.Equal(t, 10, options.bundleCount)
+		assert.Len(t, options.filters, 1)
+	})
+
+	t.Run("format=json", func(t *testing.T) {
+		cfg, err := LoadConfig(write("config.json", `{"project": "test_project", "debug": true}`))
+		assert.NoError(t, err)
+		assert.Equal(t, "test_project", cfg.Project)
+		assert.True(t, cfg.Debug)
+		assert.Nil(t, cfg.SamplingRate)
+	})
+
+	t.Run("detector=unknown", func(t *testing.T) {
+		cfg, err := LoadConfig(write("unknown.yaml", "detectors: [mainframe]"))
+		assert.NoError(t, err)
+
+		_, err = cfg.Options()
+		assert.Error(t, err)
+	})
+
+	t.Run("config=invalid", func(t *testing.T) {
+		_, err := LoadConfig(write("invalid.json", "{"))
+		assert.Error(t, err)
+	})
+}
+
+func TestRecorderReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcloudtracer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	keyPath := filepath.Join(dir, "key.json")
+	write := func(path, content string) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+
+	var uploadsA, uploadsB int32
+	srvB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&uploadsB, 1)
+		w.Write([]byte("{}"))
+	}))
+	defer srvB.Close()
+	rec, srvA := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&uploadsA, 1)
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload())
+	defer srvA.Close()
+
+	write(path, "endpoint: "+srvA.URL+"\n")
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	client := newClientConfig(cfg)
+	c, err := rec.client()
+	assert.NoError(t, err)
+
+	t.Run("client=unchanged", func(t *testing.T) {
+		write(path, "endpoint: "+srvA.URL+"\nsampling_rate: 0\n")
+		assert.NoError(t, rec.reloadConfig(path, &client))
+		same, err := rec.client()
+		assert.NoError(t, err)
+		assert.True(t, c == same)
+		assert.Equal(t, uint64(0), rec.currentSettings().sampleBound)
+	})
+
+	t.Run("client=endpoint", func(t *testing.T) {
+		write(path, "endpoint: "+srvB.URL+"\n")
+		assert.NoError(t, rec.reloadConfig(path, &client))
+		rebuilt, err := rec.client()
+		assert.NoError(t, err)
+		assert.False(t, c == rebuilt)
+		c = rebuilt
+
+		rec.RecordSpan(testSpan(1, 1))
+		assert.Zero(t, atomic.LoadInt32(&uploadsA))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&uploadsB))
+	})
+
+	t.Run("client=credentials", func(t *testing.T) {
+		write(keyPath, testKey)
+		write(path, "endpoint: "+srvB.URL+"\ncredentials: "+keyPath+"\n")
+		assert.NoError(t, rec.reloadConfig(path, &client))
+		rebuilt, err := rec.client()
+		assert.NoError(t, err)
+		assert.False(t, c == rebuilt)
+		c = rebuilt
+
+		assert.NoError(t, rec.reloadConfig(path, &client))
+		same, err := rec.client()
+		assert.NoError(t, err)
+		assert.True(t, c == same)
+
+		// a rotated key is picked up
+		write(keyPath, strings.Replace(testKey, `"1"`, `"2"`, 1))
+		assert.NoError(t, rec.reloadConfig(path, &client))
+		rotated, err := rec.client()
+		assert.NoError(t, err)
+		assert.False(t, c == rotated)
+	})
+}
+
+func TestRecorderRebuildClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcloudtracer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	credentials, err := ParseJWTCredentials([]byte(testKey))
+	assert.NoError(t, err)
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithJWTCredentials(credentials))
+	defer srv.Close()
+
+	client := clientConfig{endpoint: srv.URL}
+	assert.NoError(t, ioutil.WriteFile(path, []byte("endpoint: http://localhost:1\n"), 0600))
+	assert.NoError(t, rec.reloadConfig(path, &client))
+	assert.Equal(t, credentials, rec.clientOptions.credentials, "credentials of the options are kept")
+	assert.Len(t, rec.clientOptions.clientOptions, 3)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("endpoint: "+srv.URL+"\n"), 0600))
+	assert.NoError(t, rec.reloadConfig(path, &client))
+	assert.Equal(t, credentials, rec.clientOptions.credentials)
+	assert.Len(t, rec.clientOptions.clientOptions, 4)
+}
+
+func TestRecorderReload(t *testing.T) {
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithSamplingRate(0.5), WithFilter(IgnoreOperations("health")), WithDefaultLabels(map[string]string{"team": "a"}))
+	defer srv.Close()
+
+	rec.Reload(WithDefaultLabels(map[string]string{"env": "test"}), WithFilter(IgnoreOperations("metrics")))
+	set := rec.currentSettings()
+	assert.Equal(t, sampleBound(0.5), set.sampleBound)
+	assert.Len(t, set.filters, 2)
+	assert.Equal(t, map[string]string{"team": "a", "env": "test"}, set.labels)
+
+	rec.Reload(WithSamplingRate(1))
+	set = rec.currentSettings()
+	assert.Equal(t, sampleBound(1), set.sampleBound)
+	assert.Len(t, set.filters, 1, "filters of previous reloads are replaced")
+	assert.Equal(t, map[string]string{"team": "a"}, set.labels)
+}
+
+func TestRecorderWatchConfigInterval(t *testing.T) {
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	defer srv.Close()
+	defer rec.Close()
+
+	assert.Error(t, rec.WatchConfig(context.Background(), "config.yaml", 0))
+}
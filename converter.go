@@ -0,0 +1,59 @@
+package gcloudtracer
+
+import (
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// SpanConverter converts spans recorded by the Recorder into traces,
+// see WithConverter.
+type SpanConverter interface {
+	ConvertSpan(sp RawSpan) *cloudtrace.Trace
+}
+
+// Converter converts spans into Cloud Trace traces with the tags, default
+// labels, kinds and timestamps the Recorder converts them with, for custom
+// exporters, tests and offline processing. Labels the Recorder derives from
+// spans afterwards, e.g. WithPeerService or WithMaxEvents ones, and scrubbing
+// of labels, e.g. WithHashedLabels or WithSafeMode, aren't applied. The
+// Recorder applies them to traces of a Converter set by WithConverter too.
+type Converter struct {
+	project    string
+	projectTag string
+	labels     map[string]string
+	spanKind   SpanKindFunc
+	merge      labelMerge
+}
+
+// NewConverter creates new Converter configured by WithProject,
+// WithProjectTag, WithDefaultLabels, WithDetector, WithSpanKindFunc,
+// WithLabelMergePolicy and WithMultiValueLabels options.
+// Other options are ignored.
+func NewConverter(opts ...Option) *Converter {
+	options := defaultOptions()
+	for _, o := range opts {
+		o(&options)
+	}
+
+	labels := make(map[string]string)
+	for _, d := range options.detectors {
+		for k, v := range d() {
+			labels[k] = v
+		}
+	}
+	for k, v := range options.labels {
+		labels[k] = v
+	}
+
+	return &Converter{
+		project:    options.projectID,
+		projectTag: options.projectTag,
+		labels:     labels,
+		spanKind:   options.spanKind,
+		merge:      options.merge,
+	}
+}
+
+// ConvertSpan converts the span into a trace holding just that span.
+func (c *Converter) ConvertSpan(sp RawSpan) *cloudtrace.Trace {
+	return convertSpan(sp, c.project, c.projectTag, c.labels, c.spanKind, c.merge)
+}
@@ -0,0 +1,212 @@
+package gcloudtracer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+func TestConverter(t *testing.T) {
+	c := NewConverter(
+		WithProject("test_project"),
+		WithProjectTag("project"),
+		WithDefaultLabels(map[string]string{"env": "test", "component": "default"}),
+	)
+
+	sp := testSpan(1, 2)
+	sp.ParentSpanID = 1
+	sp.Start = time.Date(2018, 1, 2, 3, 4, 5, 6, time.UTC)
+	sp.Tags = opentracing.Tags{
+		string(ext.SpanKind):   ext.SpanKindRPCClientEnum,
+		string(ext.HTTPMethod): "GET",
+		HTTPRouteTag:           "/orders/{id}",
+		HTTPResponseSizeTag:    512,
+		"component":            "net/http",
+	}
+
+	t.Run("project=default", func(t *testing.T) {
+		trace := c.ConvertSpan(sp)
+		assert.Equal(t, "test_project", trace.ProjectId)
+		assert.Equal(t, "00000000000000010000000000000001", trace.TraceId)
+		if assert.Len(t, trace.Spans, 1) {
+			span := trace.Spans[0]
+			assert.Equal(t, uint64(2), span.SpanId)
+			assert.Equal(t, uint64(1), span.ParentSpanId)
+			assert.Equal(t, "RPC_CLIENT", span.Kind)
+			assert.Equal(t, "2018-01-02T03:04:05.000000006Z", span.StartTime)
+			assert.Equal(t, "2018-01-02T03:04:05.001000006Z", span.EndTime)
+			assert.Equal(t, map[string]string{
+				"trace.cloud.google.com/http/method":        "GET",
+				"trace.cloud.google.com/http/route":         "/orders/{id}",
+				"trace.cloud.google.com/http/response/size": "512",
+				"component": "net/http",
+				"env":       "test",
+			}, span.Labels)
+		}
+	})
+
+	t.Run("project=tag", func(t *testing.T) {
+		sp.Tags["project"] = "other_project"
+		trace := c.ConvertSpan(sp)
+		assert.Equal(t, "other_project", trace.ProjectId)
+		assert.NotContains(t, trace.Spans[0].Labels, "project")
+	})
+
+	t.Run("tag=bool", func(t *testing.T) {
+		sp := testSpan(1, 1)
+		sp.Tags = opentracing.Tags{string(ext.Error): true, "cache.hit": false}
+		labels := c.ConvertSpan(sp).Spans[0].Labels
+		assert.Equal(t, "true", labels[string(ext.Error)])
+		assert.Equal(t, "false", labels["cache.hit"])
+	})
+}
+
+type upperConverter struct {
+	*Converter
+}
+
+func (c upperConverter) ConvertSpan(sp RawSpan) *cloudtrace.Trace {
+	if sp.Operation == "drop" {
+		return nil
+	}
+	trace := c.Converter.ConvertSpan(sp)
+	trace.Spans[0].Name = strings.ToUpper(trace.Spans[0].Name)
+	return trace
+}
+
+func TestRecorderWithConverter(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		for _, tr := range req.Traces {
+			assert.Equal(t, "test_project", tr.ProjectId)
+			names = append(names, tr.Spans[0].Name)
+		}
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}, WithConverter(upperConverter{NewConverter()}))
+	defer srv.Close()
+
+	rec.RecordSpan(testSpan(1, 1))
+	dropped := testSpan(2, 2)
+	dropped.Operation = "drop"
+	rec.RecordSpan(dropped)
+	assert.NoError(t, rec.Flush(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"TEST"}, names)
+}
+
+func TestConvertSpanKind(t *testing.T) {
+	for kind, expected := range map[interface{}]string{
+		ext.SpanKindRPCServerEnum: "RPC_SERVER",
+		ext.SpanKindRPCClientEnum: "RPC_CLIENT",
+		ext.SpanKindConsumerEnum:  "RPC_SERVER",
+		ext.SpanKindProducerEnum:  "RPC_CLIENT",
+		"server":                  "RPC_SERVER",
+		"internal":                "SPAN_KIND_UNSPECIFIED",
+		nil:                       "SPAN_KIND_UNSPECIFIED",
+	} {
+		t.Run(fmt.Sprintf("kind=%v", kind), func(t *testing.T) {
+			assert.Equal(t, expected, convertSpanKind(opentracing.Tags{string(ext.SpanKind): kind}))
+		})
+	}
+
+	t.Run("kind=custom", func(t *testing.T) {
+		c := NewConverter(WithSpanKindFunc(func(tags opentracing.Tags) string {
+			if tags["grpc"] == true {
+				return "RPC_SERVER"
+			}
+			return "SPAN_KIND_UNSPECIFIED"
+		}))
+		sp := testSpan(1, 1)
+		sp.Tags = opentracing.Tags{"grpc": true}
+		assert.Equal(t, "RPC_SERVER", c.ConvertSpan(sp).Spans[0].Kind)
+	})
+}
+
+func TestConvertTimestamps(t *testing.T) {
+	c := NewConverter(WithProject("test_project"))
+	received := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return received }
+
+	t.Run("timestamps=valid", func(t *testing.T) {
+		sp := testSpan(1, 1)
+		span := c.ConvertSpan(sp).Spans[0]
+		assert.NotContains(t, span.Labels, TimestampWarningLabel)
+	})
+
+	t.Run("duration=negative", func(t *testing.T) {
+		sp := testSpan(1, 1)
+		sp.Start = received
+		sp.Duration = -time.Second
+		span := c.ConvertSpan(sp).Spans[0]
+		assert.Equal(t, "2018-01-02T03:04:05Z", span.StartTime)
+		assert.Equal(t, "2018-01-02T03:04:05Z", span.EndTime)
+		assert.Equal(t, "negative duration", span.Labels[TimestampWarningLabel])
+	})
+
+	t.Run("start=zero", func(t *testing.T) {
+		sp := testSpan(1, 1)
+		sp.Start = time.Time{}
+		sp.Duration = time.Second
+		span := c.ConvertSpan(sp).Spans[0]
+		assert.Equal(t, "2018-01-02T03:04:04Z", span.StartTime)
+		assert.Equal(t, "2018-01-02T03:04:05Z", span.EndTime)
+		assert.Equal(t, "missing start time", span.Labels[TimestampWarningLabel])
+	})
+}
+
+func TestConverterLabelMergePolicy(t *testing.T) {
+	sp := testSpan(1, 1)
+	sp.Tags = opentracing.Tags{
+		string(ext.HTTPUrl):               "/orders/1",
+		"trace.cloud.google.com/http/url": "https://example.com/orders/1",
+		"env":                             "staging",
+	}
+	defaults := WithDefaultLabels(map[string]string{"env": "test"})
+
+	for _, tc := range []struct {
+		policy   LabelMergePolicy
+		url, env string
+	}{
+		{MergeUserWins, "/orders/1", "staging"},
+		{MergeNativeWins, "https://example.com/orders/1", "test"},
+		{MergeCombine, "https://example.com/orders/1|/orders/1", "test|staging"},
+	} {
+		t.Run(fmt.Sprintf("policy=%d", tc.policy), func(t *testing.T) {
+			c := NewConverter(WithProject("test_project"), defaults, WithLabelMergePolicy(tc.policy, "|"))
+			labels := c.ConvertSpan(sp).Spans[0].Labels
+			assert.Equal(t, tc.url, labels["trace.cloud.google.com/http/url"])
+			assert.Equal(t, tc.env, labels["env"])
+			assert.NotContains(t, labels, string(ext.HTTPUrl))
+		})
+	}
+
+	t.Run("separator=default", func(t *testing.T) {
+		c := NewConverter(WithProject("test_project"), defaults, WithLabelMergePolicy(MergeCombine, ""))
+		assert.Equal(t, "test,staging", c.ConvertSpan(sp).Spans[0].Labels["env"])
+	})
+}
+
+func TestLogTime(t *testing.T) {
+	start := time.Now()
+	logged := start.Add(1500 * time.Millisecond)
+	assert.Equal(t, 1500*time.Millisecond, logTime(start, logged).Sub(start.Round(0)))
+	assert.Equal(t, logged, logTime(time.Time{}, logged))
+}
@@ -0,0 +1,136 @@
+package gcloudtracer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// maxCostOperations bounds the number of operations accounted separately,
+// spans of other operations are accounted as OtherOperation.
+const maxCostOperations = 1000
+
+// costReportSize is a number of the most expensive operations logged
+// by the default cost report.
+const costReportSize = 10
+
+// OperationCost holds the number of spans of the operation uploaded
+// by the Recorder, and their approximate size.
+type OperationCost struct {
+	Operation string
+	Spans     uint64
+	Bytes     uint64
+}
+
+// CostReportFunc is called with the costs of operations, see WithCostReport.
+type CostReportFunc func(costs []OperationCost)
+
+// costAccounting accounts uploaded spans per operation.
+type costAccounting struct {
+	interval time.Duration
+	report   CostReportFunc
+
+	mu  sync.Mutex
+	ops map[string]*OperationCost
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newCostAccounting(interval time.Duration, report CostReportFunc) *costAccounting {
+	return &costAccounting{
+		interval: interval,
+		report:   report,
+		ops:      make(map[string]*OperationCost),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// add accounts the spans of the uploaded traces.
+func (c *costAccounting) add(traces []*cloudtrace.Trace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range traces {
+		for _, s := range t.Spans {
+			op := c.ops[s.Name]
+			if op == nil {
+				name := s.Name
+				if len(c.ops) >= maxCostOperations {
+					name = OtherOperation
+				}
+				if op = c.ops[name]; op == nil {
+					op = &OperationCost{Operation: name}
+					c.ops[name] = op
+				}
+			}
+			op.Spans++
+			op.Bytes += uint64(spanSize(s))
+		}
+	}
+}
+
+// costs returns the costs of operations, the most expensive first.
+func (c *costAccounting) costs() []OperationCost {
+	c.mu.Lock()
+	costs := make([]OperationCost, 0, len(c.ops))
+	for _, op := range c.ops {
+		costs = append(costs, *op)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Bytes != costs[j].Bytes {
+			return costs[i].Bytes > costs[j].Bytes
+		}
+		return costs[i].Operation < costs[j].Operation
+	})
+	return costs
+}
+
+// Costs returns the number and approximate size of spans uploaded
+// since the Recorder was created per operation, the most expensive first.
+// It returns nil unless WithCostReport is enabled.
+func (r *Recorder) Costs() []OperationCost {
+	if r.costs == nil {
+		return nil
+	}
+	return r.costs.costs()
+}
+
+// runCostReport reports the costs every interval until the Recorder
+// is shut down.
+func (r *Recorder) runCostReport() {
+	c := r.costs
+	defer close(c.done)
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-c.stop:
+			return
+		}
+		c.report(c.costs())
+	}
+}
+
+// logCosts logs the most expensive operations.
+func (r *Recorder) logCosts(costs []OperationCost) {
+	for i, c := range costs {
+		if i == costReportSize {
+			break
+		}
+		r.log.Errorf("tracing cost of operation %q: %d spans, %d bytes", c.Operation, c.Spans, c.Bytes)
+	}
+}
+
+// stopCostReport stops the periodic cost report.
+func (r *Recorder) stopCostReport() {
+	if r.costs != nil && r.costs.interval > 0 {
+		close(r.costs.stop)
+		<-r.costs.done
+	}
+}
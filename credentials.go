@@ -0,0 +1,139 @@
+package gcloudtracer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// keyLoadTimeout bounds loading of the service account key on rotation.
+const keyLoadTimeout = 30 * time.Second
+
+// keyLoader loads the service account json key.
+type keyLoader func(ctx context.Context) ([]byte, error)
+
+// jwtConfig returns the config authorizing the Cloud Trace clients
+// with the credentials.
+func jwtConfig(credentials JWTCredentials) *jwt.Config {
+	// Your credentials should be obtained from the Google
+	// Developer Console (https://console.developers.google.com).
+	return &jwt.Config{
+		Email:        credentials.Email,
+		PrivateKey:   credentials.PrivateKey,
+		PrivateKeyID: credentials.PrivateKeyID,
+		Scopes: []string{
+			"https://www.googleapis.com/auth/trace.append",
+			"https://www.googleapis.com/auth/trace.readonly",
+			"https://www.googleapis.com/auth/cloud-platform",
+		},
+		TokenURL: google.JWTTokenURL,
+	}
+}
+
+// loadedCredentials is a token source of the service account key loaded
+// by the loader on first use, and again once the refresh interval passed
+// if positive, so rotated keys are picked up. The previous key is kept
+// if loading fails.
+type loadedCredentials struct {
+	load    keyLoader
+	refresh time.Duration
+
+	mu     sync.Mutex
+	ts     oauth2.TokenSource
+	loaded time.Time
+}
+
+// Token returns a token of the current key.
+func (c *loadedCredentials) Token() (*oauth2.Token, error) {
+	ts, err := c.tokenSource(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return ts.Token()
+}
+
+// tokenSource returns the token source of the current key,
+// loading the key if it's missing or due.
+func (c *loadedCredentials) tokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ts != nil && (c.refresh <= 0 || time.Since(c.loaded) < c.refresh) {
+		return c.ts, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, keyLoadTimeout)
+	defer cancel()
+	ts, err := c.reload(ctx)
+	if err != nil {
+		if c.ts == nil {
+			return nil, err
+		}
+		// Retried after the refresh interval, until then the previous key is used.
+		c.loaded = time.Now()
+		return c.ts, nil
+	}
+	c.ts, c.loaded = ts, time.Now()
+	return ts, nil
+}
+
+func (c *loadedCredentials) reload(ctx context.Context) (oauth2.TokenSource, error) {
+	data, err := c.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service account key: %w", err)
+	}
+	credentials, err := ParseJWTCredentials(data)
+	if err != nil {
+		return nil, err
+	}
+	return jwtConfig(credentials).TokenSource(context.Background()), nil
+}
+
+// secretKeyLoader returns a loader of the key stored in the secret version
+// of Secret Manager.
+func secretKeyLoader(name string, opts []option.ClientOption) keyLoader {
+	return func(ctx context.Context) ([]byte, error) {
+		c, err := secretmanager.NewService(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Payload == nil {
+			return nil, fmt.Errorf("secret %s has no payload", name)
+		}
+		return base64.StdEncoding.DecodeString(resp.Payload.Data)
+	}
+}
+
+// kmsKeyLoader returns a loader of the key encrypted with the Cloud KMS
+// crypto key, read from the file.
+func kmsKeyLoader(path, cryptoKey string, opts []option.ClientOption) keyLoader {
+	return func(ctx context.Context) ([]byte, error) {
+		ciphertext, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		c, err := cloudkms.NewService(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		req := &cloudkms.DecryptRequest{Ciphertext: base64.StdEncoding.EncodeToString(ciphertext)}
+		resp, err := c.Projects.Locations.KeyRings.CryptoKeys.Decrypt(cryptoKey, req).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(resp.Plaintext)
+	}
+}
@@ -0,0 +1,149 @@
+package gcloudtracer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+const testKey = `{"client_email": "tracer@test_project.iam.gserviceaccount.com", "private_key": "key", "private_key_id": "1"}`
+
+func TestCredentialsFromSecretManager(t *testing.T) {
+	name := "projects/test_project/secrets/key/versions/latest"
+	var accesses int32
+	secrets := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&accesses, 1)
+		switch r.URL.Path {
+		case "/v1/" + name + ":access":
+			json.NewEncoder(w).Encode(&secretmanager.AccessSecretVersionResponse{
+				Name:    name,
+				Payload: &secretmanager.SecretPayload{Data: base64.StdEncoding.EncodeToString([]byte(testKey))},
+			})
+		case "/v1/projects/test_project/secrets/invalid/versions/latest:access":
+			json.NewEncoder(w).Encode(&secretmanager.AccessSecretVersionResponse{
+				Payload: &secretmanager.SecretPayload{Data: base64.StdEncoding.EncodeToString([]byte("{}"))},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer secrets.Close()
+	secretOpts := []option.ClientOption{option.WithEndpoint(secrets.URL), clientOpt}
+
+	t.Run("secret=valid", func(t *testing.T) {
+		rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{}"))
+		}, WithCredentialsFromSecretManager(name, 0, secretOpts...))
+		defer srv.Close()
+		assert.NotNil(t, rec)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&accesses))
+	})
+
+	t.Run("secret=missing", func(t *testing.T) {
+		_, err := NewRecorder(context.Background(),
+			WithProject("test_project"),
+			WithCredentialsFromSecretManager("projects/test_project/secrets/missing/versions/1", 0, secretOpts...),
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("secret=invalid", func(t *testing.T) {
+		_, err := NewReader(context.Background(),
+			WithProject("test_project"),
+			WithCredentialsFromSecretManager("projects/test_project/secrets/invalid/versions/latest", 0, secretOpts...),
+		)
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	})
+}
+
+func TestKMSEncryptedCredentials(t *testing.T) {
+	cryptoKey := "projects/test_project/locations/global/keyRings/tracing/cryptoKeys/key"
+	kms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req cloudkms.DecryptRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		ciphertext, _ := base64.StdEncoding.DecodeString(req.Ciphertext)
+		if r.URL.Path != "/v1/"+cryptoKey+":decrypt" || string(ciphertext) != "encrypted" {
+			http.Error(w, "invalid ciphertext", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&cloudkms.DecryptResponse{Plaintext: base64.StdEncoding.EncodeToString([]byte(testKey))})
+	}))
+	defer kms.Close()
+	kmsOpts := []option.ClientOption{option.WithEndpoint(kms.URL), clientOpt}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key.json.enc")
+	assert.NoError(t, os.WriteFile(path, []byte("encrypted"), 0600))
+	invalid := filepath.Join(dir, "invalid.enc")
+	assert.NoError(t, os.WriteFile(invalid, []byte("plain"), 0600))
+
+	t.Run("key=encrypted", func(t *testing.T) {
+		c := &loadedCredentials{load: kmsKeyLoader(path, cryptoKey, kmsOpts)}
+		_, err := c.tokenSource(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("key=invalid", func(t *testing.T) {
+		_, err := NewRecorder(context.Background(),
+			WithProject("test_project"),
+			WithKMSEncryptedCredentials(invalid, cryptoKey, kmsOpts...),
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("key=missing", func(t *testing.T) {
+		_, err := NewRecorder(context.Background(),
+			WithProject("test_project"),
+			WithKMSEncryptedCredentials(filepath.Join(dir, "missing.enc"), cryptoKey, kmsOpts...),
+		)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
+
+func TestLoadedCredentialsRotation(t *testing.T) {
+	var loads int32
+	fail := false
+	c := &loadedCredentials{
+		refresh: 10 * time.Millisecond,
+		load: func(ctx context.Context) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			if fail {
+				return nil, errors.New("unavailable")
+			}
+			return []byte(testKey), nil
+		},
+	}
+
+	ts, err := c.tokenSource(context.Background())
+	assert.NoError(t, err)
+	same, err := c.tokenSource(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ts == same)
+	assert.EqualValues(t, 1, loads)
+
+	time.Sleep(20 * time.Millisecond)
+	rotated, err := c.tokenSource(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, ts == rotated)
+	assert.EqualValues(t, 2, loads)
+
+	fail = true
+	time.Sleep(20 * time.Millisecond)
+	kept, err := c.tokenSource(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, rotated == kept)
+	assert.EqualValues(t, 3, loads)
+}
@@ -0,0 +1,113 @@
+package gcloudtracer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// maxEnrichments bounds the number of values whose labels are cached
+// by an Enricher, the oldest values are evicted first.
+const maxEnrichments = 10000
+
+// LookupFunc returns the labels of spans having the value of a label,
+// e.g. the team owning an instance, see Enricher.
+type LookupFunc func(ctx context.Context, value string) (map[string]string, error)
+
+// Enricher returns a Processor adding the labels looked up for the value
+// of the key label of spans, unless set. Lookups run in background and
+// never hold spans back: spans are uploaded without the labels until they're
+// cached. Labels are cached for the ttl, and looked up again once expired,
+// keeping the cached ones meanwhile. Lookups are cancelled after the budget,
+// failed or panicking ones are retried once the ttl passed.
+func Enricher(key string, lookup LookupFunc, budget, ttl time.Duration) Processor {
+	e := &enricher{
+		key:     key,
+		lookup:  lookup,
+		budget:  budget,
+		ttl:     ttl,
+		entries: make(map[string]*enrichment),
+	}
+	return e.process
+}
+
+type enricher struct {
+	key    string
+	lookup LookupFunc
+	budget time.Duration
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*enrichment
+	// order lists the cached values, the oldest first.
+	order []string
+}
+
+// enrichment holds the labels looked up for a value.
+type enrichment struct {
+	labels     map[string]string
+	expires    time.Time
+	refreshing bool
+}
+
+func (e *enricher) process(span *cloudtrace.TraceSpan) bool {
+	v, ok := span.Labels[e.key]
+	if !ok {
+		return true
+	}
+	for k, vv := range e.get(v) {
+		if _, ok := span.Labels[k]; !ok {
+			span.Labels[k] = vv
+		}
+	}
+	return true
+}
+
+// get returns the cached labels of the value, looking them up in background
+// if missing or expired.
+func (e *enricher) get(value string) map[string]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	en, ok := e.entries[value]
+	if !ok {
+		if len(e.order) >= maxEnrichments {
+			delete(e.entries, e.order[0])
+			e.order[0] = ""
+			e.order = e.order[1:]
+		}
+		en = &enrichment{}
+		e.entries[value] = en
+		e.order = append(e.order, value)
+		e.refresh(value, en)
+	} else if !en.refreshing && now().After(en.expires) {
+		e.refresh(value, en)
+	}
+	return en.labels
+}
+
+// refresh looks up the labels of the value in background.
+// It's called with the mutex held.
+func (e *enricher) refresh(value string, en *enrichment) {
+	en.refreshing = true
+	go func() {
+		var labels map[string]string
+		var err error
+		defer func() {
+			panicked := recover() != nil
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			if !panicked && err == nil {
+				en.labels = labels
+			}
+			en.expires = now().Add(e.ttl)
+			en.refreshing = false
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.budget)
+		defer cancel()
+		labels, err = e.lookup(ctx, value)
+	}()
+}
@@ -0,0 +1,96 @@
+package gcloudtracer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variables read by NewRecorderFromEnv.
+const (
+	EnvProject          = "GCLOUD_TRACER_PROJECT"
+	EnvCredentials      = "GCLOUD_TRACER_CREDENTIALS"
+	EnvBundleDelay      = "GCLOUD_TRACER_BUNDLE_DELAY"
+	EnvBundleCount      = "GCLOUD_TRACER_BUNDLE_COUNT"
+	EnvBufferedLimit    = "GCLOUD_TRACER_BUFFERED_LIMIT"
+	EnvSamplingRate     = "GCLOUD_TRACER_SAMPLING_RATE"
+	EnvDebug            = "GCLOUD_TRACER_DEBUG"
+	envGoogleCredential = "GOOGLE_APPLICATION_CREDENTIALS"
+)
+
+// NewRecorderFromEnv creates new GCloud StackDriver recorder configured
+// with the GCLOUD_TRACER_* environment variables. The credentials path falls
+// back to GOOGLE_APPLICATION_CREDENTIALS. Options given explicitly take
+// precedence over the environment.
+func NewRecorderFromEnv(ctx context.Context, opts ...Option) (*Recorder, error) {
+	envOpts, err := OptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(ctx, append(envOpts, opts...)...)
+}
+
+// OptionsFromEnv returns options specified by the GCLOUD_TRACER_* environment variables.
+func OptionsFromEnv() ([]Option, error) {
+	var opts []Option
+
+	if v := os.Getenv(EnvProject); v != "" {
+		opts = append(opts, WithProject(v))
+	}
+
+	path := os.Getenv(EnvCredentials)
+	if path == "" {
+		path = os.Getenv(envGoogleCredential)
+	}
+	if path != "" {
+		credentials, err := LoadJWTCredentials(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credentials from %s: %s", path, err)
+		}
+		opts = append(opts, WithJWTCredentials(credentials))
+	}
+
+	if v := os.Getenv(EnvBundleDelay); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, envError(EnvBundleDelay, err)
+		}
+		opts = append(opts, WithBundleDelayThreshold(d))
+	}
+	if v := os.Getenv(EnvBundleCount); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, envError(EnvBundleCount, err)
+		}
+		opts = append(opts, WithBundleCountThreshold(n))
+	}
+	if v := os.Getenv(EnvBufferedLimit); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, envError(EnvBufferedLimit, err)
+		}
+		opts = append(opts, WithBufferedLimit(n))
+	}
+	if v := os.Getenv(EnvSamplingRate); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, envError(EnvSamplingRate, err)
+		}
+		opts = append(opts, WithSamplingRate(rate))
+	}
+	if v := os.Getenv(EnvDebug); v != "" {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, envError(EnvDebug, err)
+		}
+		opts = append(opts, WithDebug(debug))
+	}
+
+	return opts, nil
+}
+
+func envError(name string, err error) error {
+	return fmt.Errorf("invalid %s: %s", name, err)
+}
@@ -1,8 +1,56 @@
 package gcloudtracer
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrInvalidProjectID occurs if project identifier is invalid.
 	ErrInvalidProjectID = errors.New("invalid project id")
+	// ErrRecorderClosed occurs if the Recorder is used after it was closed.
+	ErrRecorderClosed = errors.New("recorder closed")
+	// ErrInvalidCredentials occurs if service account key is invalid.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrPermissionDenied occurs if credentials lack permission to upload traces.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrUploadFailed occurs if traces failed to upload, see UploadError.
+	ErrUploadFailed = errors.New("upload failed")
+	// ErrBufferFull occurs if a span is dropped because the buffer is full.
+	ErrBufferFull = errors.New("buffer full")
+	// ErrInvalidTraceID occurs if trace identifier is not 32 hexadecimal characters.
+	ErrInvalidTraceID = errors.New("invalid trace id")
+	// ErrTraceNotVisible occurs if an uploaded trace can't be read back, see WithExportVerification.
+	ErrTraceNotVisible = errors.New("uploaded trace not visible")
 )
+
+// UploadError occurs if traces failed to upload to the project.
+// It matches ErrUploadFailed and wraps the error of the Cloud Trace client,
+// usually a *googleapi.Error.
+type UploadError struct {
+	Project string
+	// Traces is a number of traces in the failed bundle.
+	Traces int
+	// FirstTraceID and LastTraceID identify the first and last trace of the bundle.
+	FirstTraceID string
+	LastTraceID  string
+	// Bytes approximates the size of the bundle.
+	Bytes int
+	// Attempts is a number of upload attempts made.
+	Attempts int
+	Err      error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("failed to upload %d traces to the Cloud Trace project %s. (err = %s)", e.Traces, e.Project, e.Err)
+}
+
+// Unwrap returns the error of the Cloud Trace client.
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrUploadFailed.
+func (e *UploadError) Is(target error) bool {
+	return target == ErrUploadFailed
+}
@@ -0,0 +1,50 @@
+package gcloudtracer
+
+import (
+	"strconv"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// DroppedEventsLabel holds the number of logs of a span dropped by the limit
+// of events, see WithMaxEvents.
+const DroppedEventsLabel = "events.dropped"
+
+// EventPolicy defines which logs of a span over the limit of events are kept.
+type EventPolicy int
+
+const (
+	// KeepFirstEvents keeps the first logs of the span.
+	KeepFirstEvents EventPolicy = iota
+	// KeepLastEvents keeps the last logs of the span, e.g. those leading
+	// to an error.
+	KeepLastEvents
+)
+
+// sampleEvents drops the logs of the span over the limit of events,
+// and returns the number of logs dropped.
+func (r *Recorder) sampleEvents(sp *RawSpan) int {
+	dropped := len(sp.Logs) - r.maxEvents
+	if r.maxEvents <= 0 || dropped <= 0 {
+		return 0
+	}
+	if r.eventPolicy == KeepLastEvents {
+		sp.Logs = sp.Logs[dropped:]
+	} else {
+		sp.Logs = sp.Logs[:r.maxEvents]
+	}
+	return dropped
+}
+
+// addDroppedEvents sets the number of dropped logs on the spans of the trace.
+func addDroppedEvents(trace *cloudtrace.Trace, dropped int) {
+	if dropped == 0 {
+		return
+	}
+	for _, s := range trace.Spans {
+		if s.Labels == nil {
+			s.Labels = make(map[string]string, 1)
+		}
+		s.Labels[DroppedEventsLabel] = strconv.Itoa(dropped)
+	}
+}
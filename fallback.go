@@ -0,0 +1,129 @@
+package gcloudtracer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// Exporter writes traces to a destination other than Cloud Trace.
+type Exporter interface {
+	Export(ctx context.Context, traces []*cloudtrace.Trace) error
+}
+
+// WriterExporter writes traces to the writer as JSON, one trace per line.
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterExporter creates new exporter writing traces to the writer,
+// e.g. a file or os.Stderr.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// Export implements Exporter interface.
+func (e *WriterExporter) Export(ctx context.Context, traces []*cloudtrace.Trace) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, t := range traces {
+		if err := e.enc.Encode(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fallback switches uploads to the exporter once Cloud Trace has been
+// unreachable for the duration, and back once uploads recover.
+type fallback struct {
+	exporter Exporter
+	after    time.Duration
+
+	mu           sync.Mutex
+	failingSince time.Time
+	active       bool
+	lastProbe    time.Time
+}
+
+// probe reports whether the upload should be tried with Cloud Trace.
+// While the fallback is active, Cloud Trace is tried once per duration.
+func (f *fallback) probe() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.active {
+		return true
+	}
+	if now := time.Now(); now.Sub(f.lastProbe) >= f.after {
+		f.lastProbe = now
+		return true
+	}
+	return false
+}
+
+// failed records the upload failed by an outage, see isRetryable, and reports
+// whether the fallback is active.
+func (f *fallback) failed() (active, switched bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.failingSince.IsZero() {
+		f.failingSince = now
+	}
+	if !f.active && now.Sub(f.failingSince) >= f.after {
+		f.active = true
+		f.lastProbe = now
+		switched = true
+	}
+	return f.active, switched
+}
+
+// succeeded records the successful upload and reports whether the fallback
+// was active until now.
+func (f *fallback) succeeded() (switched bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switched = f.active
+	f.active = false
+	f.failingSince = time.Time{}
+	return switched
+}
+
+// uploadWithFallback uploads the traces to Cloud Trace, or exports them with
+// the fallback exporter during outages, and reports which one it did.
+func (r *Recorder) uploadWithFallback(project string, write writeFunc, traces []*cloudtrace.Trace) (attempts int, exported bool, err error) {
+	f := r.fallback
+	if !f.probe() {
+		return 0, true, r.export(f.exporter, project, traces)
+	}
+
+	attempts, err = r.send(write, traces)
+	if err == nil {
+		if f.succeeded() {
+			r.log.Errorf("Cloud Trace uploads recovered, switching back from the fallback exporter")
+		}
+		return attempts, false, nil
+	}
+
+	// Errors of the request, e.g. permission denied, don't mean an outage.
+	if !isRetryable(err) {
+		return attempts, false, err
+	}
+	active, switched := f.failed()
+	if switched {
+		r.log.Errorf("Cloud Trace unreachable for %s, switching to the fallback exporter (err = %s)", f.after, err)
+	}
+	if !active {
+		return attempts, false, err
+	}
+	return attempts, true, r.export(f.exporter, project, traces)
+}
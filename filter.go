@@ -0,0 +1,16 @@
+package gcloudtracer
+
+// Filter reports whether the span should be uploaded.
+type Filter func(sp RawSpan) bool
+
+// IgnoreOperations returns a Filter dropping spans of the operations.
+func IgnoreOperations(names ...string) Filter {
+	ignored := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		ignored[n] = struct{}{}
+	}
+	return func(sp RawSpan) bool {
+		_, ok := ignored[sp.Operation]
+		return !ok
+	}
+}
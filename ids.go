@@ -0,0 +1,53 @@
+package gcloudtracer
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+)
+
+// IDGenerator generates identifiers of traces and spans, see WithIDGenerator.
+// It's called concurrently and should never return a zero identifier.
+type IDGenerator interface {
+	// TraceID returns the high and low 64 bits of a new trace identifier.
+	TraceID() (high, low uint64)
+	// SpanID returns a new span identifier.
+	SpanID() uint64
+}
+
+// randomIDGenerator generates random identifiers from a source seeded
+// by crypto/rand, so processes started together don't share identifiers.
+type randomIDGenerator struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newRandomIDGenerator() *randomIDGenerator {
+	var seed [8]byte
+	cryptorand.Read(seed[:])
+	return &randomIDGenerator{
+		rnd: rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:])))),
+	}
+}
+
+func (g *randomIDGenerator) TraceID() (high, low uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.next(), g.next()
+}
+
+func (g *randomIDGenerator) SpanID() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.next()
+}
+
+// next returns a non-zero random number, the caller holds the lock.
+func (g *randomIDGenerator) next() uint64 {
+	for {
+		if id := g.rnd.Uint64(); id != 0 {
+			return id
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package gcloudtracer
+
+import "strconv"
+
+// Labels repeated by most spans are interned, so converting a span
+// doesn't allocate new strings for them.
+var (
+	// smallInts holds labels of small integer tags, such as HTTP status codes.
+	// strconv.Itoa allocates for those of 100 and more, see BenchmarkIntern.
+	smallInts [1000]string
+	// eventKeys holds label keys of the first log records of a span.
+	eventKeys [32]string
+)
+
+func init() {
+	for i := range smallInts {
+		smallInts[i] = strconv.Itoa(i)
+	}
+	for i := range eventKeys {
+		eventKeys[i] = "event_" + smallInts[i]
+	}
+}
+
+// itoa returns the label of the integer tag.
+func itoa(v int) string {
+	if v >= 0 && v < len(smallInts) {
+		return smallInts[v]
+	}
+	return strconv.Itoa(v)
+}
+
+// eventKey returns the label key of the i-th log record.
+func eventKey(i int) string {
+	if i < len(eventKeys) {
+		return eventKeys[i]
+	}
+	return "event_" + strconv.Itoa(i)
+}
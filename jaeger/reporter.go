@@ -0,0 +1,64 @@
+// Package jaeger provides a jaeger-client-go Reporter which feeds Jaeger
+// spans into the gcloudtracer Recorder, so services instrumented with
+// jaeger-client can upload to Cloud Trace without running a collector.
+package jaeger
+
+import (
+	"context"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	jaegerclient "github.com/uber/jaeger-client-go"
+)
+
+var _ jaegerclient.Reporter = &Reporter{}
+
+// Reporter implements jaeger.Reporter interface
+// used to write Jaeger spans through a span recorder.
+type Reporter struct {
+	recorder gcloudtracer.SpanRecorder
+}
+
+// NewReporter creates new Jaeger reporter backed by the recorder,
+// usually a *gcloudtracer.Recorder.
+func NewReporter(recorder gcloudtracer.SpanRecorder) *Reporter {
+	return &Reporter{recorder: recorder}
+}
+
+// Report converts Jaeger span and passes it to the recorder.
+// The span isn't referenced afterwards, so it may be returned to its pool.
+func (r *Reporter) Report(span *jaegerclient.Span) {
+	r.recorder.RecordSpan(ConvertSpan(span))
+}
+
+// Close implements jaeger.Reporter interface.
+// It uploads spans buffered by the recorder, if it supports flushing.
+func (r *Reporter) Close() {
+	if f, ok := r.recorder.(flusher); ok {
+		f.Flush(context.Background())
+	}
+}
+
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// ConvertSpan converts Jaeger span into gcloudtracer.RawSpan.
+// Jaeger trace identifiers of 64 bits have zero high bits, and are
+// uploaded repeated the way the Tracer uploads its own.
+func ConvertSpan(span *jaegerclient.Span) gcloudtracer.RawSpan {
+	sc := span.SpanContext()
+	return gcloudtracer.RawSpan{
+		Context: gcloudtracer.SpanContext{
+			TraceIDHigh: sc.TraceID().High,
+			TraceID:     sc.TraceID().Low,
+			SpanID:      uint64(sc.SpanID()),
+			Sampled:     sc.IsSampled(),
+		},
+		ParentSpanID: uint64(sc.ParentID()),
+		Operation:    span.OperationName(),
+		Start:        span.StartTime(),
+		Duration:     span.Duration(),
+		Tags:         span.Tags(),
+		Logs:         span.Logs(),
+	}
+}
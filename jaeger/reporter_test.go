@@ -0,0 +1,61 @@
+package jaeger
+
+import (
+	"context"
+	"testing"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	jaegerclient "github.com/uber/jaeger-client-go"
+)
+
+type recorder struct {
+	spans   []gcloudtracer.RawSpan
+	flushes int
+}
+
+func (r *recorder) RecordSpan(sp gcloudtracer.RawSpan) {
+	r.spans = append(r.spans, sp)
+}
+
+func (r *recorder) Flush(ctx context.Context) error {
+	r.flushes++
+	return nil
+}
+
+func TestReporter(t *testing.T) {
+	for _, gen128Bit := range []bool{true, false} {
+		rec := &recorder{}
+		tracer, closer := jaegerclient.NewTracer("service", jaegerclient.NewConstSampler(true), NewReporter(rec),
+			jaegerclient.TracerOptions.Gen128Bit(gen128Bit))
+
+		root := tracer.StartSpan("root")
+		child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()), opentracing.Tag{Key: "http.path", Value: "/"})
+		child.Finish()
+		root.Finish()
+		closer.Close()
+
+		name := "trace_id=64bit"
+		if gen128Bit {
+			name = "trace_id=128bit"
+		}
+		t.Run(name, func(t *testing.T) {
+			sc := child.Context().(jaegerclient.SpanContext)
+			assert.Len(t, rec.spans, 2)
+			sp := rec.spans[0]
+			assert.Equal(t, sc.TraceID().High, sp.Context.TraceIDHigh)
+			assert.Equal(t, sc.TraceID().Low, sp.Context.TraceID)
+			assert.Equal(t, gen128Bit, sp.Context.TraceIDHigh != 0)
+			if gen128Bit {
+				assert.Equal(t, sc.TraceID().String(), sp.Context.TraceIDString())
+			}
+			assert.Equal(t, uint64(sc.SpanID()), sp.Context.SpanID)
+			assert.Equal(t, uint64(root.Context().(jaegerclient.SpanContext).SpanID()), sp.ParentSpanID)
+			assert.True(t, sp.Context.Sampled)
+			assert.Equal(t, "child", sp.Operation)
+			assert.Equal(t, "/", sp.Tags["http.path"])
+			assert.Equal(t, 1, rec.flushes)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package gcloudtracer
+
+import (
+	"context"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Tags of spans of background jobs, see StartJobSpan.
+const (
+	JobQueueTag   = "job.queue"
+	JobAttemptTag = "job.attempt"
+	// JobQueueLatencyTag holds the time the job waited since it was enqueued.
+	JobQueueLatencyTag = "job.queue_latency"
+)
+
+// JobEnqueuedAtField is the field of the time a job was enqueued, set by
+// InjectJob along with the span context.
+const JobEnqueuedAtField = "job-enqueued-at"
+
+// JobOption configures the span of a job started with StartJobSpan.
+type JobOption func(o *jobOptions)
+
+type jobOptions struct {
+	queue      string
+	attempt    int
+	enqueuedAt time.Time
+	parent     opentracing.SpanContext
+	opts       []opentracing.StartSpanOption
+}
+
+// JobQueue returns a JobOption that tags the span with the queue of the job.
+func JobQueue(name string) JobOption {
+	return func(o *jobOptions) {
+		o.queue = name
+	}
+}
+
+// JobAttempt returns a JobOption that tags the span with the attempt
+// of the job, starting with 1.
+func JobAttempt(n int) JobOption {
+	return func(o *jobOptions) {
+		o.attempt = n
+	}
+}
+
+// JobEnqueuedAt returns a JobOption that tags the span with the time
+// the job waited in the queue since the time.
+func JobEnqueuedAt(t time.Time) JobOption {
+	return func(o *jobOptions) {
+		o.enqueuedAt = t
+	}
+}
+
+// JobFollowsFrom returns a JobOption that continues the trace of the span
+// enqueuing the job, instead of the span of the context.
+func JobFollowsFrom(sc opentracing.SpanContext) JobOption {
+	return func(o *jobOptions) {
+		o.parent = sc
+	}
+}
+
+// JobSpanOptions returns a JobOption that starts the span with the options.
+func JobSpanOptions(opts ...opentracing.StartSpanOption) JobOption {
+	return func(o *jobOptions) {
+		o.opts = append(o.opts, opts...)
+	}
+}
+
+// StartJobSpan starts a consumer span of the job with the global tracer,
+// a child of the span of the context unless JobFollowsFrom is set, and
+// returns the context with the span. Like StartSpanFromContext, the span is
+// recorded with the overrides held by the context if any.
+func StartJobSpan(ctx context.Context, name string, opts ...JobOption) (opentracing.Span, context.Context) {
+	var o jobOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	start := time.Now()
+	tags := opentracing.Tags{string(ext.SpanKind): ext.SpanKindConsumerEnum}
+	if o.queue != "" {
+		tags[JobQueueTag] = o.queue
+	}
+	if o.attempt > 0 {
+		tags[JobAttemptTag] = o.attempt
+	}
+	if !o.enqueuedAt.IsZero() {
+		latency := start.Sub(o.enqueuedAt)
+		// The clocks of the producer and the consumer may be skewed.
+		if latency < 0 {
+			latency = 0
+		}
+		tags[JobQueueLatencyTag] = latency.String()
+	}
+
+	sso := []opentracing.StartSpanOption{opentracing.StartTime(start), tags}
+	if o.parent != nil {
+		sso = append(sso, opentracing.FollowsFrom(o.parent))
+	} else if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		sso = append(sso, opentracing.ChildOf(parent.Context()))
+	}
+	if ov, ok := ctx.Value(overridesKey{}).(*Overrides); ok {
+		sso = append(sso, opentracing.Tag{Key: overridesTag, Value: ov})
+	}
+	sp := opentracing.GlobalTracer().StartSpan(name, append(sso, o.opts...)...)
+	return sp, opentracing.ContextWithSpan(ctx, sp)
+}
+
+// InjectJob injects the span context enqueuing a job and the current time
+// into the carrier of the job, e.g. message attributes.
+func InjectJob(tracer opentracing.Tracer, sc opentracing.SpanContext, carrier opentracing.TextMapWriter) error {
+	if err := tracer.Inject(sc, opentracing.TextMap, carrier); err != nil {
+		return err
+	}
+	carrier.Set(JobEnqueuedAtField, formatTimestamp(time.Now()))
+	return nil
+}
+
+// ExtractJob returns the options of the span of the job from the carrier
+// injected by InjectJob, they're empty if the carrier has neither the span
+// context nor the time.
+func ExtractJob(tracer opentracing.Tracer, carrier opentracing.TextMapReader) []JobOption {
+	var opts []JobOption
+	if sc, err := tracer.Extract(opentracing.TextMap, carrier); err == nil {
+		opts = append(opts, JobFollowsFrom(sc))
+	}
+	carrier.ForeachKey(func(k, v string) error {
+		if k == JobEnqueuedAtField {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				opts = append(opts, JobEnqueuedAt(t))
+			}
+		}
+		return nil
+	})
+	return opts
+}
@@ -0,0 +1,74 @@
+package gcloudtracer
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// LatencyBucketLabel holds the latency bucket of a span, see WithLatencyBuckets.
+const LatencyBucketLabel = "latency.bucket"
+
+// DefaultLatencyBuckets are the upper bounds of latency buckets labeled
+// by WithLatencyBuckets if none are given.
+var DefaultLatencyBuckets = []time.Duration{10 * time.Millisecond, 100 * time.Millisecond, time.Second}
+
+// latencyBuckets labels spans with the bucket of their duration.
+type latencyBuckets struct {
+	bounds []time.Duration
+	names  []string
+}
+
+func newLatencyBuckets(bounds []time.Duration) *latencyBuckets {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	bounds = append([]time.Duration(nil), bounds...)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	names := make([]string, 0, len(bounds)+1)
+	names = append(names, "lt_"+formatBound(bounds[0]))
+	for i := 1; i < len(bounds); i++ {
+		lower, upper := formatBound(bounds[i-1]), formatBound(bounds[i])
+		// "10_100ms" rather than "10ms_100ms" if the unit is the same.
+		if unit := strings.TrimLeft(upper, "0123456789"); strings.TrimLeft(lower, "0123456789") == unit {
+			lower = strings.TrimSuffix(lower, unit)
+		}
+		names = append(names, lower+"_"+upper)
+	}
+	names = append(names, "gt_"+formatBound(bounds[len(bounds)-1]))
+	return &latencyBuckets{bounds: bounds, names: names}
+}
+
+// formatBound formats the bound with the largest whole unit, e.g. "100ms".
+func formatBound(d time.Duration) string {
+	for _, u := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}, {time.Millisecond, "ms"}, {time.Microsecond, "us"}} {
+		if d >= u.d && d%u.d == 0 {
+			return strconv.FormatInt(int64(d/u.d), 10) + u.name
+		}
+	}
+	return strconv.FormatInt(int64(d), 10) + "ns"
+}
+
+// bucket returns the name of the bucket of the duration.
+func (b *latencyBuckets) bucket(d time.Duration) string {
+	return b.names[sort.Search(len(b.bounds), func(i int) bool { return d < b.bounds[i] })]
+}
+
+// label sets the latency bucket label of the spans of the trace converted
+// from a span of the duration.
+func (b *latencyBuckets) label(trace *cloudtrace.Trace, d time.Duration) {
+	name := b.bucket(d)
+	for _, s := range trace.Spans {
+		if s.Labels == nil {
+			s.Labels = make(map[string]string, 1)
+		}
+		s.Labels[LatencyBucketLabel] = name
+	}
+}
@@ -0,0 +1,194 @@
+package gcloudtracer
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// traceCountWindow is how long span counts of a trace are remembered at least.
+const traceCountWindow = time.Minute
+
+// traceCounter counts spans per trace. Counts are kept in two generations
+// rotated every window, so memory is bounded by traces recently seen.
+type traceCounter struct {
+	mu       sync.Mutex
+	window   time.Duration
+	rotated  time.Time
+	current  map[uint64]int
+	previous map[uint64]int
+}
+
+func newTraceCounter(window time.Duration) *traceCounter {
+	return &traceCounter{
+		window:  window,
+		rotated: time.Now(),
+		current: make(map[uint64]int),
+	}
+}
+
+// inc counts a span of the trace and returns the number of its spans counted.
+func (c *traceCounter) inc(traceID uint64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now := time.Now(); now.Sub(c.rotated) >= c.window {
+		c.previous, c.current = c.current, make(map[uint64]int, len(c.current))
+		c.rotated = now
+	}
+
+	n, ok := c.current[traceID]
+	if !ok {
+		n = c.previous[traceID]
+	}
+	n++
+	c.current[traceID] = n
+	return n
+}
+
+// count returns the number of spans of the trace counted.
+func (c *traceCounter) count(traceID uint64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n, ok := c.current[traceID]; ok {
+		return n
+	}
+	return c.previous[traceID]
+}
+
+// spanLimiter limits the number of spans recorded per trace, see
+// WithMaxSpansPerTrace. Spans are counted per trace along with the parents
+// of spans recorded, in two generations rotated every window.
+type spanLimiter struct {
+	max int
+
+	mu       sync.Mutex
+	window   time.Duration
+	rotated  time.Time
+	current  map[uint64]*traceSpans
+	previous map[uint64]*traceSpans
+}
+
+// traceSpans counts spans of a trace and holds the parents referenced.
+type traceSpans struct {
+	count   int
+	parents map[uint64]struct{}
+}
+
+func newSpanLimiter(max int, window time.Duration) *spanLimiter {
+	return &spanLimiter{
+		max:     max,
+		window:  window,
+		rotated: time.Now(),
+		current: make(map[uint64]*traceSpans),
+	}
+}
+
+// allow counts the span of the trace and reports whether it's within
+// the limit. Root spans and parents of spans recorded before are always
+// allowed, as they finish after their children and hold the trace together,
+// so the newest leaves are dropped over the limit.
+func (l *spanLimiter) allow(traceID, spanID, parentID uint64) bool {
+	if parentID == 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now := time.Now(); now.Sub(l.rotated) >= l.window {
+		l.previous, l.current = l.current, make(map[uint64]*traceSpans, len(l.current))
+		l.rotated = now
+	}
+
+	ts, ok := l.current[traceID]
+	if !ok {
+		if ts, ok = l.previous[traceID]; !ok {
+			ts = &traceSpans{parents: make(map[uint64]struct{})}
+		}
+		l.current[traceID] = ts
+	}
+	ts.parents[parentID] = struct{}{}
+	ts.count++
+	if _, ok := ts.parents[spanID]; ok {
+		return true
+	}
+	return ts.count <= l.max
+}
+
+const (
+	// OtherOperation is the name of spans whose operations are over
+	// the limit of operation names, see WithMaxOperationNames.
+	OtherOperation = "other"
+	// OperationLabel holds the operation of spans named OtherOperation.
+	OperationLabel = "operation"
+)
+
+// nameGuard bounds the number of distinct operation names.
+type nameGuard struct {
+	limit  int
+	warned sync.Once
+
+	mu    sync.RWMutex
+	names map[string]struct{}
+}
+
+func newNameGuard(limit int) *nameGuard {
+	return &nameGuard{limit: limit, names: make(map[string]struct{}, limit)}
+}
+
+// allow reports whether the operation name is within the limit, adding it
+// to the names seen unless the limit is reached.
+func (g *nameGuard) allow(name string) bool {
+	g.mu.RLock()
+	_, ok := g.names[name]
+	full := len(g.names) >= g.limit
+	g.mu.RUnlock()
+	if ok || full {
+		return ok
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.names[name]; ok {
+		return true
+	}
+	if len(g.names) >= g.limit {
+		return false
+	}
+	g.names[name] = struct{}{}
+	return true
+}
+
+// bucketOperations names spans of the trace over the limit of operation
+// names OtherOperation, prefixed with the operation prefix if any, keeping
+// their operations as OperationLabel.
+func (r *Recorder) bucketOperations(trace *cloudtrace.Trace) {
+	for _, s := range trace.Spans {
+		if r.names.allow(s.Name) {
+			continue
+		}
+		r.names.warned.Do(func() {
+			r.log.Errorf("more than %d operation names. spans of new operations are named %q", r.names.limit, OtherOperation)
+		})
+		if s.Labels == nil {
+			s.Labels = make(map[string]string, 1)
+		}
+		s.Labels[OperationLabel] = s.Name
+		s.Name = r.prefix + OtherOperation
+		atomic.AddUint64(&r.stats.bucketed, 1)
+	}
+}
+
+// prefixOperations prefixes names of the spans of the trace with the prefix,
+// unless they're prefixed already.
+func prefixOperations(trace *cloudtrace.Trace, prefix string) {
+	for _, s := range trace.Spans {
+		if !strings.HasPrefix(s.Name, prefix) {
+			s.Name = prefix + s.Name
+		}
+	}
+}
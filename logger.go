@@ -8,7 +8,24 @@ func (defaultLogger) Errorf(msg string, args ...interface{}) {
 	log.Printf(msg, args...)
 }
 
+func (defaultLogger) Debugf(msg string, args ...interface{}) {
+	log.Printf(msg, args...)
+}
+
 // Logger defines an interface to log an error.
 type Logger interface {
 	Errorf(string, ...interface{})
 }
+
+// DebugLogger defines an interface to log a debug message.
+// A Logger implementing it receives debug messages if WithDebug is enabled.
+type DebugLogger interface {
+	Debugf(string, ...interface{})
+}
+
+// FieldLogger defines an interface to log an error with structured fields.
+// A Logger implementing it receives upload errors with the bundle metadata
+// as fields, instead of formatted into the message.
+type FieldLogger interface {
+	ErrorWithFields(msg string, fields map[string]interface{})
+}
@@ -0,0 +1,153 @@
+package gcloudtracer
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
+)
+
+// RecorderManager lazily creates and caches Recorders per project identifier.
+// All the recorders share credentials, logger, Cloud Trace clients and
+// the bundler given to the manager, or created with its bundler options,
+// see NewSharedBundler.
+type RecorderManager struct {
+	ctx  context.Context
+	opts []Option
+
+	newClient   func() (*cloudtrace.Service, error)
+	newClientV2 func() (*cloudtracev2.Service, error)
+
+	mu        sync.Mutex
+	recorders map[string]*Recorder
+	// bundler is created by the manager unless set by WithSharedBundler.
+	bundler *SharedBundler
+	shared  bool
+}
+
+// NewRecorderManager creates new manager of recorders created with the options.
+// A project specified by WithProject is overridden per recorder.
+func NewRecorderManager(ctx context.Context, opts ...Option) *RecorderManager {
+	options := defaultOptions()
+	for _, o := range opts {
+		o(&options)
+	}
+	return &RecorderManager{
+		ctx:         ctx,
+		opts:        opts,
+		newClient:   sharedClient(clientFactory(ctx, &options)),
+		newClientV2: sharedClientV2(clientFactoryV2(ctx, &options)),
+		recorders:   make(map[string]*Recorder),
+		bundler:     options.shared,
+		shared:      options.shared != nil,
+	}
+}
+
+// Recorder returns the recorder of the project, creating it on first use.
+func (m *RecorderManager) Recorder(projectID string) (*Recorder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rec, ok := m.recorders[projectID]; ok {
+		return rec, nil
+	}
+
+	if m.bundler == nil {
+		m.bundler = NewSharedBundler(m.opts...)
+	}
+	opts := append(append([]Option(nil), m.opts...),
+		WithProject(projectID),
+		WithSharedBundler(m.bundler),
+		withClients(m.newClient, m.newClientV2),
+	)
+	rec, err := NewRecorder(m.ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.recorders[projectID] = rec
+
+	return rec, nil
+}
+
+// Shutdown shuts down all the recorders created by the manager, and closes
+// the bundler unless given with WithSharedBundler. It returns the errors
+// of all the recorders joined. Recorders are created again if requested
+// afterwards.
+func (m *RecorderManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	recorders := m.recorders
+	m.recorders = make(map[string]*Recorder)
+	bundler := m.bundler
+	if !m.shared {
+		m.bundler = nil
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, rec := range recorders {
+		if err := rec.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if bundler != nil {
+		if m.shared {
+			bundler.Flush()
+		} else {
+			bundler.Close()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close implements io.Closer interface, it shuts down all the recorders.
+func (m *RecorderManager) Close() error {
+	return m.Shutdown(context.Background())
+}
+
+// withClients returns an Option that makes the Recorder create its Cloud Trace
+// clients with the functions, so they're shared by recorders of the manager.
+func withClients(newClient func() (*cloudtrace.Service, error), newClientV2 func() (*cloudtracev2.Service, error)) Option {
+	return func(o *Options) {
+		o.newClient = newClient
+		o.newClientV2 = newClientV2
+	}
+}
+
+// sharedClient returns a function creating the client on first use and
+// returning it afterwards. Creation is attempted again if it fails.
+func sharedClient(newClient func() (*cloudtrace.Service, error)) func() (*cloudtrace.Service, error) {
+	var (
+		mu sync.Mutex
+		c  *cloudtrace.Service
+	)
+	return func() (*cloudtrace.Service, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if c != nil {
+			return c, nil
+		}
+		var err error
+		c, err = newClient()
+		return c, err
+	}
+}
+
+// sharedClientV2 is sharedClient of the v2 client.
+func sharedClientV2(newClient func() (*cloudtracev2.Service, error)) func() (*cloudtracev2.Service, error) {
+	var (
+		mu sync.Mutex
+		c  *cloudtracev2.Service
+	)
+	return func() (*cloudtracev2.Service, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if c != nil {
+			return c, nil
+		}
+		var err error
+		c, err = newClient()
+		return c, err
+	}
+}
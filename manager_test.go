@@ -0,0 +1,90 @@
+package gcloudtracer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/option"
+)
+
+func TestRecorderManager(t *testing.T) {
+	var mu sync.Mutex
+	projects := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		projects[strings.Split(r.URL.Path, "/")[3]] += len(req.Traces)
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	m := NewRecorderManager(context.Background(),
+		WithClientOption(clientOpt),
+		WithClientOption(option.WithEndpoint(srv.URL)),
+	)
+	a, err := m.Recorder("project_a")
+	assert.NoError(t, err)
+	b, err := m.Recorder("project_b")
+	assert.NoError(t, err)
+
+	t.Run("recorder=cached", func(t *testing.T) {
+		rec, err := m.Recorder("project_a")
+		assert.NoError(t, err)
+		assert.True(t, rec == a)
+	})
+
+	t.Run("shared=client", func(t *testing.T) {
+		ca, err := a.client()
+		assert.NoError(t, err)
+		cb, err := b.client()
+		assert.NoError(t, err)
+		assert.True(t, ca == cb)
+	})
+
+	t.Run("shared=bundler", func(t *testing.T) {
+		assert.NotNil(t, a.shared)
+		assert.True(t, a.shared == b.shared)
+	})
+
+	a.RecordSpan(testSpan(1, 1))
+	b.RecordSpan(testSpan(2, 1))
+	b.RecordSpan(testSpan(3, 1))
+
+	t.Run("shutdown=all", func(t *testing.T) {
+		assert.NoError(t, m.Shutdown(context.Background()))
+		assert.Equal(t, map[string]int{"project_a": 1, "project_b": 2}, projects)
+		assert.Equal(t, ErrRecorderClosed, a.Flush(context.Background()))
+		assert.Equal(t, ErrRecorderClosed, b.Flush(context.Background()))
+
+		rec, err := m.Recorder("project_a")
+		assert.NoError(t, err)
+		assert.False(t, rec == a)
+		assert.NoError(t, m.Close())
+	})
+
+	t.Run("shutdown=errors", func(t *testing.T) {
+		a, err := m.Recorder("project_a")
+		assert.NoError(t, err)
+		b, err := m.Recorder("project_b")
+		assert.NoError(t, err)
+		c, err := m.Recorder("project_c")
+		assert.NoError(t, err)
+		assert.NoError(t, a.Close())
+		assert.NoError(t, b.Close())
+
+		err = m.Shutdown(context.Background())
+		assert.True(t, errors.Is(err, ErrRecorderClosed))
+		assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+		assert.Equal(t, ErrRecorderClosed, c.Flush(context.Background()))
+	})
+}
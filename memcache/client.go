@@ -0,0 +1,145 @@
+// Package memcache provides a gomemcache client wrapper tracing operations
+// as client spans with an opentracing.Tracer, usually a *gcloudtracer.Tracer.
+// Operations are traced without their keys or values, which may hold
+// user data.
+package memcache
+
+import (
+	"context"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Tags of spans of memcache operations.
+const (
+	KeysTag = "memcache.keys"
+	HitsTag = "memcache.hits"
+)
+
+// Client wraps memcache.Client tracing its operations in the context.
+type Client struct {
+	client *memcache.Client
+	tracer opentracing.Tracer
+}
+
+// NewClient creates new client wrapping the memcache client.
+func NewClient(tracer opentracing.Tracer, client *memcache.Client) *Client {
+	return &Client{client: client, tracer: tracer}
+}
+
+// Unwrap returns the wrapped memcache client.
+func (c *Client) Unwrap() *memcache.Client {
+	return c.client
+}
+
+// Get gets the item of the key, see memcache.Client.Get.
+func (c *Client) Get(ctx context.Context, key string) (*memcache.Item, error) {
+	sp := c.startSpan(ctx, "get")
+	defer sp.Finish()
+	item, err := c.client.Get(key)
+	sp.SetTag(HitsTag, hits(err == nil))
+	setError(sp, err)
+	return item, err
+}
+
+// GetMulti gets the items of the keys, see memcache.Client.GetMulti.
+func (c *Client) GetMulti(ctx context.Context, keys []string) (map[string]*memcache.Item, error) {
+	sp := c.startSpan(ctx, "get_multi")
+	defer sp.Finish()
+	sp.SetTag(KeysTag, len(keys))
+	items, err := c.client.GetMulti(keys)
+	sp.SetTag(HitsTag, len(items))
+	setError(sp, err)
+	return items, err
+}
+
+// Set sets the item, see memcache.Client.Set.
+func (c *Client) Set(ctx context.Context, item *memcache.Item) error {
+	return c.do(ctx, "set", func() error { return c.client.Set(item) })
+}
+
+// Add adds the item, see memcache.Client.Add.
+func (c *Client) Add(ctx context.Context, item *memcache.Item) error {
+	return c.do(ctx, "add", func() error { return c.client.Add(item) })
+}
+
+// Replace replaces the item, see memcache.Client.Replace.
+func (c *Client) Replace(ctx context.Context, item *memcache.Item) error {
+	return c.do(ctx, "replace", func() error { return c.client.Replace(item) })
+}
+
+// CompareAndSwap swaps the item, see memcache.Client.CompareAndSwap.
+func (c *Client) CompareAndSwap(ctx context.Context, item *memcache.Item) error {
+	return c.do(ctx, "cas", func() error { return c.client.CompareAndSwap(item) })
+}
+
+// Delete deletes the item of the key, see memcache.Client.Delete.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, "delete", func() error { return c.client.Delete(key) })
+}
+
+// Touch updates the expiry of the key, see memcache.Client.Touch.
+func (c *Client) Touch(ctx context.Context, key string, seconds int32) error {
+	return c.do(ctx, "touch", func() error { return c.client.Touch(key, seconds) })
+}
+
+// Increment increments the value of the key, see memcache.Client.Increment.
+func (c *Client) Increment(ctx context.Context, key string, delta uint64) (uint64, error) {
+	var v uint64
+	err := c.do(ctx, "incr", func() (err error) {
+		v, err = c.client.Increment(key, delta)
+		return err
+	})
+	return v, err
+}
+
+// Decrement decrements the value of the key, see memcache.Client.Decrement.
+func (c *Client) Decrement(ctx context.Context, key string, delta uint64) (uint64, error) {
+	var v uint64
+	err := c.do(ctx, "decr", func() (err error) {
+		v, err = c.client.Decrement(key, delta)
+		return err
+	})
+	return v, err
+}
+
+func (c *Client) do(ctx context.Context, command string, f func() error) error {
+	sp := c.startSpan(ctx, command)
+	defer sp.Finish()
+	err := f()
+	setError(sp, err)
+	return err
+}
+
+func (c *Client) startSpan(ctx context.Context, command string) opentracing.Span {
+	var opts []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	sp := c.tracer.StartSpan("memcache "+command, append(opts, ext.SpanKindRPCClient)...)
+	ext.Component.Set(sp, "gomemcache")
+	ext.DBType.Set(sp, "memcache")
+	ext.PeerService.Set(sp, "memcache")
+	ext.DBStatement.Set(sp, command)
+	return sp
+}
+
+func hits(hit bool) int {
+	if hit {
+		return 1
+	}
+	return 0
+}
+
+// setError tags the span as an error unless the key was just missing,
+// or the item wasn't stored because of its state.
+func setError(sp opentracing.Span, err error) {
+	switch err {
+	case nil, memcache.ErrCacheMiss, memcache.ErrNotStored, memcache.ErrCASConflict:
+		return
+	}
+	ext.Error.Set(sp, true)
+	sp.SetTag("error.message", err.Error())
+}
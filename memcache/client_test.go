@@ -0,0 +1,129 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve runs a memcache server holding the items of the text protocol
+// commands get, gets and set.
+func serve(t *testing.T, items map[string]string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+				for {
+					line, err := rw.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch fields[0] {
+					case "get", "gets":
+						for _, key := range fields[1:] {
+							if v, ok := items[key]; ok {
+								fmt.Fprintf(rw, "VALUE %s 0 %d 1\r\n%s\r\n", key, len(v), v)
+							}
+						}
+						fmt.Fprint(rw, "END\r\n")
+					case "set":
+						rw.ReadString('\n')
+						fmt.Fprint(rw, "STORED\r\n")
+					default:
+						fmt.Fprint(rw, "SERVER_ERROR unsupported\r\n")
+					}
+					rw.Flush()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	addr := serve(t, map[string]string{"user:1": "ada", "user:2": "bob"})
+	tracer := mocktracer.New()
+	client := NewClient(tracer, memcache.New(addr))
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	t.Run("get=hit", func(t *testing.T) {
+		tracer.Reset()
+		item, err := client.Get(ctx, "user:1")
+		assert.NoError(t, err)
+		assert.Equal(t, "ada", string(item.Value))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "memcache get", sp.OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, sp.ParentID)
+		assert.Equal(t, "get", sp.Tags()["db.statement"])
+		assert.Equal(t, 1, sp.Tags()[HitsTag])
+	})
+
+	t.Run("get=miss", func(t *testing.T) {
+		tracer.Reset()
+		_, err := client.Get(ctx, "user:3")
+		assert.Equal(t, memcache.ErrCacheMiss, err)
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, 0, sp.Tags()[HitsTag])
+		assert.Nil(t, sp.Tags()["error"])
+	})
+
+	t.Run("get_multi", func(t *testing.T) {
+		tracer.Reset()
+		items, err := client.GetMulti(ctx, []string{"user:1", "user:2", "user:3"})
+		assert.NoError(t, err)
+		assert.Len(t, items, 2)
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "memcache get_multi", sp.OperationName)
+		assert.Equal(t, 3, sp.Tags()[KeysTag])
+		assert.Equal(t, 2, sp.Tags()[HitsTag])
+	})
+
+	t.Run("set", func(t *testing.T) {
+		tracer.Reset()
+		assert.NoError(t, client.Set(ctx, &memcache.Item{Key: "user:3", Value: []byte("eve")}))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "memcache set", sp.OperationName)
+		assert.Nil(t, sp.Tags()["error"])
+	})
+
+	t.Run("delete=error", func(t *testing.T) {
+		tracer.Reset()
+		assert.Error(t, client.Delete(ctx, "user:1"))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "memcache delete", sp.OperationName)
+		assert.Equal(t, true, sp.Tags()["error"])
+		assert.NotEmpty(t, sp.Tags()["error.message"])
+	})
+
+	t.Run("parent=none", func(t *testing.T) {
+		tracer.Reset()
+		client.Get(context.Background(), "user:1")
+
+		assert.Equal(t, 0, tracer.FinishedSpans()[0].ParentID)
+	})
+}
@@ -0,0 +1,52 @@
+package gcloudtracer
+
+import (
+	"sync/atomic"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// spanOverhead approximates memory used by a span besides its strings.
+const spanOverhead = 128
+
+// EvictionPolicy defines how spans recorded above the memory limit are handled.
+type EvictionPolicy int
+
+const (
+	// EvictDrop drops spans recorded above the memory limit.
+	EvictDrop EvictionPolicy = iota
+	// EvictUpload uploads spans recorded above the memory limit immediately
+	// in background, without buffering them.
+	EvictUpload
+	// EvictOldest drops the oldest buffered spans to make room for spans
+	// recorded above the memory limit, or above the buffered limit.
+	EvictOldest
+)
+
+// PendingBytes returns approximate number of bytes held by buffered spans.
+// It includes spans of other recorders if the bundler is shared.
+func (r *Recorder) PendingBytes() int64 {
+	var n int64
+	for _, tb := range r.traceBundlers() {
+		n += atomic.LoadInt64(&tb.pendingBytes)
+	}
+	return n
+}
+
+// traceSize approximates number of bytes held by the trace.
+func traceSize(t *cloudtrace.Trace) int {
+	size := len(t.ProjectId) + len(t.TraceId)
+	for _, s := range t.Spans {
+		size += spanSize(s)
+	}
+	return size
+}
+
+// spanSize approximates number of bytes held by the span.
+func spanSize(s *cloudtrace.TraceSpan) int {
+	size := spanOverhead + len(s.Name) + len(s.Kind) + len(s.StartTime) + len(s.EndTime)
+	for k, v := range s.Labels {
+		size += len(k) + len(v)
+	}
+	return size
+}
@@ -0,0 +1,125 @@
+package gcloudtracer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// LabelMergePolicy defines how labels of a span colliding on the same key
+// are merged, see WithLabelMergePolicy. Labels collide when a tag transposed
+// into a Cloud Trace label, e.g. http.url, is set along with the native label,
+// e.g. trace.cloud.google.com/http/url, or when a tag has the key of a default
+// label.
+type LabelMergePolicy int
+
+const (
+	// MergeUserWins keeps the value of the transposed tag, or of the tag
+	// over the default label.
+	MergeUserWins LabelMergePolicy = iota
+	// MergeNativeWins keeps the value of the native label, or of the default
+	// label over the tag.
+	MergeNativeWins
+	// MergeCombine joins distinct values with the separator, the value of
+	// the native or default label first.
+	MergeCombine
+)
+
+// defaultMergeSeparator joins values combined by MergeCombine if
+// the separator isn't set.
+const defaultMergeSeparator = ","
+
+// labelMerge merges colliding labels with the policy, and joins values
+// of the multi-value keys, see WithMultiValueLabels.
+type labelMerge struct {
+	policy    LabelMergePolicy
+	separator string
+
+	multi          map[string]bool
+	multiSeparator string
+}
+
+// merge returns the value of the label set both by the native or default
+// label and by the user tag.
+func (m labelMerge) merge(native, user string) string {
+	switch m.policy {
+	case MergeNativeWins:
+		return native
+	case MergeCombine:
+		if native == user {
+			return native
+		}
+		sep := m.separator
+		if sep == "" {
+			sep = defaultMergeSeparator
+		}
+		return native + sep + user
+	default:
+		return user
+	}
+}
+
+// multiSep returns the separator of values of multi-value keys.
+func (m labelMerge) multiSep() string {
+	if m.multiSeparator == "" {
+		return defaultMergeSeparator
+	}
+	return m.multiSeparator
+}
+
+// joinTag returns the value of the multi-value tag set again with the value,
+// the values joined if both are uploaded as labels.
+func (m labelMerge) joinTag(key string, prev, value interface{}) interface{} {
+	if !m.multi[key] {
+		return value
+	}
+	p, ok := formatTag(prev)
+	if !ok {
+		return value
+	}
+	v, ok := formatTag(value)
+	if !ok {
+		return value
+	}
+	return p + m.multiSep() + v
+}
+
+// joinLogs sets the labels of multi-value keys logged as fields to their
+// values joined in order, followed by the tag unless it's the last value.
+func (m labelMerge) joinLogs(labels map[string]string, logs []opentracing.LogRecord) {
+	if len(m.multi) == 0 {
+		return
+	}
+	var logged map[string][]string
+	for _, l := range logs {
+		for _, f := range l.Fields {
+			if m.multi[f.Key()] {
+				if logged == nil {
+					logged = make(map[string][]string, len(m.multi))
+				}
+				logged[f.Key()] = append(logged[f.Key()], fmt.Sprint(f.Value()))
+			}
+		}
+	}
+	for k, values := range logged {
+		if tag, ok := labels[k]; ok && tag != values[len(values)-1] {
+			values = append(values, tag)
+		}
+		labels[k] = strings.Join(values, m.multiSep())
+	}
+}
+
+// formatTag formats the value of a tag the way it's uploaded as a label.
+func formatTag(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case int:
+		return itoa(v), true
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,175 @@
+package gcloudtracer
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// MetricPrefix is the prefix of types of the Cloud Monitoring custom metrics
+// written by the Recorder, see WithCloudMonitoring.
+const MetricPrefix = "custom.googleapis.com/gcloudtracer/"
+
+// Types of the Cloud Monitoring custom metrics.
+const (
+	// ExportedSpansMetric is a cumulative number of spans uploaded successfully.
+	ExportedSpansMetric = MetricPrefix + "exported_spans"
+	// DroppedSpansMetric is a cumulative number of spans dropped, with
+	// the reason label, see Stats.Drops.
+	DroppedSpansMetric = MetricPrefix + "dropped_spans"
+	// UploadErrorRateMetric is the ratio of failed uploads in the interval.
+	UploadErrorRateMetric = MetricPrefix + "upload_error_rate"
+)
+
+// metricsWriter writes health metrics of the Recorder to Cloud Monitoring.
+type metricsWriter struct {
+	interval  time.Duration
+	newClient func() (*monitoring.Service, error)
+	client    *monitoring.Service
+	start     time.Time
+	instance  string
+	last      Stats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newMetricsWriter(ctx context.Context, o *Options) *metricsWriter {
+	opts := append(credentialOptions(o), o.monitoringOptions...)
+	return &metricsWriter{
+		interval: o.monitoringInterval,
+		newClient: func() (*monitoring.Service, error) {
+			return monitoring.NewService(ctx, opts...)
+		},
+		start:    now(),
+		instance: metricsInstance(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// metricsInstance returns the instance label of the metrics, stable across
+// restarts: the host name, e.g. the pod name on GKE, or the instance
+// identifier on Cloud Run and GCE if the host name is unknown.
+func metricsInstance() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	if metadata.OnGCE() {
+		if id, err := metadata.InstanceID(); err == nil {
+			return id
+		}
+	}
+	return "unknown"
+}
+
+// timeSeries returns the time series of the stats at the time, the error
+// rate is of uploads since the last stats.
+func (m *metricsWriter) timeSeries(project string, stats Stats, end time.Time) []*monitoring.TimeSeries {
+	var rate float64
+	failures := stats.UploadFailures - m.last.UploadFailures
+	if uploads := stats.Uploads - m.last.Uploads + failures; uploads > 0 {
+		rate = float64(failures) / float64(uploads)
+	}
+	exported := int64(stats.UploadedSpans)
+
+	resource := &monitoring.MonitoredResource{
+		Type:   "global",
+		Labels: map[string]string{"project_id": project},
+	}
+	labels := map[string]string{"instance": m.instance}
+	cumulative := &monitoring.TimeInterval{StartTime: formatTimestamp(m.start), EndTime: formatTimestamp(end)}
+	gauge := &monitoring.TimeInterval{EndTime: formatTimestamp(end)}
+	series := []*monitoring.TimeSeries{{
+		Metric:     &monitoring.Metric{Type: ExportedSpansMetric, Labels: labels},
+		Resource:   resource,
+		MetricKind: "CUMULATIVE",
+		ValueType:  "INT64",
+		Points:     []*monitoring.Point{{Interval: cumulative, Value: &monitoring.TypedValue{Int64Value: &exported}}},
+	}, {
+		Metric:     &monitoring.Metric{Type: UploadErrorRateMetric, Labels: labels},
+		Resource:   resource,
+		MetricKind: "GAUGE",
+		ValueType:  "DOUBLE",
+		Points:     []*monitoring.Point{{Interval: gauge, Value: &monitoring.TypedValue{DoubleValue: &rate}}},
+	}}
+
+	drops := stats.Drops()
+	reasons := make([]string, 0, len(drops))
+	for reason := range drops {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		dropped := int64(drops[reason])
+		series = append(series, &monitoring.TimeSeries{
+			Metric:     &monitoring.Metric{Type: DroppedSpansMetric, Labels: map[string]string{"instance": m.instance, "reason": reason}},
+			Resource:   resource,
+			MetricKind: "CUMULATIVE",
+			ValueType:  "INT64",
+			Points:     []*monitoring.Point{{Interval: cumulative, Value: &monitoring.TypedValue{Int64Value: &dropped}}},
+		})
+	}
+	return series
+}
+
+// writeMetrics writes the current stats of the Recorder to Cloud Monitoring.
+func (r *Recorder) writeMetrics(ctx context.Context) error {
+	m := r.metrics
+	if m.client == nil {
+		c, err := m.newClient()
+		if err != nil {
+			return err
+		}
+		m.client = c
+	}
+	stats := r.Stats()
+	_, err := m.client.Projects.TimeSeries.Create("projects/"+r.project, &monitoring.CreateTimeSeriesRequest{
+		TimeSeries: m.timeSeries(r.project, stats, now()),
+	}).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	m.last = stats
+	return nil
+}
+
+// runMetrics writes the metrics every interval until the Recorder is shut down.
+func (r *Recorder) runMetrics() {
+	m := r.metrics
+	defer close(m.done)
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-m.stop:
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.ctx, m.interval)
+		err := r.writeMetrics(ctx)
+		cancel()
+		if err != nil {
+			r.log.Errorf("failed to write tracing metrics to Cloud Monitoring: %s", err)
+		}
+	}
+}
+
+// stopMetrics stops writing the metrics, waiting for the write in progress
+// until the context is done.
+func (r *Recorder) stopMetrics(ctx context.Context) error {
+	if r.metrics == nil {
+		return nil
+	}
+	close(r.metrics.stop)
+	select {
+	case <-r.metrics.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
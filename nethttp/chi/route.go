@@ -0,0 +1,28 @@
+// Package chi provides a chi middleware setting the route pattern
+// of requests traced by the nethttp middleware, e.g.
+//
+//	r := chi.NewRouter()
+//	r.Use(gcloudchi.Middleware)
+//	http.ListenAndServe(":8080", nethttp.Middleware(tracer, r))
+package chi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hellofresh/gcloud-opentracing/nethttp"
+)
+
+// Middleware sets the pattern of the route matching the request, see
+// nethttp.SetRoute. The pattern is complete once subrouters matched
+// the request, so it's set after the next handler returns.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				nethttp.SetRoute(r.Context(), pattern)
+			}
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package chi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	"github.com/hellofresh/gcloud-opentracing/nethttp"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	tracer := mocktracer.New()
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Route("/orders", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	h := nethttp.Middleware(tracer, r)
+
+	t.Run("route=subrouter", func(t *testing.T) {
+		tracer.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "GET /orders/{id}", sp.OperationName)
+		assert.Equal(t, "/orders/{id}", sp.Tags()[gcloudtracer.HTTPRouteTag])
+	})
+
+	t.Run("route=not_found", func(t *testing.T) {
+		tracer.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "HTTP GET", sp.OperationName)
+		assert.Nil(t, sp.Tags()[gcloudtracer.HTTPRouteTag])
+	})
+}
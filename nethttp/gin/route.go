@@ -0,0 +1,23 @@
+// Package gin provides a gin middleware setting the route of requests
+// traced by the nethttp middleware, e.g.
+//
+//	engine := gin.New()
+//	engine.Use(gcloudgin.Middleware())
+//	http.ListenAndServe(":8080", nethttp.Middleware(tracer, engine))
+package gin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hellofresh/gcloud-opentracing/nethttp"
+)
+
+// Middleware returns a handler setting the full path of the route matching
+// the request, e.g. "/orders/:id", see nethttp.SetRoute.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if path := c.FullPath(); path != "" {
+			nethttp.SetRoute(c.Request.Context(), path)
+		}
+		c.Next()
+	}
+}
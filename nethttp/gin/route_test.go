@@ -0,0 +1,40 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	"github.com/hellofresh/gcloud-opentracing/nethttp"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracer := mocktracer.New()
+	engine := gin.New()
+	engine.Use(Middleware())
+	engine.GET("/orders/:id", func(c *gin.Context) {})
+	h := nethttp.Middleware(tracer, engine)
+
+	t.Run("route=matched", func(t *testing.T) {
+		tracer.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "GET /orders/:id", sp.OperationName)
+		assert.Equal(t, "/orders/:id", sp.Tags()[gcloudtracer.HTTPRouteTag])
+	})
+
+	t.Run("route=not_found", func(t *testing.T) {
+		tracer.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "HTTP GET", sp.OperationName)
+		assert.Nil(t, sp.Tags()[gcloudtracer.HTTPRouteTag])
+	})
+}
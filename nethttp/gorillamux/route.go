@@ -0,0 +1,27 @@
+// Package gorillamux provides a gorilla/mux middleware setting the route
+// template of requests traced by the nethttp middleware, e.g.
+//
+//	r := mux.NewRouter()
+//	r.Use(gorillamux.Middleware)
+//	http.ListenAndServe(":8080", nethttp.Middleware(tracer, r))
+package gorillamux
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hellofresh/gcloud-opentracing/nethttp"
+)
+
+// Middleware sets the path template of the route matching the request,
+// see nethttp.SetRoute.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				nethttp.SetRoute(r.Context(), tpl)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
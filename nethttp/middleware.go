@@ -0,0 +1,271 @@
+// Package nethttp provides a net/http middleware tracing served requests
+// with an opentracing.Tracer, usually a *gcloudtracer.Tracer. The span
+// context of the caller is extracted from the request headers, so with
+// gcloudtracer.WithDebugHeader requests can force their traces to be sampled.
+//
+// Spans are named after the route template of the request if the router
+// sets it with SetRoute, e.g. "GET /orders/{id}", so names don't hold
+// identifiers of the raw path. The gorillamux, chi and gin packages provide
+// router middlewares setting it.
+package nethttp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// DefaultRetryHeader holds the retry count of requests of Cloud Tasks.
+const DefaultRetryHeader = "X-CloudTasks-TaskRetryCount"
+
+// Option configures the Middleware.
+type Option func(o *options)
+
+type options struct {
+	operationName  func(r *http.Request) string
+	named          bool
+	clientIPHeader string
+	anonymizeIP    bool
+	retryHeader    string
+}
+
+// OperationName returns an Option that names spans of requests with
+// the function, by default they're named "<method> <route>", or
+// "HTTP <method>" if the route isn't set.
+func OperationName(f func(r *http.Request) string) Option {
+	return func(o *options) {
+		o.operationName = f
+		o.named = true
+	}
+}
+
+// ClientIPHeader returns an Option that takes the remote IP of requests
+// from the first address of the header, e.g. "X-Forwarded-For" behind
+// a load balancer, instead of the address of the connection.
+func ClientIPHeader(header string) Option {
+	return func(o *options) {
+		o.clientIPHeader = header
+	}
+}
+
+// AnonymizeIP returns an Option that zeroes the last octet of remote IPv4
+// addresses, and the last 80 bits of IPv6 ones, before they're tagged.
+func AnonymizeIP() Option {
+	return func(o *options) {
+		o.anonymizeIP = true
+	}
+}
+
+// RetryHeader returns an Option that tags spans with the number of previous
+// attempts of requests from the header, DefaultRetryHeader by default.
+func RetryHeader(header string) Option {
+	return func(o *options) {
+		o.retryHeader = header
+	}
+}
+
+type routeKey struct{}
+
+// SetRoute records the route template of the request served by Middleware,
+// e.g. "/orders/{id}", to name and tag its span instead of a raw path.
+// Routers call it once they matched the request.
+func SetRoute(ctx context.Context, route string) {
+	if r, ok := ctx.Value(routeKey{}).(*string); ok {
+		*r = route
+	}
+}
+
+// Middleware returns a handler starting a server span of every request,
+// a child of the span context extracted from the request headers if any.
+// The span is in the request context for the next handler, and is finished
+// once the next handler returns. Besides the method, URL and status code,
+// the span is tagged with sizes of the request and response, the route
+// set by SetRoute, the remote IP and the retry count if any.
+//
+// If the next handler panics, the span is tagged as an error with the panic
+// value and stack logged, finished, and the panic is propagated.
+func Middleware(tracer opentracing.Tracer, next http.Handler, opts ...Option) http.Handler {
+	o := options{
+		operationName: func(r *http.Request) string { return "HTTP " + r.Method },
+		retryHeader:   DefaultRetryHeader,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+		sp := tracer.StartSpan(o.operationName(r), ext.RPCServerOption(parent))
+		ext.HTTPMethod.Set(sp, r.Method)
+		ext.HTTPUrl.Set(sp, r.URL.String())
+		ext.Component.Set(sp, "net/http")
+		if ip := o.clientIP(r); ip != "" {
+			ext.PeerAddress.Set(sp, ip)
+		}
+		if retries, err := strconv.Atoi(r.Header.Get(o.retryHeader)); err == nil {
+			sp.SetTag(gcloudtracer.HTTPRetryCountTag, retries)
+		}
+
+		var route string
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		ctx := context.WithValue(opentracing.ContextWithSpan(r.Context(), sp), routeKey{}, &route)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			// http.ErrAbortHandler aborts the response deliberately.
+			if v != nil && v != http.ErrAbortHandler {
+				if !sw.wroteHeader {
+					sw.status = http.StatusInternalServerError
+				}
+				ext.Error.Set(sp, true)
+				sp.LogFields(
+					log.String("event", "error"),
+					log.String("error.kind", "panic"),
+					log.Object("error.object", v),
+					log.String("stack", string(debug.Stack())),
+				)
+			}
+			// An int, rather than uint16 of ext.HTTPStatusCode, is uploaded as a label.
+			sp.SetTag(string(ext.HTTPStatusCode), sw.status)
+			if sw.status >= http.StatusInternalServerError {
+				ext.Error.Set(sp, true)
+			}
+			requestSize := body.n
+			if r.ContentLength > requestSize {
+				requestSize = r.ContentLength
+			}
+			sp.SetTag(gcloudtracer.HTTPRequestSizeTag, int(requestSize))
+			sp.SetTag(gcloudtracer.HTTPResponseSizeTag, int(sw.size))
+			if route != "" {
+				sp.SetTag(gcloudtracer.HTTPRouteTag, route)
+				if !o.named {
+					sp.SetOperationName(r.Method + " " + route)
+				}
+			}
+			sp.Finish()
+			if v != nil {
+				panic(v)
+			}
+		}()
+		next.ServeHTTP(sw, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns the remote IP of the request.
+func (o *options) clientIP(r *http.Request) string {
+	var addr string
+	if o.clientIPHeader != "" {
+		addr = strings.TrimSpace(strings.Split(r.Header.Get(o.clientIPHeader), ",")[0])
+	}
+	if addr == "" {
+		addr = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if o.anonymizeIP {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4.Mask(net.CIDRMask(24, 32))
+		} else {
+			ip = ip.Mask(net.CIDRMask(48, 128))
+		}
+	}
+	return ip.String()
+}
+
+// countingReader counts bytes read from the request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n += int64(n)
+	return n, err
+}
+
+// statusWriter records the status code and size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying writer does,
+// e.g. for WebSocket upgrades.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	w.wroteHeader = true
+	return h.Hijack()
+}
+
+// Push implements http.Pusher if the underlying writer does.
+func (w *statusWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom implements io.ReaderFrom, so the underlying writer can copy
+// files with sendfile.
+func (w *statusWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.wroteHeader = true
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, r)
+	}
+	w.size += n
+	return n, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,218 @@
+package nethttp
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(tracer opentracing.Tracer, h http.HandlerFunc, r *http.Request, opts ...Option) {
+	Middleware(tracer, h, opts...).ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("span=tags", func(t *testing.T) {
+		tracer := mocktracer.New()
+		r := httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader("body"))
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set(DefaultRetryHeader, "2")
+		serve(tracer, func(w http.ResponseWriter, r *http.Request) {
+			assert.NotNil(t, opentracing.SpanFromContext(r.Context()))
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		}, r)
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "HTTP POST", spans[0].OperationName)
+		tags := spans[0].Tags()
+		assert.Equal(t, http.StatusCreated, tags["http.status_code"])
+		assert.Equal(t, "POST", tags["http.method"])
+		assert.Equal(t, "/orders/1", tags["http.url"])
+		assert.Equal(t, "10.0.0.1", tags["peer.address"])
+		assert.Equal(t, 2, tags[gcloudtracer.HTTPRetryCountTag])
+		assert.Equal(t, 4, tags[gcloudtracer.HTTPRequestSizeTag])
+		assert.Equal(t, 7, tags[gcloudtracer.HTTPResponseSizeTag])
+		assert.Nil(t, tags["error"])
+	})
+
+	t.Run("parent=headers", func(t *testing.T) {
+		tracer := mocktracer.New()
+		parent := tracer.StartSpan("client")
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		tracer.Inject(parent.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+		serve(tracer, func(w http.ResponseWriter, r *http.Request) {}, r)
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, sp.ParentID)
+		assert.Equal(t, ext.SpanKindRPCServerEnum, sp.Tags()["span.kind"])
+	})
+
+	t.Run("operation_name=option", func(t *testing.T) {
+		tracer := mocktracer.New()
+		serve(tracer, func(w http.ResponseWriter, r *http.Request) {}, httptest.NewRequest(http.MethodGet, "/orders/1", nil),
+			OperationName(func(r *http.Request) string { return "orders" }))
+
+		assert.Equal(t, "orders", tracer.FinishedSpans()[0].OperationName)
+	})
+
+	t.Run("route=set", func(t *testing.T) {
+		tracer := mocktracer.New()
+		serve(tracer, func(w http.ResponseWriter, r *http.Request) {
+			SetRoute(r.Context(), "/orders/{id}")
+		}, httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "GET /orders/{id}", sp.OperationName)
+		assert.Equal(t, "/orders/{id}", sp.Tags()[gcloudtracer.HTTPRouteTag])
+	})
+
+	t.Run("route=operation_name", func(t *testing.T) {
+		tracer := mocktracer.New()
+		serve(tracer, func(w http.ResponseWriter, r *http.Request) {
+			SetRoute(r.Context(), "/orders/{id}")
+		}, httptest.NewRequest(http.MethodGet, "/orders/1", nil), OperationName(func(r *http.Request) string { return "orders" }))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, "orders", sp.OperationName)
+		assert.Equal(t, "/orders/{id}", sp.Tags()[gcloudtracer.HTTPRouteTag])
+	})
+
+	t.Run("status=5xx", func(t *testing.T) {
+		tracer := mocktracer.New()
+		serve(tracer, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		tags := tracer.FinishedSpans()[0].Tags()
+		assert.Equal(t, http.StatusBadGateway, tags["http.status_code"])
+		assert.Equal(t, true, tags["error"])
+	})
+
+	t.Run("handler=panic", func(t *testing.T) {
+		tracer := mocktracer.New()
+		assert.PanicsWithValue(t, "boom", func() {
+			serve(tracer, func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			}, httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, http.StatusInternalServerError, spans[0].Tags()["http.status_code"])
+		assert.Equal(t, true, spans[0].Tags()["error"])
+		logs := spans[0].Logs()
+		assert.Len(t, logs, 1)
+		assert.Equal(t, "panic", logs[0].Fields[1].ValueString)
+	})
+
+	t.Run("handler=abort", func(t *testing.T) {
+		tracer := mocktracer.New()
+		assert.Panics(t, func() {
+			serve(tracer, func(w http.ResponseWriter, r *http.Request) {
+				panic(http.ErrAbortHandler)
+			}, httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Nil(t, sp.Tags()["error"])
+		assert.Empty(t, sp.Logs())
+	})
+}
+
+func TestMiddlewareWriter(t *testing.T) {
+	t.Run("writer=hijack", func(t *testing.T) {
+		tracer := mocktracer.New()
+		done := make(chan struct{})
+		h := Middleware(tracer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+			rw.Flush()
+		}))
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(done)
+			h.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL)
+		if assert.NoError(t, err) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, "hijacked", string(body))
+		}
+		<-done
+		assert.Len(t, tracer.FinishedSpans(), 1)
+	})
+
+	t.Run("writer=read_from", func(t *testing.T) {
+		tracer := mocktracer.New()
+		w := httptest.NewRecorder()
+		Middleware(tracer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, strings.NewReader("copied"))
+		})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, "copied", w.Body.String())
+		assert.Equal(t, 6, tracer.FinishedSpans()[0].Tags()[gcloudtracer.HTTPResponseSizeTag])
+	})
+
+	t.Run("writer=push", func(t *testing.T) {
+		tracer := mocktracer.New()
+		serve(tracer, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.ErrNotSupported, w.(http.Pusher).Push("/style.css", nil))
+		}, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		header     string
+		opts       []Option
+		expected   string
+	}{
+		{name: "remote_addr", remoteAddr: "10.0.0.1:1234", expected: "10.0.0.1"},
+		{name: "remote_addr=invalid", remoteAddr: "pipe", expected: ""},
+		{name: "header", remoteAddr: "10.0.0.1:1234", header: "203.0.113.7, 10.0.0.2", opts: []Option{ClientIPHeader("X-Forwarded-For")}, expected: "203.0.113.7"},
+		{name: "header=missing", remoteAddr: "10.0.0.1:1234", opts: []Option{ClientIPHeader("X-Forwarded-For")}, expected: "10.0.0.1"},
+		{name: "anonymize=ipv4", remoteAddr: "203.0.113.7:1234", opts: []Option{AnonymizeIP()}, expected: "203.0.113.0"},
+		{name: "anonymize=ipv6", remoteAddr: "[2001:db8:1:2:3:4:5:6]:1234", opts: []Option{AnonymizeIP()}, expected: "2001:db8:1::"},
+	} {
+		t.Run("ip="+tc.name, func(t *testing.T) {
+			var o options
+			for _, opt := range tc.opts {
+				opt(&o)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.header != "" {
+				r.Header.Set("X-Forwarded-For", tc.header)
+			}
+			assert.Equal(t, tc.expected, o.clientIP(r))
+		})
+	}
+}
+
+func TestRetryHeader(t *testing.T) {
+	tracer := mocktracer.New()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Retry", "3")
+	r.Header.Set(DefaultRetryHeader, "1")
+	serve(tracer, func(w http.ResponseWriter, r *http.Request) {}, r, RetryHeader("X-Retry"))
+
+	assert.Equal(t, 3, tracer.FinishedSpans()[0].Tags()[gcloudtracer.HTTPRetryCountTag])
+}
@@ -0,0 +1,77 @@
+package nethttp
+
+import (
+	"context"
+	"net/http"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// Transport returns a RoundTripper tracing requests made in the context
+// of a span as its client child spans, and propagating the span context
+// in the request headers. Requests without a span aren't traced.
+// The base RoundTripper is http.DefaultTransport if nil.
+func Transport(tracer opentracing.Tracer, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{tracer: tracer, base: base}
+}
+
+// GoogleClientOption returns an option of Google Cloud client libraries
+// using HTTP, e.g. Storage or BigQuery, tracing their requests with the
+// Transport. The opts configure the credentials of the client the way
+// they would without the option, as the option replaces its HTTP client.
+// Clients using gRPC, e.g. Firestore, aren't traced.
+func GoogleClientOption(ctx context.Context, tracer opentracing.Tracer, opts ...option.ClientOption) (option.ClientOption, error) {
+	t, err := htransport.NewTransport(ctx, Transport(tracer, nil), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return option.WithHTTPClient(&http.Client{Transport: t}), nil
+}
+
+type transport struct {
+	tracer opentracing.Tracer
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	parent := opentracing.SpanFromContext(r.Context())
+	if parent == nil {
+		return t.base.RoundTrip(r)
+	}
+
+	sp := t.tracer.StartSpan(r.Method+" "+r.URL.Host, opentracing.ChildOf(parent.Context()), ext.SpanKindRPCClient)
+	defer sp.Finish()
+	ext.HTTPMethod.Set(sp, r.Method)
+	ext.HTTPUrl.Set(sp, r.URL.String())
+	ext.PeerHostname.Set(sp, r.URL.Hostname())
+	ext.Component.Set(sp, "net/http")
+	if r.ContentLength > 0 {
+		sp.SetTag(gcloudtracer.HTTPRequestSizeTag, int(r.ContentLength))
+	}
+
+	// A RoundTripper must not modify the request.
+	r = r.Clone(r.Context())
+	t.tracer.Inject(sp.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		ext.Error.Set(sp, true)
+		sp.SetTag("error.message", err.Error())
+		return nil, err
+	}
+	// An int, rather than uint16 of ext.HTTPStatusCode, is uploaded as a label.
+	sp.SetTag(string(ext.HTTPStatusCode), resp.StatusCode)
+	if resp.ContentLength >= 0 {
+		sp.SetTag(gcloudtracer.HTTPResponseSizeTag, int(resp.ContentLength))
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		ext.Error.Set(sp, true)
+	}
+	return resp, nil
+}
@@ -0,0 +1,103 @@
+package nethttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripper func(r *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransport(t *testing.T) {
+	t.Run("parent=span", func(t *testing.T) {
+		tracer := mocktracer.New()
+		var header http.Header
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			w.Write([]byte("ok"))
+		}))
+		defer srv.Close()
+
+		parent := tracer.StartSpan("parent")
+		r, _ := http.NewRequestWithContext(opentracing.ContextWithSpan(context.Background(), parent), http.MethodPost, srv.URL+"/orders", strings.NewReader("body"))
+		resp, err := (&http.Client{Transport: Transport(tracer, nil)}).Do(r)
+		assert.NoError(t, err)
+		resp.Body.Close()
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 1)
+		sp := spans[0]
+		assert.Equal(t, "POST "+r.URL.Host, sp.OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, sp.ParentID)
+		tags := sp.Tags()
+		assert.Equal(t, http.StatusOK, tags["http.status_code"])
+		assert.Equal(t, srv.URL+"/orders", tags["http.url"])
+		assert.Equal(t, "127.0.0.1", tags["peer.hostname"])
+		assert.Equal(t, 4, tags[gcloudtracer.HTTPRequestSizeTag])
+		assert.Equal(t, 2, tags[gcloudtracer.HTTPResponseSizeTag])
+		assert.Nil(t, tags["error"])
+
+		extracted, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+		assert.NoError(t, err)
+		assert.Equal(t, sp.SpanContext.SpanID, extracted.(mocktracer.MockSpanContext).SpanID)
+		assert.Empty(t, r.Header, "request must not be modified")
+	})
+
+	t.Run("parent=none", func(t *testing.T) {
+		tracer := mocktracer.New()
+		var called bool
+		rt := Transport(tracer, roundTripper(func(r *http.Request) (*http.Response, error) {
+			called = true
+			assert.Empty(t, r.Header)
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}))
+		_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		assert.NoError(t, err)
+		assert.True(t, called)
+		assert.Empty(t, tracer.FinishedSpans())
+	})
+
+	t.Run("status=5xx", func(t *testing.T) {
+		tracer := mocktracer.New()
+		rt := Transport(tracer, roundTripper(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, ContentLength: -1}, nil
+		}))
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r = r.WithContext(opentracing.ContextWithSpan(r.Context(), tracer.StartSpan("parent")))
+		_, err := rt.RoundTrip(r)
+		assert.NoError(t, err)
+
+		tags := tracer.FinishedSpans()[0].Tags()
+		assert.Equal(t, http.StatusServiceUnavailable, tags["http.status_code"])
+		assert.Equal(t, true, tags["error"])
+		assert.Nil(t, tags[gcloudtracer.HTTPResponseSizeTag])
+	})
+
+	t.Run("round_trip=error", func(t *testing.T) {
+		tracer := mocktracer.New()
+		rt := Transport(tracer, roundTripper(func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("refused")
+		}))
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r = r.WithContext(opentracing.ContextWithSpan(r.Context(), tracer.StartSpan("parent")))
+		_, err := rt.RoundTrip(r)
+		assert.EqualError(t, err, "refused")
+
+		tags := tracer.FinishedSpans()[0].Tags()
+		assert.Equal(t, true, tags["error"])
+		assert.Equal(t, "refused", tags["error.message"])
+		assert.Nil(t, tags["http.status_code"])
+	})
+}
@@ -0,0 +1,109 @@
+// Package opencensus provides an OpenCensus exporter which feeds
+// OpenCensus spans into the gcloudtracer Recorder, so codebases mixing
+// OpenTracing and OpenCensus instrumentation share one upload pipeline.
+package opencensus
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.opencensus.io/trace"
+)
+
+var _ trace.Exporter = &Exporter{}
+
+// Exporter implements trace.Exporter interface
+// used to write OpenCensus spans through a span recorder.
+type Exporter struct {
+	recorder gcloudtracer.SpanRecorder
+}
+
+// NewExporter creates new OpenCensus exporter backed by the recorder,
+// usually a *gcloudtracer.Recorder.
+func NewExporter(recorder gcloudtracer.SpanRecorder) *Exporter {
+	return &Exporter{recorder: recorder}
+}
+
+// ExportSpan converts OpenCensus span and passes it to the recorder.
+func (e *Exporter) ExportSpan(sd *trace.SpanData) {
+	e.recorder.RecordSpan(ConvertSpanData(sd))
+}
+
+// ConvertSpanData converts OpenCensus span into gcloudtracer.RawSpan,
+// keeping the trace identifier of 128 bits.
+func ConvertSpanData(sd *trace.SpanData) gcloudtracer.RawSpan {
+	tags := make(opentracing.Tags, len(sd.Attributes)+3)
+	for k, v := range sd.Attributes {
+		tags[k] = convertAttribute(v)
+	}
+	switch sd.SpanKind {
+	case trace.SpanKindServer:
+		tags[string(ext.SpanKind)] = ext.SpanKindRPCServerEnum
+	case trace.SpanKindClient:
+		tags[string(ext.SpanKind)] = ext.SpanKindRPCClientEnum
+	}
+	if sd.Code != 0 {
+		tags[string(ext.Error)] = "true"
+		tags["opencensus.status_code"] = int(sd.Code)
+		tags["opencensus.status_message"] = sd.Message
+	}
+
+	logs := make([]opentracing.LogRecord, 0, len(sd.Annotations)+len(sd.MessageEvents))
+	for _, a := range sd.Annotations {
+		fields := []otlog.Field{otlog.String("message", a.Message)}
+		for k, v := range a.Attributes {
+			fields = append(fields, otlog.String(k, convertAttribute(v)))
+		}
+		logs = append(logs, opentracing.LogRecord{Timestamp: a.Time, Fields: fields})
+	}
+	for _, m := range sd.MessageEvents {
+		logs = append(logs, opentracing.LogRecord{
+			Timestamp: m.Time,
+			Fields: []otlog.Field{
+				otlog.String("message_event", convertMessageEventType(m.EventType)),
+				otlog.Int64("message_id", m.MessageID),
+				otlog.Int64("uncompressed_size", m.UncompressedByteSize),
+				otlog.Int64("compressed_size", m.CompressedByteSize),
+			},
+		})
+	}
+
+	return gcloudtracer.RawSpan{
+		Context: gcloudtracer.SpanContext{
+			TraceIDHigh: binary.BigEndian.Uint64(sd.TraceID[:8]),
+			TraceID:     binary.BigEndian.Uint64(sd.TraceID[8:]),
+			SpanID:      binary.BigEndian.Uint64(sd.SpanID[:]),
+			Sampled:     sd.IsSampled(),
+		},
+		ParentSpanID: binary.BigEndian.Uint64(sd.ParentSpanID[:]),
+		Operation:    sd.Name,
+		Start:        sd.StartTime,
+		Duration:     sd.EndTime.Sub(sd.StartTime),
+		Tags:         tags,
+		Logs:         logs,
+	}
+}
+
+// OpenCensus attributes are either string, bool or int64,
+// only strings are kept as is by the recorder.
+func convertAttribute(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func convertMessageEventType(t trace.MessageEventType) string {
+	switch t {
+	case trace.MessageEventTypeSent:
+		return "sent"
+	case trace.MessageEventTypeRecv:
+		return "received"
+	default:
+		return "unspecified"
+	}
+}
@@ -0,0 +1,68 @@
+package opencensus
+
+import (
+	"testing"
+	"time"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+)
+
+type recorder struct {
+	spans []gcloudtracer.RawSpan
+}
+
+func (r *recorder) RecordSpan(sp gcloudtracer.RawSpan) {
+	r.spans = append(r.spans, sp)
+}
+
+func TestConvertSpanData(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	sd := &trace.SpanData{
+		SpanContext: trace.SpanContext{
+			TraceID:      trace.TraceID{0x10, 0x54, 0x45, 0xaa, 0x78, 0x43, 0xbc, 0x8b, 0xf2, 0x06, 0xb1, 0x20, 0x00, 0x10, 0x00, 0x00},
+			SpanID:       trace.SpanID{0, 0, 0, 0, 0, 0, 0, 2},
+			TraceOptions: 1,
+		},
+		ParentSpanID: trace.SpanID{0, 0, 0, 0, 0, 0, 0, 1},
+		Name:         "get",
+		SpanKind:     trace.SpanKindClient,
+		StartTime:    start,
+		EndTime:      start.Add(time.Second),
+		Attributes:   map[string]interface{}{"http.path": "/", "retries": int64(2)},
+		Annotations:  []trace.Annotation{{Time: start, Message: "sent"}},
+		Status:       trace.Status{Code: 5, Message: "not found"},
+	}
+
+	sp := ConvertSpanData(sd)
+
+	t.Run("trace_id=128bit", func(t *testing.T) {
+		assert.Equal(t, gcloudtracer.SpanContext{TraceIDHigh: 0x105445aa7843bc8b, TraceID: 0xf206b12000100000, SpanID: 2, Sampled: true}, sp.Context)
+		assert.Equal(t, sd.TraceID.String(), sp.Context.TraceIDString())
+		assert.Equal(t, uint64(1), sp.ParentSpanID)
+	})
+
+	t.Run("span=fields", func(t *testing.T) {
+		assert.Equal(t, "get", sp.Operation)
+		assert.Equal(t, start, sp.Start)
+		assert.Equal(t, time.Second, sp.Duration)
+		assert.Equal(t, opentracing.Tags{
+			"http.path":                 "/",
+			"retries":                   "2",
+			string(ext.SpanKind):        ext.SpanKindRPCClientEnum,
+			string(ext.Error):           "true",
+			"opencensus.status_code":    5,
+			"opencensus.status_message": "not found",
+		}, sp.Tags)
+		assert.Len(t, sp.Logs, 1)
+	})
+
+	t.Run("exporter=recorder", func(t *testing.T) {
+		rec := &recorder{}
+		NewExporter(rec).ExportSpan(sd)
+		assert.Equal(t, []gcloudtracer.RawSpan{sp}, rec.spans)
+	})
+}
@@ -0,0 +1,109 @@
+// Package opentelemetry provides an OpenTelemetry SpanExporter which feeds
+// OpenTelemetry SDK spans into the gcloudtracer Recorder, so teams can adopt
+// the OpenTelemetry SDK while keeping the Cloud Trace upload path and options.
+package opentelemetry
+
+import (
+	"context"
+	"encoding/binary"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ sdktrace.SpanExporter = &Exporter{}
+
+// Exporter implements sdktrace.SpanExporter interface
+// used to write OpenTelemetry spans through a span recorder.
+type Exporter struct {
+	recorder gcloudtracer.SpanRecorder
+}
+
+// NewExporter creates new OpenTelemetry exporter backed by the recorder,
+// usually a *gcloudtracer.Recorder.
+func NewExporter(recorder gcloudtracer.SpanRecorder) *Exporter {
+	return &Exporter{recorder: recorder}
+}
+
+// ExportSpans converts OpenTelemetry spans and passes them to the recorder.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	for _, s := range spans {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		e.recorder.RecordSpan(ConvertSpan(s))
+	}
+	return nil
+}
+
+// Shutdown implements sdktrace.SpanExporter interface.
+// It uploads spans buffered by the recorder, if it supports flushing.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	if f, ok := e.recorder.(flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// ConvertSpan converts OpenTelemetry span into gcloudtracer.RawSpan,
+// so its trace is uploaded with the identifier propagated by W3C headers.
+func ConvertSpan(s sdktrace.ReadOnlySpan) gcloudtracer.RawSpan {
+	attrs := s.Attributes()
+	tags := make(opentracing.Tags, len(attrs)+3)
+	for _, kv := range attrs {
+		tags[string(kv.Key)] = kv.Value.Emit()
+	}
+	switch s.SpanKind() {
+	case trace.SpanKindServer, trace.SpanKindConsumer:
+		tags[string(ext.SpanKind)] = ext.SpanKindRPCServerEnum
+	case trace.SpanKindClient, trace.SpanKindProducer:
+		tags[string(ext.SpanKind)] = ext.SpanKindRPCClientEnum
+	}
+	if st := s.Status(); st.Code == codes.Error {
+		tags[string(ext.Error)] = "true"
+		tags["otel.status_description"] = st.Description
+	}
+
+	events := s.Events()
+	logs := make([]opentracing.LogRecord, 0, len(events))
+	for _, ev := range events {
+		fields := []otlog.Field{otlog.String("event", ev.Name)}
+		for _, kv := range ev.Attributes {
+			fields = append(fields, otlog.String(string(kv.Key), kv.Value.Emit()))
+		}
+		logs = append(logs, opentracing.LogRecord{Timestamp: ev.Time, Fields: fields})
+	}
+
+	sc := s.SpanContext()
+	traceID := sc.TraceID()
+	spanID := sc.SpanID()
+	var parentID uint64
+	if p := s.Parent(); p.IsValid() {
+		pid := p.SpanID()
+		parentID = binary.BigEndian.Uint64(pid[:])
+	}
+
+	return gcloudtracer.RawSpan{
+		Context: gcloudtracer.SpanContext{
+			TraceIDHigh: binary.BigEndian.Uint64(traceID[:8]),
+			TraceID:     binary.BigEndian.Uint64(traceID[8:]),
+			SpanID:      binary.BigEndian.Uint64(spanID[:]),
+			Sampled:     sc.IsSampled(),
+		},
+		ParentSpanID: parentID,
+		Operation:    s.Name(),
+		Start:        s.StartTime(),
+		Duration:     s.EndTime().Sub(s.StartTime()),
+		Tags:         tags,
+		Logs:         logs,
+	}
+}
@@ -0,0 +1,76 @@
+package opentelemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type recorder struct {
+	spans []gcloudtracer.RawSpan
+}
+
+func (r *recorder) RecordSpan(sp gcloudtracer.RawSpan) {
+	r.spans = append(r.spans, sp)
+}
+
+func TestConvertSpan(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	traceID, _ := trace.TraceIDFromHex("105445aa7843bc8bf206b12000100000")
+	s := tracetest.SpanStub{
+		Name: "get",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     trace.SpanID{0, 0, 0, 0, 0, 0, 0, 2},
+			TraceFlags: trace.FlagsSampled,
+		}),
+		Parent: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  trace.SpanID{0, 0, 0, 0, 0, 0, 0, 1},
+		}),
+		SpanKind:   trace.SpanKindServer,
+		StartTime:  start,
+		EndTime:    start.Add(time.Second),
+		Attributes: []attribute.KeyValue{attribute.String("http.path", "/"), attribute.Int("retries", 2)},
+		Events:     []sdktrace.Event{{Name: "sent", Time: start}},
+		Status:     sdktrace.Status{Code: codes.Error, Description: "not found"},
+	}.Snapshot()
+
+	sp := ConvertSpan(s)
+
+	t.Run("trace_id=128bit", func(t *testing.T) {
+		assert.Equal(t, gcloudtracer.SpanContext{TraceIDHigh: 0x105445aa7843bc8b, TraceID: 0xf206b12000100000, SpanID: 2, Sampled: true}, sp.Context)
+		assert.Equal(t, traceID.String(), sp.Context.TraceIDString())
+		assert.Equal(t, uint64(1), sp.ParentSpanID)
+	})
+
+	t.Run("span=fields", func(t *testing.T) {
+		assert.Equal(t, "get", sp.Operation)
+		assert.Equal(t, start, sp.Start)
+		assert.Equal(t, time.Second, sp.Duration)
+		assert.Equal(t, opentracing.Tags{
+			"http.path":               "/",
+			"retries":                 "2",
+			string(ext.SpanKind):      ext.SpanKindRPCServerEnum,
+			string(ext.Error):         "true",
+			"otel.status_description": "not found",
+		}, sp.Tags)
+		assert.Len(t, sp.Logs, 1)
+	})
+
+	t.Run("exporter=recorder", func(t *testing.T) {
+		rec := &recorder{}
+		assert.NoError(t, NewExporter(rec).ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{s}))
+		assert.Equal(t, []gcloudtracer.RawSpan{sp}, rec.spans)
+	})
+}
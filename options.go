@@ -1,10 +1,102 @@
 package gcloudtracer
 
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
+	"google.golang.org/api/option"
+)
+
 // Options containes options for recorder and StackDriver client.
 type Options struct {
-	log         Logger
-	projectID   string
-	credentials JWTCredentials
+	log                Logger
+	debug              bool
+	projectID          string
+	projectTag         string
+	labels             map[string]string
+	detectors          []Detector
+	synchronous        bool
+	samplingRate       float64
+	filters            []Filter
+	rateLimit          float64
+	rateBurst          int
+	maxSpansPerTrace   int
+	dailyBudget        uint64
+	bundleDelay        time.Duration
+	bundleJitter       time.Duration
+	bundleCount        int
+	bufferedLimit      int
+	overflowWait       time.Duration
+	memoryLimit        int64
+	evictionPolicy     EvictionPolicy
+	uploadConcurrency  int
+	bundlerShards      int
+	shared             *SharedBundler
+	fallback           Exporter
+	fallbackAfter      time.Duration
+	maxAttempts        int
+	retryBackoff       time.Duration
+	credentials        JWTCredentials
+	keySource          *loadedCredentials
+	clientOptions      []option.ClientOption
+	preflight          bool
+	lazyClient         bool
+	converter          SpanConverter
+	spanKind           SpanKindFunc
+	v2                 bool
+	syntheticRoots     bool
+	validate           bool
+	idGenerator        IDGenerator
+	sampler            func(traceID uint64) bool
+	traceID128         bool
+	verifyInterval     time.Duration
+	onVerifyFailure    VerificationFunc
+	audit              AuditFunc
+	scrubbers          []labelScrubber
+	safeMode           bool
+	headerBlocklist    []string
+	maxOperations      int
+	aggregateSiblings  int
+	costAccounting     bool
+	costInterval       time.Duration
+	costReport         CostReportFunc
+	slo                *sloHook
+	samplingRules      []SamplingRule
+	debugHeader        string
+	unsampled          Exporter
+	recent             *RecentTraces
+	tracez             *Tracez
+	slowUpload         time.Duration
+	selfTracing        bool
+	monitoringInterval time.Duration
+	monitoringOptions  []option.ClientOption
+	maxEvents          int
+	eventPolicy        EventPolicy
+	merge              labelMerge
+	peerService        bool
+	latencyBuckets     []time.Duration
+	operationPrefix    string
+	baggage            *baggageExport
+	processors         []Processor
+	strict             ViolationFunc
+	newClient          func() (*cloudtrace.Service, error)
+	newClientV2        func() (*cloudtracev2.Service, error)
+}
+
+func defaultOptions() Options {
+	return Options{
+		samplingRate:  1,
+		maxAttempts:   1,
+		bundleDelay:   2 * time.Second,
+		bundleCount:   100,
+		spanKind:      convertSpanKind,
+		bufferedLimit: 10000,
+		safeMode:      true,
+	}
 }
 
 // Valid validates Options.
@@ -25,6 +117,208 @@ func WithProject(pid string) Option {
 	}
 }
 
+// WithProjectTag returns a Option that specifies a span tag holding
+// the project identifier the span is uploaded to. Spans without the tag
+// are uploaded to the project specified by WithProject.
+func WithProjectTag(tag string) Option {
+	return func(o *Options) {
+		o.projectTag = tag
+	}
+}
+
+// WithDefaultLabels returns an Option that specifies labels added to all spans.
+// Span tags take precedence over default labels.
+func WithDefaultLabels(labels map[string]string) Option {
+	return func(o *Options) {
+		if o.labels == nil {
+			o.labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			o.labels[k] = v
+		}
+	}
+}
+
+// WithDetector returns an Option that adds labels returned by the detector
+// to all spans. Detectors run once, when the Recorder is created.
+func WithDetector(d Detector) Option {
+	return func(o *Options) {
+		o.detectors = append(o.detectors, d)
+	}
+}
+
+// WithSynchronousUpload returns an Option that makes the Recorder upload
+// every span as soon as it is recorded, instead of bundling spans.
+func WithSynchronousUpload() Option {
+	return func(o *Options) {
+		o.synchronous = true
+	}
+}
+
+// WithCloudRun returns an Option that adds Cloud Run, Cloud Functions and
+// App Engine labels and enables synchronous upload when the process runs
+// in Cloud Run, Cloud Functions or App Engine standard environment, since
+// CPU is throttled outside of requests in those runtimes.
+func WithCloudRun() Option {
+	return func(o *Options) {
+		o.detectors = append(o.detectors, DetectCloudRun, DetectAppEngine)
+		if requestScoped() {
+			o.synchronous = true
+		}
+	}
+}
+
+// WithFilter returns an Option that adds a filter of recorded spans.
+// Spans are uploaded only if all the filters accept them.
+func WithFilter(f Filter) Option {
+	return func(o *Options) {
+		o.filters = append(o.filters, f)
+	}
+}
+
+// WithSamplingRate returns an Option that specifies a fraction of sampled
+// traces uploaded by the Recorder, from 0 (none) to 1 (all).
+// The decision is made by trace identifier, so traces are kept or dropped as a whole.
+func WithSamplingRate(rate float64) Option {
+	return func(o *Options) {
+		o.samplingRate = rate
+	}
+}
+
+// WithRateLimit returns an Option that caps the number of spans accepted
+// per second, allowing bursts of up to burst spans. Spans over the limit are
+// dropped and counted in Stats, a debug message is logged for each one.
+func WithRateLimit(spansPerSecond float64, burst int) Option {
+	return func(o *Options) {
+		o.rateLimit = spansPerSecond
+		o.rateBurst = burst
+	}
+}
+
+// WithMaxSpansPerTrace returns an Option that limits the number of spans
+// uploaded per trace. The first spans recorded are kept, as well as root
+// spans and parents of spans recorded, which finish after their children,
+// so the newest leaves are dropped over the limit. Spans over the limit are
+// dropped and counted in Stats.
+func WithMaxSpansPerTrace(n int) Option {
+	return func(o *Options) {
+		o.maxSpansPerTrace = n
+	}
+}
+
+// WithDailyBudget returns an Option that limits the number of spans
+// uploaded per day (UTC). The fraction of traces kept is lowered as the
+// budget is consumed, so spans are spread over the day instead of stopping
+// abruptly once the budget is exhausted.
+func WithDailyBudget(spans uint64) Option {
+	return func(o *Options) {
+		o.dailyBudget = spans
+	}
+}
+
+// WithBundleDelayThreshold returns an Option that specifies how long spans
+// are buffered before they are uploaded.
+func WithBundleDelayThreshold(d time.Duration) Option {
+	return func(o *Options) {
+		o.bundleDelay = d
+	}
+}
+
+// WithBundleDelayJitter returns an Option that adds a random duration of up
+// to jitter to the bundle delay threshold, drawn again for every bundle, so
+// replicas deployed at the same time don't upload spans at the same moments.
+func WithBundleDelayJitter(jitter time.Duration) Option {
+	return func(o *Options) {
+		o.bundleJitter = jitter
+	}
+}
+
+// WithBundleCountThreshold returns an Option that specifies how many traces
+// are buffered before they are uploaded.
+func WithBundleCountThreshold(n int) Option {
+	return func(o *Options) {
+		o.bundleCount = n
+	}
+}
+
+// WithBufferedLimit returns an Option that specifies how many traces and spans
+// can be buffered in total, before spans are uploaded immediately.
+func WithBufferedLimit(n int) Option {
+	return func(o *Options) {
+		o.bufferedLimit = n
+	}
+}
+
+// WithBlockOnOverflow returns an Option that makes recording a span wait
+// up to maxWait for buffer space when the buffered limit is reached,
+// instead of uploading the span immediately. The span is dropped if no space
+// became available in time.
+func WithBlockOnOverflow(maxWait time.Duration) Option {
+	return func(o *Options) {
+		o.overflowWait = maxWait
+	}
+}
+
+// WithMemoryLimit returns an Option that specifies approximate number of bytes
+// which can be held by buffered spans. Spans recorded above the limit are
+// handled according to the policy.
+func WithMemoryLimit(bytes int64, policy EvictionPolicy) Option {
+	return func(o *Options) {
+		o.memoryLimit = bytes
+		o.evictionPolicy = policy
+	}
+}
+
+// WithUploadConcurrency returns an Option that specifies how many bundles
+// can be uploaded at the same time by all the bundler shards together.
+// Without the option, each shard uploads one bundle at a time.
+func WithUploadConcurrency(n int) Option {
+	return func(o *Options) {
+		o.uploadConcurrency = n
+	}
+}
+
+// WithBundlerShards returns an Option that specifies in how many shards
+// spans are bundled, by hash of the trace identifier. Each shard has its own
+// delay timer and gets an equal part of the buffered limit. Defaults to
+// GOMAXPROCS.
+func WithBundlerShards(n int) Option {
+	return func(o *Options) {
+		o.bundlerShards = n
+	}
+}
+
+// WithSharedBundler returns an Option that makes the Recorder buffer spans
+// in the shared bundler. Bundler options of the Recorder are ignored then.
+func WithSharedBundler(sb *SharedBundler) Option {
+	return func(o *Options) {
+		o.shared = sb
+	}
+}
+
+// WithUploadRetries returns an Option that specifies how many times an upload
+// is attempted when Cloud Trace fails temporarily. The backoff between the
+// attempts doubles starting from the given one.
+func WithUploadRetries(attempts int, backoff time.Duration) Option {
+	return func(o *Options) {
+		o.maxAttempts = attempts
+		o.retryBackoff = backoff
+	}
+}
+
+// WithFallback returns an Option that makes the Recorder write traces with
+// the exporter once Cloud Trace has been unreachable for the duration,
+// failing with network errors, server errors or throttling. Other errors,
+// e.g. invalid traces or permission denied, aren't counted as an outage.
+// Cloud Trace is tried again once per the duration, uploads are switched back
+// as soon as it succeeds.
+func WithFallback(exporter Exporter, after time.Duration) Option {
+	return func(o *Options) {
+		o.fallback = exporter
+		o.fallbackAfter = after
+	}
+}
+
 // WithLogger returns an Option that specifies a logger of the Recorder.
 func WithLogger(logger Logger) Option {
 	return func(o *Options) {
@@ -32,6 +326,14 @@ func WithLogger(logger Logger) Option {
 	}
 }
 
+// WithDebug returns an Option that enables debug messages of the Recorder.
+// The messages are written if the logger implements DebugLogger.
+func WithDebug(debug bool) Option {
+	return func(o *Options) {
+		o.debug = debug
+	}
+}
+
 // JWTCredentials represents the json file from the google Appplication Default Configuration
 type JWTCredentials struct {
 	Email        string
@@ -45,3 +347,469 @@ func WithJWTCredentials(credentials JWTCredentials) Option {
 		o.credentials = credentials
 	}
 }
+
+// WithCredentialsFromSecretManager returns an Option that authorizes
+// the Cloud Trace clients with the service account json key stored in
+// the secret version of Secret Manager, for example
+// "projects/my-project/secrets/tracer-key/versions/latest", so the key
+// isn't kept on disk. The key is loaded again every refresh interval if
+// positive, to pick up rotated keys. The opts configure the Secret Manager
+// client, Application Default Credentials are used by default.
+func WithCredentialsFromSecretManager(name string, refresh time.Duration, opts ...option.ClientOption) Option {
+	return func(o *Options) {
+		o.keySource = &loadedCredentials{load: secretKeyLoader(name, opts), refresh: refresh}
+	}
+}
+
+// WithKMSEncryptedCredentials returns an Option that authorizes the Cloud
+// Trace clients with the service account json key read from the file
+// encrypted with the Cloud KMS crypto key, for example
+// "projects/my-project/locations/global/keyRings/tracing/cryptoKeys/key".
+// The key is decrypted by Cloud KMS when the Recorder is created and kept
+// in memory only. The opts configure the Cloud KMS client, Application
+// Default Credentials are used by default.
+func WithKMSEncryptedCredentials(path, cryptoKey string, opts ...option.ClientOption) Option {
+	return func(o *Options) {
+		o.keySource = &loadedCredentials{load: kmsKeyLoader(path, cryptoKey, opts)}
+	}
+}
+
+// WithClientOption returns an Option that specifies an option of the
+// Cloud Trace client, e.g. an API endpoint or credentials.
+func WithClientOption(opt option.ClientOption) Option {
+	return func(o *Options) {
+		o.clientOptions = append(o.clientOptions, opt)
+	}
+}
+
+// WithPreflight returns an Option that makes NewRecorder verify credentials
+// and permissions on the project, see Recorder.Verify.
+func WithPreflight() Option {
+	return func(o *Options) {
+		o.preflight = true
+	}
+}
+
+// WithLazyClient returns an Option that defers creation of the Cloud Trace
+// client, including lookup of the credentials, until spans are uploaded.
+// NewRecorder doesn't fail or block on missing credentials then, upload
+// errors are reported instead.
+func WithLazyClient() Option {
+	return func(o *Options) {
+		o.lazyClient = true
+	}
+}
+
+// LoadJWTCredentials reads the JWT Credentials from the service account json key file.
+func LoadJWTCredentials(path string) (JWTCredentials, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return JWTCredentials{}, err
+	}
+	return ParseJWTCredentials(b)
+}
+
+// ParseJWTCredentials parses the JWT Credentials from the service account json key.
+func ParseJWTCredentials(data []byte) (JWTCredentials, error) {
+	var key struct {
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return JWTCredentials{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return JWTCredentials{}, ErrInvalidCredentials
+	}
+	return JWTCredentials{
+		Email:        key.ClientEmail,
+		PrivateKey:   []byte(key.PrivateKey),
+		PrivateKeyID: key.PrivateKeyID,
+	}, nil
+}
+
+// WithConverter returns an Option that makes the Recorder convert spans
+// with the converter, to control labels and names of spans. The trace is
+// uploaded to its ProjectId, or to the project of the Recorder if empty.
+// Default labels and the project tag are up to the converter then,
+// a nil trace drops the span.
+func WithConverter(c SpanConverter) Option {
+	return func(o *Options) {
+		o.converter = c
+	}
+}
+
+// WithSpanKindFunc returns an Option that specifies how the span kind
+// is resolved from the span tags, instead of the span.kind tag.
+// One of "RPC_SERVER", "RPC_CLIENT" or "SPAN_KIND_UNSPECIFIED" is expected.
+func WithSpanKindFunc(f SpanKindFunc) Option {
+	return func(o *Options) {
+		o.spanKind = f
+	}
+}
+
+// WithV2API returns an Option that makes the Recorder upload spans with
+// the v2 API (BatchWrite) instead of the v1 API (PatchTraces). Secondary
+// references of spans are uploaded as links, logs as time events, integer
+// and boolean tags as typed attributes, and the status of spans is derived
+// from the HTTP and gRPC status tags.
+func WithV2API() Option {
+	return func(o *Options) {
+		o.v2 = true
+	}
+}
+
+// WithSyntheticRoots returns an Option that makes the Recorder add
+// a placeholder root span, labeled with SyntheticLabel, to uploaded traces
+// whose spans all have a parent missing from the trace, so the trace renders
+// as a tree. The placeholder has the identifier of the missing parent,
+// so the parent replaces it if the parent is uploaded later. Parents uploaded
+// in previous bundles of the last traces aren't replaced by placeholders.
+func WithSyntheticRoots() Option {
+	return func(o *Options) {
+		o.syntheticRoots = true
+	}
+}
+
+// WithValidation returns an Option that makes the Recorder check spans
+// of uploaded traces and log a warning for spans with a parent missing
+// from the trace, spans ending before they start, and duplicate span
+// identifiers. Traces are checked per bundle, so spans of a trace uploaded
+// in different bundles may be reported with a missing parent.
+// It's meant for debugging instrumentation.
+func WithValidation() Option {
+	return func(o *Options) {
+		o.validate = true
+	}
+}
+
+// WithIDGenerator returns an Option that specifies how identifiers of traces
+// and spans started by the tracer of this package are generated, for example
+// deterministically in tests or derived from upstream headers. Identifiers
+// are random by default.
+func WithIDGenerator(g IDGenerator) Option {
+	return func(o *Options) {
+		o.idGenerator = g
+	}
+}
+
+// WithSampler returns an Option that specifies whether a trace started by
+// the tracer of this package is sampled, by its identifier. Traces continued
+// from an upstream span keep its sampling decision. All traces are sampled
+// by default, see also WithSamplingRate.
+func WithSampler(sample func(traceID uint64) bool) Option {
+	return func(o *Options) {
+		o.sampler = sample
+	}
+}
+
+// With128BitTraceIDs returns an Option that makes the tracer of this package
+// start traces with 128-bit identifiers. By default the high 64 bits are zero,
+// so identifiers are propagated to basictracer peers the way they expect.
+func With128BitTraceIDs() Option {
+	return func(o *Options) {
+		o.traceID128 = true
+	}
+}
+
+// WithExportVerification returns an Option that makes the Recorder read back
+// a recently uploaded trace every interval, and call the function if the trace
+// can't be read, for example because of a wrong project or missing quota.
+// Failures are logged if the function is nil. Reading traces requires
+// the trace.readonly scope and the cloudtrace.traces.get permission.
+func WithExportVerification(interval time.Duration, onFailure VerificationFunc) Option {
+	return func(o *Options) {
+		o.verifyInterval = interval
+		o.onVerifyFailure = onFailure
+	}
+}
+
+// WithAuditHook returns an Option that specifies a function called with
+// the spans of every successful upload to Cloud Trace, to keep an audit trail
+// of the exported spans. Spans written by the fallback exporter and
+// the exporter of unsampled spans are included. The function is called
+// on the upload goroutine, or the recording one for unsampled spans.
+func WithAuditHook(f AuditFunc) Option {
+	return func(o *Options) {
+		o.audit = f
+	}
+}
+
+// WithHashedLabels returns an Option that makes the Recorder replace values
+// of the labels of the keys, e.g. "user.id" or "email", with their hex encoded
+// HMAC-SHA256 keyed by the secret before upload. Spans of the same user can be
+// correlated then without uploading the identifier itself. Keys are those of
+// the uploaded labels, after renaming of the well-known tags.
+func WithHashedLabels(secret []byte, keys ...string) Option {
+	return func(o *Options) {
+		o.scrubbers = append(o.scrubbers, hashLabels(secret, keys))
+	}
+}
+
+// WithSQLObfuscation returns an Option that makes the Recorder replace
+// literals of db.statement labels with ? before upload, see ObfuscateSQL.
+func WithSQLObfuscation() Option {
+	return func(o *Options) {
+		o.scrubbers = append(o.scrubbers, obfuscateSQL)
+	}
+}
+
+// WithSafeMode returns an Option that enables or disables the safe mode,
+// enabled by default. In the safe mode the Recorder strips user information
+// and values of token-like query parameters from http.url labels, and drops
+// labels of headers on the blocklist, see WithHeaderBlocklist.
+func WithSafeMode(enabled bool) Option {
+	return func(o *Options) {
+		o.safeMode = enabled
+	}
+}
+
+// WithHeaderBlocklist returns an Option that replaces DefaultHeaderBlocklist,
+// the headers whose labels are dropped in the safe mode.
+func WithHeaderBlocklist(headers ...string) Option {
+	return func(o *Options) {
+		o.headerBlocklist = headers
+	}
+}
+
+// WithMaxOperationNames returns an Option that bounds the number of distinct
+// operation names uploaded by the Recorder, for example if names are derived
+// from request paths. Spans of operations seen after the limit is reached
+// are named OtherOperation, with the operation kept as OperationLabel.
+func WithMaxOperationNames(limit int) Option {
+	return func(o *Options) {
+		o.maxOperations = limit
+	}
+}
+
+// WithSiblingAggregation returns an Option that makes the Recorder upload
+// a single span instead of at least threshold spans of the same operation
+// and parent without children, e.g. hundreds of cache lookups of a request.
+// The aggregate has labels of the number of spans and their durations, see
+// AggregateCountLabel. Only spans uploaded in the same bundle as their parent
+// are aggregated, unless children of theirs were uploaded before.
+func WithSiblingAggregation(threshold int) Option {
+	return func(o *Options) {
+		o.aggregateSiblings = threshold
+	}
+}
+
+// WithCostReport returns an Option that makes the Recorder account
+// the number and approximate size of uploaded spans per operation, see
+// Recorder.Costs, to find operations driving the cost of tracing. If the
+// interval is positive, the function is called with the costs every interval,
+// or the most expensive operations are logged if the function is nil.
+func WithCostReport(interval time.Duration, report CostReportFunc) Option {
+	return func(o *Options) {
+		o.costAccounting = true
+		o.costInterval = interval
+		o.costReport = report
+	}
+}
+
+// WithSLO returns an Option that makes the Recorder call the function with
+// every finished span slower than the threshold of its operation, including
+// spans not sampled, to alert on outliers as they happen. The threshold of
+// the empty operation applies to operations without a threshold. The function
+// is called on the goroutine finishing the span, so it should return quickly.
+func WithSLO(thresholds map[string]time.Duration, breached SLOFunc) Option {
+	return func(o *Options) {
+		o.slo = &sloHook{thresholds: thresholds, breached: breached}
+	}
+}
+
+// WithSamplingRules returns an Option that makes the Recorder upload traces
+// of spans with a tag matching one of the rules, e.g. debug=true, even if
+// the sampling rate or the sampler would drop them. Spans of the trace
+// finished before the tagged one are kept only if the trace is started by
+// the tracer of this package, which forces the trace as soon as the tag
+// is set. Other limits, like the rate limit, still apply.
+func WithSamplingRules(rules ...SamplingRule) Option {
+	return func(o *Options) {
+		o.samplingRules = append(o.samplingRules, rules...)
+	}
+}
+
+// WithDebugHeader returns an Option that makes the tracer of this package
+// force sampling of requests carrying the header, e.g. "X-Trace-Debug: 1",
+// for debugging in production on demand. The header is extracted with
+// the span context, and injected into requests of the forced traces,
+// so services using the same header upload their spans as well.
+// Unless they're behind a trusted proxy, clients can increase the cost
+// of tracing with it.
+func WithDebugHeader(header string) Option {
+	return func(o *Options) {
+		o.debugHeader = header
+	}
+}
+
+// WithUnsampledExporter returns an Option that makes the Recorder export
+// spans dropped by sampling with the exporter instead of discarding them,
+// for example to a RingBuffer keeping the last minutes of traces in full
+// to be dumped once an incident occurs. Spans are exported synchronously
+// as they're recorded, so the exporter should be cheap.
+func WithUnsampledExporter(e Exporter) Option {
+	return func(o *Options) {
+		o.unsampled = e
+	}
+}
+
+// WithRecentTraces returns an Option that makes the Recorder keep the last
+// traces it records in the buffer, including spans dropped by sampling.
+// Serve the buffer on a debug endpoint to inspect the traces locally:
+//
+//	recent := gcloudtracer.NewRecentTraces(100)
+//	http.Handle("/debug/traces", recent)
+func WithRecentTraces(rt *RecentTraces) Option {
+	return func(o *Options) {
+		o.recent = rt
+	}
+}
+
+// WithTracez returns an Option that makes the Recorder summarize the spans
+// it records by operation, sampled or not, and the Tracer count the spans
+// active. Serve the summary on a debug endpoint:
+//
+//	tz := gcloudtracer.NewTracez()
+//	http.Handle("/debug/tracez", tz)
+func WithTracez(tz *Tracez) Option {
+	return func(o *Options) {
+		o.tracez = tz
+	}
+}
+
+// WithSlowUploadThreshold returns an Option that makes the Recorder log
+// uploads slower than the threshold, including retries, and count them
+// in Stats.SlowUploads.
+func WithSlowUploadThreshold(threshold time.Duration) Option {
+	return func(o *Options) {
+		o.slowUpload = threshold
+	}
+}
+
+// WithSelfTracing returns an Option that makes the Recorder record a span
+// of every upload attempt, so latency and failures of the export show up
+// in Cloud Trace like any other dependency. The spans have the component tag
+// set to SelfTracingComponent and are sampled with the sampling rate.
+// Uploads of only such spans aren't traced.
+func WithSelfTracing() Option {
+	return func(o *Options) {
+		o.selfTracing = true
+	}
+}
+
+// WithCloudMonitoring returns an Option that makes the Recorder write its
+// health metrics to Cloud Monitoring custom metrics of the project every
+// interval, see MetricPrefix, for dashboards and alerts without Prometheus.
+// The client uses the credentials of the Recorder, and the opts instead of
+// the client options of Cloud Trace. Metrics are labeled with the host name
+// as instance.
+func WithCloudMonitoring(interval time.Duration, opts ...option.ClientOption) Option {
+	return func(o *Options) {
+		o.monitoringInterval = interval
+		o.monitoringOptions = opts
+	}
+}
+
+// WithMaxEvents returns an Option that limits the number of logs of a span
+// uploaded as events, so chatty spans don't produce dozens of event labels.
+// The policy selects the logs kept, and the number of logs dropped is set
+// as DroppedEventsLabel.
+func WithMaxEvents(max int, policy EventPolicy) Option {
+	return func(o *Options) {
+		o.maxEvents = max
+		o.eventPolicy = policy
+	}
+}
+
+// WithLabelMergePolicy returns an Option that merges labels of a span
+// colliding on the same key with the policy, instead of keeping the value
+// of the tag, see LabelMergePolicy. The separator joins values combined by
+// MergeCombine, "," if empty.
+func WithLabelMergePolicy(policy LabelMergePolicy, separator string) Option {
+	return func(o *Options) {
+		o.merge.policy = policy
+		o.merge.separator = separator
+	}
+}
+
+// WithPeerService returns an Option that sets PeerServiceLabel of spans
+// calling another service, so service dependencies can be derived from
+// exported spans. Unless set by the peer.service tag, the label is the host
+// of the peer.hostname tag, or of GRPCAuthorityTag, without the port.
+func WithPeerService() Option {
+	return func(o *Options) {
+		o.peerService = true
+	}
+}
+
+// WithLatencyBuckets returns an Option that sets LatencyBucketLabel of spans
+// to the bucket of their duration with the upper bounds, e.g. "lt_10ms",
+// "10_100ms" or "gt_1s", to filter slow requests by label in the Cloud Trace
+// console. The bounds are DefaultLatencyBuckets if none are given.
+func WithLatencyBuckets(bounds ...time.Duration) Option {
+	return func(o *Options) {
+		o.latencyBuckets = append([]time.Duration{}, bounds...)
+	}
+}
+
+// WithOperationPrefix returns an Option that prefixes names of spans with
+// an environment or service qualifier, e.g. "checkout-prod:", to tell apart
+// environments uploading to a shared project. Names already having
+// the prefix are kept.
+func WithOperationPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.operationPrefix = prefix
+	}
+}
+
+// WithMultiValueLabels returns an Option that joins values of the tags set
+// more than once with the separator, "," if empty, instead of keeping only
+// the last one, e.g. the status codes of retried requests. Tags set again
+// are joined by the tracer of this package. Values logged as fields with
+// the keys are joined for any tracer, followed by the value of the tag
+// unless it's the last value logged.
+func WithMultiValueLabels(separator string, keys ...string) Option {
+	return func(o *Options) {
+		if o.merge.multi == nil {
+			o.merge.multi = make(map[string]bool, len(keys))
+		}
+		for _, k := range keys {
+			o.merge.multi[k] = true
+		}
+		o.merge.multiSeparator = separator
+	}
+}
+
+// WithBaggageLabels returns an Option that uploads baggage items of spans
+// with keys having one of the prefixes as labels, see BaggageLabelPrefix,
+// so large or sensitive baggage isn't uploaded by accident. The empty prefix
+// allows all keys. Items are added in order of their keys as long as
+// the size of keys and values doesn't exceed maxSize bytes, if positive.
+func WithBaggageLabels(maxSize int, prefixes ...string) Option {
+	return func(o *Options) {
+		o.baggage = &baggageExport{prefixes: prefixes, maxSize: maxSize}
+	}
+}
+
+// WithProcessors returns an Option that runs the processors in order on
+// spans converted by the Recorder, after labels are scrubbed and before
+// they're uploaded, see Processor. Spans dropped by sampling aren't processed.
+func WithProcessors(processors ...Processor) Option {
+	return func(o *Options) {
+		o.processors = append(o.processors, processors...)
+	}
+}
+
+// WithStrictMode returns an Option that makes the Recorder call the function
+// with spans violating constraints of Cloud Trace, e.g. invalid identifiers,
+// kinds or timestamps, or names and labels over the size limits, with
+// the reasons, and drop them instead of uploading them corrected or
+// truncated. The spans are counted in Stats.Invalid. It's meant for testing
+// instrumentation.
+func WithStrictMode(violation ViolationFunc) Option {
+	return func(o *Options) {
+		o.strict = violation
+	}
+}
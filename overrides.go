@@ -0,0 +1,89 @@
+package gcloudtracer
+
+import (
+	"math"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"golang.org/x/net/context"
+)
+
+// Overrides holds settings of the Recorder overridden for the spans
+// of a request, for example per tenant, see ContextWithOverrides.
+type Overrides struct {
+	// ProjectID is the project spans are uploaded to, unless set by
+	// the project tag.
+	ProjectID string
+	// Labels are added to the default labels, replacing those with
+	// the same key.
+	Labels map[string]string
+	// SamplingBoost multiplies the sampling rate if greater than one.
+	SamplingBoost float64
+}
+
+// overridesTag is the tag carrying the overrides from the context
+// to the Recorder, it's never uploaded.
+const overridesTag = "gcloudtracer.overrides"
+
+type overridesKey struct{}
+
+// ContextWithOverrides returns a copy of the context holding the overrides
+// applied to spans started with StartSpanFromContext.
+func ContextWithOverrides(ctx context.Context, o Overrides) context.Context {
+	return context.WithValue(ctx, overridesKey{}, &o)
+}
+
+// OverridesFromContext returns the overrides held by the context.
+func OverridesFromContext(ctx context.Context) (Overrides, bool) {
+	o, ok := ctx.Value(overridesKey{}).(*Overrides)
+	if !ok {
+		return Overrides{}, false
+	}
+	return *o, true
+}
+
+// StartSpanFromContext starts a span like opentracing.StartSpanFromContext,
+// the span is recorded with the overrides held by the context if any.
+// It works with any tracer recording spans with the Recorder.
+func StartSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
+	if o, ok := ctx.Value(overridesKey{}).(*Overrides); ok {
+		opts = append(opts, opentracing.Tag{Key: overridesTag, Value: o})
+	}
+	return opentracing.StartSpanFromContext(ctx, operationName, opts...)
+}
+
+// spanOverrides returns the overrides the span was started with.
+func spanOverrides(tags opentracing.Tags) *Overrides {
+	o, _ := tags[overridesTag].(*Overrides)
+	return o
+}
+
+// boost returns the sampling bound multiplied by the sampling boost.
+func (o *Overrides) boost(bound uint64) uint64 {
+	if o == nil || o.SamplingBoost <= 1 {
+		return bound
+	}
+	return sampleBound(float64(bound) / math.MaxUint64 * o.SamplingBoost)
+}
+
+// defaults returns the default labels with the overridden labels.
+func (o *Overrides) defaults(labels map[string]string) map[string]string {
+	if o == nil || len(o.Labels) == 0 {
+		return labels
+	}
+	merged := make(map[string]string, len(labels)+len(o.Labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range o.Labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// project returns the overridden project, or the default one.
+func (o *Overrides) project(project string) string {
+	if o == nil || o.ProjectID == "" {
+		return project
+	}
+	return o.ProjectID
+}
@@ -0,0 +1,76 @@
+package gcloudtracer
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+func TestRecorderOverrides(t *testing.T) {
+	var mu sync.Mutex
+	var traces []*cloudtrace.Trace
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		traces = append(traces, req.Traces...)
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithSamplingRate(0.5), WithDefaultLabels(map[string]string{"env": "test", "tenant": "default"}))
+	defer srv.Close()
+
+	span := func(o *Overrides) RawSpan {
+		sp := testSpan(1, 1)
+		sp.Tags = opentracing.Tags{overridesTag: o}
+		return sp
+	}
+
+	t.Run("overrides=project", func(t *testing.T) {
+		traces = nil
+		rec.RecordSpan(span(&Overrides{ProjectID: "tenant_project", Labels: map[string]string{"tenant": "acme"}}))
+		if assert.Len(t, traces, 1) {
+			assert.Equal(t, "tenant_project", traces[0].ProjectId)
+			assert.Equal(t, map[string]string{"env": "test", "tenant": "acme"}, traces[0].Spans[0].Labels)
+		}
+	})
+
+	t.Run("overrides=sampling_boost", func(t *testing.T) {
+		traces = nil
+		sp := span(nil)
+		sp.Context.TraceID = math.MaxUint64 / 4 * 3
+		rec.RecordSpan(sp)
+		assert.Empty(t, traces)
+
+		sp = span(&Overrides{SamplingBoost: 2})
+		sp.Context.TraceID = math.MaxUint64 / 4 * 3
+		rec.RecordSpan(sp)
+		assert.Len(t, traces, 1)
+	})
+}
+
+func TestStartSpanFromContext(t *testing.T) {
+	defer opentracing.SetGlobalTracer(opentracing.GlobalTracer())
+	opentracing.SetGlobalTracer(&Tracer{ids: newRandomIDGenerator(), sample: func(uint64) bool { return true }})
+
+	o := Overrides{ProjectID: "tenant_project"}
+	ctx := ContextWithOverrides(context.Background(), o)
+	got, ok := OverridesFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, o, got)
+
+	sp, ctx := StartSpanFromContext(ctx, "parent")
+	child, _ := StartSpanFromContext(ctx, "child")
+	for _, s := range []opentracing.Span{sp, child} {
+		assert.Equal(t, "tenant_project", spanOverrides(s.(*span).raw.Tags).ProjectID)
+	}
+
+	_, ok = OverridesFromContext(context.Background())
+	assert.False(t, ok)
+}
@@ -0,0 +1,33 @@
+package gcloudtracer
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// recoverPanic recovers a panic of the pipeline, so a malformed span or
+// a buggy callback can't crash the application. The panic is logged and
+// the spans are counted as dropped. It must be deferred directly.
+func (r *Recorder) recoverPanic(stage string, spans int) {
+	if v := recover(); v != nil {
+		atomic.AddUint64(&r.stats.panicked, uint64(spans))
+		r.log.Errorf("recovered panic while %s, %d spans dropped: %v\n%s", stage, spans, v, debug.Stack())
+	}
+}
+
+// countSpans returns the number of spans of the traces.
+func countSpans(traces []*cloudtrace.Trace) int {
+	var n int
+	for _, t := range traces {
+		n += len(t.Spans)
+	}
+	return n
+}
+
+// detect runs the detector, a panic is logged as no labels detected.
+func (r *Recorder) detect(d Detector) map[string]string {
+	defer r.recoverPanic("detecting resource labels", 0)
+	return d()
+}
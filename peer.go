@@ -0,0 +1,37 @@
+package gcloudtracer
+
+import (
+	"net"
+	"strings"
+
+	"github.com/opentracing/opentracing-go/ext"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// GRPCAuthorityTag holds the authority of a gRPC call, e.g.
+// "firestore.googleapis.com:443".
+const GRPCAuthorityTag = "grpc.authority"
+
+// PeerServiceLabel holds the service a span calls, see WithPeerService.
+const PeerServiceLabel = "peer.service"
+
+// addPeerService sets the peer service label of the spans of the trace
+// without one, derived from the host or gRPC authority of their peer.
+func addPeerService(trace *cloudtrace.Trace) {
+	for _, s := range trace.Spans {
+		if s.Labels[PeerServiceLabel] != "" {
+			continue
+		}
+		peer := s.Labels[labelMap[string(ext.PeerHostname)]]
+		if peer == "" {
+			peer = s.Labels[GRPCAuthorityTag]
+		}
+		if peer == "" {
+			continue
+		}
+		if host, _, err := net.SplitHostPort(peer); err == nil {
+			peer = host
+		}
+		s.Labels[PeerServiceLabel] = strings.ToLower(peer)
+	}
+}
@@ -0,0 +1,96 @@
+package gcloudtracer
+
+import (
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// Processor processes a span converted by the Recorder before it's uploaded,
+// e.g. to redact, rename or enrich it, see WithProcessors. It reports whether
+// the span should be uploaded, the span is dropped otherwise.
+type Processor func(span *cloudtrace.TraceSpan) bool
+
+// Chain returns a Processor running the processors in order, until one of
+// them drops the span.
+func Chain(processors ...Processor) Processor {
+	return func(span *cloudtrace.TraceSpan) bool {
+		for _, p := range processors {
+			if !p(span) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// DropOperations returns a Processor dropping spans of the operations.
+func DropOperations(names ...string) Processor {
+	dropped := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		dropped[n] = struct{}{}
+	}
+	return func(span *cloudtrace.TraceSpan) bool {
+		_, ok := dropped[span.Name]
+		return !ok
+	}
+}
+
+// DropLabels returns a Processor removing the labels from spans.
+func DropLabels(keys ...string) Processor {
+	return func(span *cloudtrace.TraceSpan) bool {
+		for _, k := range keys {
+			delete(span.Labels, k)
+		}
+		return true
+	}
+}
+
+// RedactLabels returns a Processor replacing values of the labels of spans
+// with "redacted", keeping that they were set.
+func RedactLabels(keys ...string) Processor {
+	return func(span *cloudtrace.TraceSpan) bool {
+		for _, k := range keys {
+			if _, ok := span.Labels[k]; ok {
+				span.Labels[k] = redacted
+			}
+		}
+		return true
+	}
+}
+
+// RenameOperations returns a Processor renaming spans with the function
+// of their names, e.g. to strip identifiers of names.
+func RenameOperations(rename func(name string) string) Processor {
+	return func(span *cloudtrace.TraceSpan) bool {
+		span.Name = rename(span.Name)
+		return true
+	}
+}
+
+// AddLabels returns a Processor adding the labels to spans, unless set.
+func AddLabels(labels map[string]string) Processor {
+	return func(span *cloudtrace.TraceSpan) bool {
+		for k, v := range labels {
+			if _, ok := span.Labels[k]; ok {
+				continue
+			}
+			if span.Labels == nil {
+				span.Labels = make(map[string]string, len(labels))
+			}
+			span.Labels[k] = v
+		}
+		return true
+	}
+}
+
+// process runs the processors on the spans of the trace, and removes
+// the spans dropped. It reports whether any span is left.
+func (r *Recorder) process(trace *cloudtrace.Trace) bool {
+	spans := trace.Spans[:0]
+	for _, s := range trace.Spans {
+		if r.processor(s) {
+			spans = append(spans, s)
+		}
+	}
+	trace.Spans = spans
+	return len(spans) > 0
+}
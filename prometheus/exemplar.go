@@ -0,0 +1,70 @@
+// Package prometheus provides helpers attaching the trace of the current
+// span to Prometheus metrics as exemplars, so latency histograms link to
+// example traces in Grafana. The exemplars are exposed by the OpenMetrics
+// format only, see promhttp.HandlerOpts.EnableOpenMetrics.
+//
+// With the nethttp middleware starting the span, the promhttp middleware
+// observes request durations with exemplars:
+//
+//	h = promhttp.InstrumentHandlerDuration(histogram, h,
+//		promhttp.WithExemplarFromContext(prometheus.Exemplar))
+//	h = nethttp.Middleware(tracer, h)
+package prometheus
+
+import (
+	"context"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// TraceIDLabel is the exemplar label holding the trace identifier.
+const TraceIDLabel = "trace_id"
+
+// Exemplar returns the exemplar labels of the span of the context, or nil
+// if there's no span or its trace isn't sampled, so it wouldn't be found.
+func Exemplar(ctx context.Context) prom.Labels {
+	sp := opentracing.SpanFromContext(ctx)
+	if sp == nil {
+		return nil
+	}
+	traceID, ok := TraceID(sp.Context())
+	if !ok {
+		return nil
+	}
+	return prom.Labels{TraceIDLabel: traceID}
+}
+
+// TraceID returns the identifier of the trace of the span context, as
+// uploaded to Cloud Trace, if the trace is sampled.
+func TraceID(sc opentracing.SpanContext) (string, bool) {
+	if sc, ok := sc.(gcloudtracer.SpanContext); ok {
+		return sc.TraceIDString(), sc.Sampled
+	}
+	return "", false
+}
+
+// Observe observes the value, with the exemplar of the span of the context
+// if there's one and the observer supports exemplars.
+func Observe(ctx context.Context, o prom.Observer, value float64) {
+	if eo, ok := o.(prom.ExemplarObserver); ok {
+		if labels := Exemplar(ctx); labels != nil {
+			eo.ObserveWithExemplar(value, labels)
+			return
+		}
+	}
+	o.Observe(value)
+}
+
+// Add adds the value to the counter, with the exemplar of the span of
+// the context if there's one.
+func Add(ctx context.Context, c prom.Counter, value float64) {
+	if ea, ok := c.(prom.ExemplarAdder); ok {
+		if labels := Exemplar(ctx); labels != nil {
+			ea.AddWithExemplar(value, labels)
+			return
+		}
+	}
+	c.Add(value)
+}
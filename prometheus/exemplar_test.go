@@ -0,0 +1,96 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// span is a span of the span context.
+type span struct {
+	opentracing.Span
+	sc opentracing.SpanContext
+}
+
+func (s span) Context() opentracing.SpanContext {
+	return s.sc
+}
+
+func withSpan(sc opentracing.SpanContext) context.Context {
+	return opentracing.ContextWithSpan(context.Background(), span{Span: opentracing.NoopTracer{}.StartSpan("op"), sc: sc})
+}
+
+func TestExemplar(t *testing.T) {
+	sampled := gcloudtracer.SpanContext{TraceIDHigh: 1, TraceID: 2, SpanID: 3, Sampled: true}
+
+	t.Run("span=sampled", func(t *testing.T) {
+		assert.Equal(t, prom.Labels{TraceIDLabel: sampled.TraceIDString()}, Exemplar(withSpan(sampled)))
+	})
+
+	t.Run("span=unsampled", func(t *testing.T) {
+		assert.Nil(t, Exemplar(withSpan(gcloudtracer.SpanContext{TraceID: 2, SpanID: 3})))
+	})
+
+	t.Run("span=other_tracer", func(t *testing.T) {
+		assert.Nil(t, Exemplar(opentracing.ContextWithSpan(context.Background(), opentracing.NoopTracer{}.StartSpan("op"))))
+	})
+
+	t.Run("span=none", func(t *testing.T) {
+		assert.Nil(t, Exemplar(context.Background()))
+	})
+}
+
+func TestObserve(t *testing.T) {
+	sc := gcloudtracer.SpanContext{TraceID: 2, SpanID: 3, Sampled: true}
+
+	t.Run("exemplar=span", func(t *testing.T) {
+		h := prom.NewHistogram(prom.HistogramOpts{Name: "latency", Buckets: []float64{1}})
+		Observe(withSpan(sc), h, 0.5)
+
+		var m dto.Metric
+		assert.NoError(t, h.Write(&m))
+		assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+		exemplar := m.GetHistogram().GetBucket()[0].GetExemplar()
+		assert.Equal(t, TraceIDLabel, exemplar.GetLabel()[0].GetName())
+		assert.Equal(t, sc.TraceIDString(), exemplar.GetLabel()[0].GetValue())
+	})
+
+	t.Run("exemplar=none", func(t *testing.T) {
+		h := prom.NewHistogram(prom.HistogramOpts{Name: "latency", Buckets: []float64{1}})
+		Observe(context.Background(), h, 0.5)
+
+		var m dto.Metric
+		assert.NoError(t, h.Write(&m))
+		assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+		assert.Nil(t, m.GetHistogram().GetBucket()[0].GetExemplar())
+	})
+}
+
+func TestAdd(t *testing.T) {
+	sc := gcloudtracer.SpanContext{TraceID: 2, SpanID: 3, Sampled: true}
+
+	t.Run("exemplar=span", func(t *testing.T) {
+		c := prom.NewCounter(prom.CounterOpts{Name: "requests"})
+		Add(withSpan(sc), c, 2)
+
+		var m dto.Metric
+		assert.NoError(t, c.Write(&m))
+		assert.Equal(t, 2.0, m.GetCounter().GetValue())
+		assert.Equal(t, sc.TraceIDString(), m.GetCounter().GetExemplar().GetLabel()[0].GetValue())
+	})
+
+	t.Run("exemplar=none", func(t *testing.T) {
+		c := prom.NewCounter(prom.CounterOpts{Name: "requests"})
+		Add(withSpan(gcloudtracer.SpanContext{TraceID: 2, SpanID: 3}), c, 2)
+
+		var m dto.Metric
+		assert.NoError(t, c.Write(&m))
+		assert.Equal(t, 2.0, m.GetCounter().GetValue())
+		assert.Nil(t, m.GetCounter().GetExemplar())
+	})
+}
@@ -0,0 +1,198 @@
+package gcloudtracer
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// Headers of the span context, compatible with basictracer.
+const (
+	fieldTraceID       = "ot-tracer-traceid"
+	fieldSpanID        = "ot-tracer-spanid"
+	fieldSampled       = "ot-tracer-sampled"
+	fieldBaggagePrefix = "ot-baggage-"
+)
+
+// CloudTraceContextHeader is the header propagating the span context through
+// Google Cloud load balancers and services. The Tracer injects it into
+// opentracing.HTTPHeaders carriers, and extracts it if the headers
+// of basictracer are missing.
+const CloudTraceContextHeader = "X-Cloud-Trace-Context"
+
+// Inject injects the span context into the opentracing.TextMap or
+// opentracing.HTTPHeaders carrier, or the io.Writer of opentracing.Binary.
+func (t *Tracer) Inject(ctx opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	sc, ok := spanContext(ctx)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	if format == opentracing.Binary {
+		w, ok := carrier.(io.Writer)
+		if !ok {
+			return opentracing.ErrInvalidCarrier
+		}
+		return injectBinary(sc, w)
+	}
+	if format != opentracing.TextMap && format != opentracing.HTTPHeaders {
+		return opentracing.ErrUnsupportedFormat
+	}
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	if sc.TraceIDHigh != 0 {
+		w.Set(fieldTraceID, fmt.Sprintf("%016x%016x", sc.TraceIDHigh, sc.TraceID))
+	} else {
+		w.Set(fieldTraceID, strconv.FormatUint(sc.TraceID, 16))
+	}
+	w.Set(fieldSpanID, strconv.FormatUint(sc.SpanID, 16))
+	w.Set(fieldSampled, strconv.FormatBool(sc.Sampled))
+	for k, v := range sc.Baggage {
+		w.Set(fieldBaggagePrefix+k, v)
+	}
+	if sc.Debug && t.debugHeader != "" {
+		w.Set(t.debugHeader, "1")
+	}
+
+	if format == opentracing.HTTPHeaders {
+		sampled := 0
+		if sc.Sampled {
+			sampled = 1
+		}
+		w.Set(CloudTraceContextHeader, fmt.Sprintf("%s/%d;o=%d", formatTraceID(sc.TraceIDHigh, sc.TraceID), sc.SpanID, sampled))
+	}
+	return nil
+}
+
+// Extract extracts the span context from the opentracing.TextMap or
+// opentracing.HTTPHeaders carrier, or the io.Reader of opentracing.Binary.
+// The context of a carrier with just the debug header starts a new trace
+// forced to be sampled.
+func (t *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	if format == opentracing.Binary {
+		r, ok := carrier.(io.Reader)
+		if !ok {
+			return nil, opentracing.ErrInvalidCarrier
+		}
+		return extractBinary(r)
+	}
+	if format != opentracing.TextMap && format != opentracing.HTTPHeaders {
+		return nil, opentracing.ErrUnsupportedFormat
+	}
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+
+	var sc SpanContext
+	var fields int
+	var cloudTraceContext string
+	debugHeader := strings.ToLower(t.debugHeader)
+	err := r.ForeachKey(func(k, v string) error {
+		var err error
+		if k = strings.ToLower(k); k == debugHeader && debugHeader != "" {
+			sc.Debug = v != "" && v != "0" && v != "false"
+			return nil
+		}
+		switch k {
+		case fieldTraceID:
+			sc.TraceIDHigh, sc.TraceID, err = parseTraceIDHex(v)
+			fields++
+		case fieldSpanID:
+			sc.SpanID, err = strconv.ParseUint(v, 16, 64)
+			fields++
+		case fieldSampled:
+			sc.Sampled, err = strconv.ParseBool(v)
+			fields++
+		case strings.ToLower(CloudTraceContextHeader):
+			cloudTraceContext = v
+		default:
+			if strings.HasPrefix(k, fieldBaggagePrefix) {
+				if sc.Baggage == nil {
+					sc.Baggage = make(map[string]string)
+				}
+				sc.Baggage[strings.TrimPrefix(k, fieldBaggagePrefix)] = v
+			}
+		}
+		if err != nil {
+			return opentracing.ErrSpanContextCorrupted
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fields == 0 && cloudTraceContext != "" && format == opentracing.HTTPHeaders {
+		debug := sc.Debug
+		sc, err := parseCloudTraceContext(cloudTraceContext, sc.Baggage)
+		if err != nil {
+			return nil, err
+		}
+		sc.Debug = debug
+		return sc, nil
+	}
+	if fields == 0 && sc.Debug {
+		return sc, nil
+	}
+	if fields == 0 {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+	if fields < 3 {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	return sc, nil
+}
+
+// parseTraceIDHex parses the trace identifier of 64 or 128 bits in hex.
+// A 128-bit identifier with equal halves is the repeated 64-bit one,
+// see formatTraceID.
+func parseTraceIDHex(v string) (high, low uint64, err error) {
+	if len(v) <= 16 {
+		low, err = strconv.ParseUint(v, 16, 64)
+		return 0, low, err
+	}
+	if len(v) != 32 {
+		return 0, 0, ErrInvalidTraceID
+	}
+	if high, err = strconv.ParseUint(v[:16], 16, 64); err != nil {
+		return 0, 0, err
+	}
+	if low, err = strconv.ParseUint(v[16:], 16, 64); err != nil {
+		return 0, 0, err
+	}
+	if high == low {
+		high = 0
+	}
+	return high, low, nil
+}
+
+// parseCloudTraceContext parses the value of CloudTraceContextHeader,
+// "TRACE_ID/SPAN_ID;o=OPTIONS", the span is sampled if OPTIONS is 1.
+func parseCloudTraceContext(v string, baggage map[string]string) (SpanContext, error) {
+	sc := SpanContext{Baggage: baggage}
+	i := strings.IndexByte(v, '/')
+	if i < 0 {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	high, low, err := parseTraceIDHex(v[:i])
+	if err != nil || len(v[:i]) != 32 {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	sc.TraceIDHigh, sc.TraceID = high, low
+
+	span := v[i+1:]
+	if j := strings.IndexByte(span, ';'); j >= 0 {
+		sc.Sampled = span[j+1:] == "o=1"
+		span = span[:j]
+	}
+	if sc.SpanID, err = strconv.ParseUint(span, 10, 64); err != nil {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	return sc, nil
+}
@@ -0,0 +1,173 @@
+package gcloudtracer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/iterator"
+)
+
+// Reader reads traces back from the Cloud Trace project,
+// for example to verify spans were uploaded.
+type Reader struct {
+	project string
+	client  *cloudtrace.Service
+}
+
+// NewReader creates new Reader of the project, configured by the project
+// and client options: WithProject, WithJWTCredentials, WithCredentialsFromSecretManager,
+// WithKMSEncryptedCredentials and WithClientOption.
+// Other options are ignored.
+func NewReader(ctx context.Context, opts ...Option) (*Reader, error) {
+	options := defaultOptions()
+	for _, o := range opts {
+		o(&options)
+	}
+	if err := options.Valid(); err != nil {
+		return nil, err
+	}
+	if options.keySource != nil {
+		if _, err := options.keySource.tokenSource(ctx); err != nil {
+			return nil, err
+		}
+	}
+	c, err := cloudtrace.NewService(ctx, clientOptions(&options)...)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{project: options.projectID, client: c}, nil
+}
+
+// Reader returns a Reader of the project of the Recorder,
+// sharing its client.
+func (r *Recorder) Reader() (*Reader, error) {
+	c, err := r.client()
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{project: r.project, client: c}, nil
+}
+
+// Get returns the trace with all its spans.
+func (r *Reader) Get(ctx context.Context, traceID string) (*cloudtrace.Trace, error) {
+	if _, err := parseTraceID(traceID); err != nil {
+		return nil, err
+	}
+	return r.client.Projects.Traces.Get(r.project, traceID).Context(ctx).Do()
+}
+
+// TraceView defines which data of listed traces is returned.
+type TraceView string
+
+const (
+	// ViewMinimal returns trace identifiers only.
+	ViewMinimal TraceView = "MINIMAL"
+	// ViewRootspan returns the root spans.
+	ViewRootspan TraceView = "ROOTSPAN"
+	// ViewComplete returns all spans.
+	ViewComplete TraceView = "COMPLETE"
+)
+
+// TraceQuery selects traces listed by the Reader.
+type TraceQuery struct {
+	// Filter selects traces, see TraceFilter.
+	Filter TraceFilter
+	// Start and End bound the time of the traces, unless zero.
+	Start, End time.Time
+	// View defines the returned data, ViewMinimal by default.
+	View TraceView
+	// OrderBy sorts the traces, for example "start desc".
+	OrderBy string
+	// PageSize is a number of traces requested at once.
+	PageSize int64
+}
+
+// TraceFilter builds the filter of listed traces from terms, all of them
+// have to match. The zero value matches all traces.
+type TraceFilter []string
+
+// Root matches traces with the root span name starting with the prefix.
+func (f TraceFilter) Root(prefix string) TraceFilter {
+	return append(f, "root:"+quoteFilter(prefix))
+}
+
+// Span matches traces with a span name starting with the prefix.
+func (f TraceFilter) Span(prefix string) TraceFilter {
+	return append(f, "span:"+quoteFilter(prefix))
+}
+
+// MinLatency matches traces lasting at least the duration.
+func (f TraceFilter) MinLatency(d time.Duration) TraceFilter {
+	return append(f, "latency:"+d.String())
+}
+
+// Label matches traces with a span labeled by the key with a value
+// starting with the prefix.
+func (f TraceFilter) Label(key, prefix string) TraceFilter {
+	return append(f, quoteFilter(key)+":"+quoteFilter(prefix))
+}
+
+// String returns the filter as expected by the API.
+func (f TraceFilter) String() string {
+	return strings.Join(f, " ")
+}
+
+// quoteFilter quotes the value of a filter term if it contains spaces or quotes.
+func quoteFilter(v string) string {
+	if strings.ContainsAny(v, ` "\`) {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	}
+	return v
+}
+
+// List returns an iterator of the traces selected by the query.
+func (r *Reader) List(ctx context.Context, q TraceQuery) *TraceIterator {
+	call := r.client.Projects.Traces.List(r.project).Context(ctx)
+	if len(q.Filter) > 0 {
+		call = call.Filter(q.Filter.String())
+	}
+	if !q.Start.IsZero() {
+		call = call.StartTime(formatTimestamp(q.Start))
+	}
+	if !q.End.IsZero() {
+		call = call.EndTime(formatTimestamp(q.End))
+	}
+	if q.View != "" {
+		call = call.View(string(q.View))
+	}
+	if q.OrderBy != "" {
+		call = call.OrderBy(q.OrderBy)
+	}
+	if q.PageSize > 0 {
+		call = call.PageSize(q.PageSize)
+	}
+	return &TraceIterator{call: call}
+}
+
+// TraceIterator iterates over listed traces, requesting them page by page.
+type TraceIterator struct {
+	call  *cloudtrace.ProjectsTracesListCall
+	page  []*cloudtrace.Trace
+	token string
+	done  bool
+}
+
+// Next returns the next trace, or iterator.Done once all traces are returned.
+func (it *TraceIterator) Next() (*cloudtrace.Trace, error) {
+	for len(it.page) == 0 {
+		if it.done {
+			return nil, iterator.Done
+		}
+		resp, err := it.call.PageToken(it.token).Do()
+		if err != nil {
+			return nil, err
+		}
+		it.page, it.token = resp.Traces, resp.NextPageToken
+		it.done = it.token == ""
+	}
+	t := it.page[0]
+	it.page = it.page[1:]
+	return t, nil
+}
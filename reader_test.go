@@ -0,0 +1,157 @@
+package gcloudtracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/iterator"
+)
+
+func TestReader(t *testing.T) {
+	traceID := "00000000000000010000000000000001"
+	var queries []string
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/projects/test_project/traces/"+traceID {
+			json.NewEncoder(w).Encode(&cloudtrace.Trace{ProjectId: "test_project", TraceId: traceID})
+			return
+		}
+		queries = append(queries, r.URL.Query().Encode())
+		resp := &cloudtrace.ListTracesResponse{Traces: []*cloudtrace.Trace{{TraceId: "a"}, {TraceId: "b"}}, NextPageToken: "next"}
+		if r.URL.Query().Get("pageToken") == "next" {
+			resp = &cloudtrace.ListTracesResponse{Traces: []*cloudtrace.Trace{{TraceId: "c"}}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	defer srv.Close()
+
+	reader, err := rec.Reader()
+	assert.NoError(t, err)
+
+	t.Run("call=get", func(t *testing.T) {
+		trace, err := reader.Get(context.Background(), traceID)
+		assert.NoError(t, err)
+		assert.Equal(t, traceID, trace.TraceId)
+
+		_, err = reader.Get(context.Background(), "invalid")
+		assert.Equal(t, ErrInvalidTraceID, err)
+	})
+
+	t.Run("call=list", func(t *testing.T) {
+		it := reader.List(context.Background(), TraceQuery{
+			Filter: TraceFilter{}.Root("GET /").Label("env", "test"),
+			Start:  time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+			View:   ViewComplete,
+		})
+		var ids []string
+		for {
+			trace, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if !assert.NoError(t, err) {
+				break
+			}
+			ids = append(ids, trace.TraceId)
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, ids)
+		if assert.Len(t, queries, 2) {
+			assert.Contains(t, queries[0], "filter=root%3A%22GET+%2F%22+env%3Atest")
+			assert.Contains(t, queries[0], "startTime=2018-01-02T03%3A04%3A05Z")
+			assert.Contains(t, queries[0], "view=COMPLETE")
+			assert.Contains(t, queries[1], "pageToken=next")
+		}
+	})
+}
+
+func TestTraceFilter(t *testing.T) {
+	assert.Equal(t, "", TraceFilter{}.String())
+	assert.Equal(t,
+		`span:db latency:1.5s /http/status_code:500 "user name":"a \"b\""`,
+		TraceFilter{}.Span("db").MinLatency(1500*time.Millisecond).Label("/http/status_code", "500").Label("user name", `a "b"`).String(),
+	)
+}
+
+func TestRecorderExportVerification(t *testing.T) {
+	failures := make(chan string, 1)
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "not found"}}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithExportVerification(10*time.Millisecond, func(project, traceID string, err error) {
+		assert.True(t, errors.Is(err, ErrTraceNotVisible))
+		failures <- project + "/" + traceID
+	}))
+	defer srv.Close()
+	defer rec.Close()
+
+	rec.RecordSpan(testSpan(1, 1))
+	select {
+	case f := <-failures:
+		assert.Equal(t, "test_project/00000000000000010000000000000001", f)
+	case <-time.After(time.Second):
+		t.Error("verification failure not reported")
+	}
+}
+
+func TestRecorderFallbackVerification(t *testing.T) {
+	failures := make(chan string, 1)
+	var buf bytes.Buffer
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "not found"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithSynchronousUpload(), WithFallback(NewWriterExporter(&buf), 0), WithCostReport(time.Hour, nil),
+		WithExportVerification(10*time.Millisecond, func(project, traceID string, err error) {
+			failures <- project + "/" + traceID
+		}))
+	defer srv.Close()
+	defer rec.Close()
+
+	rec.RecordSpan(testSpan(1, 1))
+	assert.Contains(t, buf.String(), `"traceId":"00000000000000010000000000000001"`)
+	stats := rec.Stats()
+	assert.Equal(t, uint64(0), stats.Uploads)
+	assert.Equal(t, uint64(0), stats.UploadedSpans)
+	assert.Equal(t, uint64(1), stats.FallbackExports)
+	assert.Equal(t, uint64(1), stats.FallbackSpans)
+	assert.Empty(t, rec.Costs())
+
+	select {
+	case f := <-failures:
+		t.Errorf("trace exported with the fallback exporter verified: %s", f)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRecorderShutdownDuringVerification(t *testing.T) {
+	reading := make(chan struct{})
+	release := make(chan struct{})
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			close(reading)
+			<-release
+		}
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithExportVerification(100*time.Millisecond, func(project, traceID string, err error) {}))
+	defer srv.Close()
+	defer close(release)
+
+	rec.RecordSpan(testSpan(1, 1))
+	<-reading
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, rec.Shutdown(ctx))
+}
@@ -0,0 +1,196 @@
+package gcloudtracer
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// maxRecentSpans bounds the number of spans kept of a recent trace.
+const maxRecentSpans = 1000
+
+// RecentTrace is a trace recently recorded by the Recorder.
+type RecentTrace struct {
+	ProjectID string                  `json:"projectId"`
+	TraceID   string                  `json:"traceId"`
+	Sampled   bool                    `json:"sampled"`
+	Spans     []*cloudtrace.TraceSpan `json:"spans"`
+}
+
+// RecentTraces keeps the last traces recorded by the Recorder in memory,
+// sampled or not, see WithRecentTraces. It's an http.Handler rendering
+// them for debugging without a round trip to Cloud Trace.
+type RecentTraces struct {
+	size int
+
+	mu     sync.Mutex
+	traces map[string]*RecentTrace
+	// order lists identifiers of the traces, the oldest first.
+	order []string
+}
+
+// NewRecentTraces creates new buffer of the last size traces.
+func NewRecentTraces(size int) *RecentTraces {
+	return &RecentTraces{size: size, traces: make(map[string]*RecentTrace, size)}
+}
+
+// add keeps the spans of the trace, evicting the oldest trace if full.
+// The spans are copied, as the trace is modified on upload.
+func (rt *RecentTraces) add(trace *cloudtrace.Trace, sampled bool) {
+	if rt.size <= 0 {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	t := rt.traces[trace.TraceId]
+	if t == nil {
+		if len(rt.order) >= rt.size {
+			delete(rt.traces, rt.order[0])
+			rt.order[0] = ""
+			rt.order = rt.order[1:]
+		}
+		t = &RecentTrace{ProjectID: trace.ProjectId, TraceID: trace.TraceId}
+		rt.traces[trace.TraceId] = t
+		rt.order = append(rt.order, trace.TraceId)
+	}
+	t.Sampled = t.Sampled || sampled
+	for _, s := range trace.Spans {
+		if len(t.Spans) == maxRecentSpans {
+			break
+		}
+		sp := *s
+		t.Spans = append(t.Spans, &sp)
+	}
+}
+
+// Traces returns copies of the recent traces, the newest first.
+func (rt *RecentTraces) Traces() []RecentTrace {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	traces := make([]RecentTrace, 0, len(rt.order))
+	for i := len(rt.order) - 1; i >= 0; i-- {
+		t := *rt.traces[rt.order[i]]
+		t.Spans = append([]*cloudtrace.TraceSpan(nil), t.Spans...)
+		traces = append(traces, t)
+	}
+	return traces
+}
+
+// Trace returns a copy of the recent trace.
+func (rt *RecentTraces) Trace(traceID string) (RecentTrace, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	t, ok := rt.traces[traceID]
+	if !ok {
+		return RecentTrace{}, false
+	}
+	trace := *t
+	trace.Spans = append([]*cloudtrace.TraceSpan(nil), t.Spans...)
+	return trace, true
+}
+
+// ServeHTTP lists the recent traces, or renders the waterfall of the trace
+// of the "trace" query parameter. The traces are rendered as JSON instead
+// if the "format" query parameter is "json".
+func (rt *RecentTraces) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	asJSON := r.URL.Query().Get("format") == "json"
+	traceID := r.URL.Query().Get("trace")
+	if traceID == "" {
+		traces := rt.Traces()
+		if asJSON {
+			writeJSON(w, traces)
+			return
+		}
+		renderTemplate(w, recentTracesTemplate, traces)
+		return
+	}
+
+	t, ok := rt.Trace(traceID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if asJSON {
+		writeJSON(w, t)
+		return
+	}
+	renderTemplate(w, waterfallTemplate, newWaterfall(t))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func renderTemplate(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// waterfall is a trace with spans positioned on its timeline.
+type waterfall struct {
+	RecentTrace
+	Duration time.Duration
+	Bars     []waterfallBar
+}
+
+type waterfallBar struct {
+	Span     *cloudtrace.TraceSpan
+	Duration time.Duration
+	// Offset and Width are percentages of the trace duration.
+	Offset, Width float64
+}
+
+func newWaterfall(t RecentTrace) waterfall {
+	sortSpans(t.Spans)
+	wf := waterfall{RecentTrace: t}
+	if len(t.Spans) == 0 {
+		return wf
+	}
+	start, end := parseTimestamp(t.Spans[0].StartTime), parseTimestamp(t.Spans[0].EndTime)
+	for _, s := range t.Spans[1:] {
+		if e := parseTimestamp(s.EndTime); e.After(end) {
+			end = e
+		}
+	}
+	wf.Duration = end.Sub(start)
+	for _, s := range t.Spans {
+		b := waterfallBar{Span: s, Duration: parseTimestamp(s.EndTime).Sub(parseTimestamp(s.StartTime))}
+		if wf.Duration > 0 {
+			b.Offset = 100 * float64(parseTimestamp(s.StartTime).Sub(start)) / float64(wf.Duration)
+			b.Width = 100 * float64(b.Duration) / float64(wf.Duration)
+		}
+		wf.Bars = append(wf.Bars, b)
+	}
+	return wf
+}
+
+var recentTracesTemplate = template.Must(template.New("traces").Parse(`<!DOCTYPE html>
+<html><head><title>Recent traces</title></head><body>
+<h1>Recent traces</h1>
+<table>
+<tr><th>Trace</th><th>Project</th><th>Spans</th><th>Sampled</th></tr>
+{{range .}}<tr><td><a href="?trace={{.TraceID}}">{{.TraceID}}</a></td><td>{{.ProjectID}}</td><td>{{len .Spans}}</td><td>{{.Sampled}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+var waterfallTemplate = template.Must(template.New("waterfall").Parse(`<!DOCTYPE html>
+<html><head><title>Trace {{.TraceID}}</title></head><body>
+<h1>Trace {{.TraceID}}</h1>
+<p>Project {{.ProjectID}}, {{.Duration}}, sampled: {{.Sampled}}. <a href="?">All traces</a></p>
+<table style="width: 100%">
+{{range .Bars}}<tr title="{{range $k, $v := .Span.Labels}}{{$k}}={{$v}} {{end}}">
+<td style="width: 30%">{{.Span.Name}}</td><td style="width: 10%">{{.Duration}}</td>
+<td><div style="margin-left: {{printf "%.2f" .Offset}}%; width: {{printf "%.2f" .Width}}%; min-width: 1px; background: #4285f4">&nbsp;</div></td>
+</tr>
+{{end}}</table>
+</body></html>
+`))
@@ -0,0 +1,77 @@
+package gcloudtracer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentTraces(t *testing.T) {
+	recent := NewRecentTraces(2)
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithRecentTraces(recent))
+	defer srv.Close()
+
+	root := testSpan(1, 1)
+	root.Operation = "root"
+	child := testSpan(1, 2)
+	child.ParentSpanID = 1
+	child.Operation = "child"
+	child.Context.Sampled = false
+	rec.RecordSpan(child)
+	rec.RecordSpan(root)
+	rec.RecordSpan(testSpan(2, 1))
+	rec.RecordSpan(testSpan(3, 1))
+
+	traces := recent.Traces()
+	if assert.Len(t, traces, 2) {
+		assert.Equal(t, "00000000000000030000000000000003", traces[0].TraceID)
+		assert.Equal(t, "00000000000000020000000000000002", traces[1].TraceID)
+	}
+
+	recent = NewRecentTraces(2)
+	rec, srv = newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithRecentTraces(recent))
+	defer srv.Close()
+	rec.RecordSpan(child)
+	rec.RecordSpan(root)
+	traceID := "00000000000000010000000000000001"
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		recent.ServeHTTP(w, httptest.NewRequest("GET", "/debug/traces"+query, nil))
+		return w
+	}
+
+	t.Run("view=list", func(t *testing.T) {
+		w := get("")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `href="?trace=`+traceID+`"`)
+	})
+
+	t.Run("view=trace_json", func(t *testing.T) {
+		var trace RecentTrace
+		assert.NoError(t, json.NewDecoder(get("?format=json&trace="+traceID).Body).Decode(&trace))
+		assert.True(t, trace.Sampled)
+		var names []string
+		for _, s := range trace.Spans {
+			names = append(names, s.Name)
+		}
+		assert.Equal(t, []string{"child", "root"}, names)
+	})
+
+	t.Run("view=waterfall", func(t *testing.T) {
+		body := get("?trace=" + traceID).Body.String()
+		assert.True(t, strings.Index(body, "root") < strings.Index(body, "child"), body)
+	})
+
+	t.Run("view=missing", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("?trace=missing").Code)
+	})
+}
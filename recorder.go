@@ -4,41 +4,134 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"math"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	basictracer "github.com/opentracing/basictracer-go"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"golang.org/x/oauth2/jwt"
 	cloudtrace "google.golang.org/api/cloudtrace/v1"
-	"google.golang.org/api/support/bundler"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
 )
 
-var _ basictracer.SpanRecorder = &Recorder{}
+var (
+	_ SpanRecorder = &Recorder{}
+	_ io.Closer    = &Recorder{}
+)
+
+// Tags of HTTP spans besides those of opentracing.ext, uploaded as labels
+// the Cloud Trace console knows, see the nethttp package.
+const (
+	HTTPRequestSizeTag  = "http.request.size"
+	HTTPResponseSizeTag = "http.response.size"
+	HTTPRouteTag        = "http.route"
+	// HTTPRetryCountTag holds the number of previous attempts of the request.
+	HTTPRetryCountTag = "http.retry_count"
+)
 
 var labelMap = map[string]string{
 	string(ext.PeerHostname):   `trace.cloud.google.com/http/host`,
 	string(ext.HTTPMethod):     `trace.cloud.google.com/http/method`,
 	string(ext.HTTPStatusCode): `trace.cloud.google.com/http/status_code`,
 	string(ext.HTTPUrl):        `trace.cloud.google.com/http/url`,
+	HTTPRequestSizeTag:         `trace.cloud.google.com/http/request/size`,
+	HTTPResponseSizeTag:        `trace.cloud.google.com/http/response/size`,
+	HTTPRouteTag:               `trace.cloud.google.com/http/route`,
 }
 
-// Recorder implements basictracer.SpanRecorder interface
+// Recorder implements SpanRecorder interface
 // used to write traces to the GCE StackDriver.
+//
+// Recorded spans are buffered until they are uploaded in background,
+// or explicitly with Flush. Once the Recorder is closed with Close or
+// Shutdown, buffered spans are uploaded, recording spans does nothing
+// and other operations return ErrRecorderClosed.
 type Recorder struct {
+	// accessed atomically, kept first for alignment
+	failures uint64
+	stats    counters
+
 	project     string
-	ctx         context.Context
-	log         Logger
-	traceClient *cloudtrace.Service
-	bundler     *bundler.Bundler
+	projectTag  string
+	detected    map[string]string
+	settings    atomic.Value // *settings
+	synchronous bool
+	limiter     *rateLimiter
+	spanLimit   *spanLimiter
+	budget      *budgeter
+	fallback    *fallback
+	converter   SpanConverter
+	spanKind    SpanKindFunc
+	uploaded    *uploadedSpans
+	synthetic   bool
+	validate    bool
+	ids         IDGenerator
+	verifier    *exportVerifier
+	audit       AuditFunc
+	scrubbers   []labelScrubber
+	names       *nameGuard
+	aggregate   int
+	costs       *costAccounting
+	slo         *sloHook
+	forced      *forcedTraces
+	unsampled   Exporter
+	recent      *RecentTraces
+	tracez      *Tracez
+	slowUpload  time.Duration
+	selfTracing bool
+	metrics     *metricsWriter
+	maxEvents   int
+	eventPolicy EventPolicy
+	merge       labelMerge
+	peerService bool
+	latency     *latencyBuckets
+	prefix      string
+	baggage     *baggageExport
+	processor   Processor
+	strict      ViolationFunc
+
+	maxAttempts  int
+	retryBackoff time.Duration
+	ctx          context.Context
+	log          Logger
+	newClient    func() (*cloudtrace.Service, error)
+	v2           bool
+	newClientV2  func() (*cloudtracev2.Service, error)
+
+	clientMu      sync.Mutex
+	traceClient   *cloudtrace.Service
+	traceClientV2 *cloudtracev2.Service
+	// clientOptions holds the credentials and client options of the options,
+	// kept for the clients rebuilt by WatchConfig.
+	clientOptions Options
+	// created holds the settings options the Recorder was created with,
+	// Reload applies options over them.
+	created Options
+
+	bundlerOptions Options
+	shared         *traceBundler
+
+	closeMu sync.RWMutex
+	closed  bool
+
+	// stopRetries is closed once the context of Shutdown is done,
+	// so uploads don't wait for their next attempt.
+	stopRetries     chan struct{}
+	stopRetriesOnce sync.Once
+
+	lastErr atomic.Value
+
+	mu       sync.Mutex
+	bundlers map[string]*traceBundler
 }
 
 // NewRecorder creates new GCloud StackDriver recorder.
 func NewRecorder(ctx context.Context, opts ...Option) (*Recorder, error) {
-	var options Options
+	options := defaultOptions()
 	for _, o := range opts {
 		o(&options)
 	}
@@ -48,142 +141,874 @@ func NewRecorder(ctx context.Context, opts ...Option) (*Recorder, error) {
 	if options.log == nil {
 		options.log = &defaultLogger{}
 	}
-
-	// Your credentials should be obtained from the Google
-	// Developer Console (https://console.developers.google.com).
-	conf := &jwt.Config{
-		Email:        options.credentials.Email,
-		PrivateKey:   options.credentials.PrivateKey,
-		PrivateKeyID: options.credentials.PrivateKeyID,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/trace.append",
-			"https://www.googleapis.com/auth/trace.readonly",
-			"https://www.googleapis.com/auth/cloud-platform",
-		},
-		TokenURL: google.JWTTokenURL,
+	if options.idGenerator == nil {
+		options.idGenerator = newRandomIDGenerator()
 	}
-
-	c, err := cloudtrace.New(conf.Client(oauth2.NoContext))
-	if err != nil {
-		return nil, err
+	if options.newClient == nil {
+		options.newClient = clientFactory(ctx, &options)
+	}
+	if options.newClientV2 == nil {
+		options.newClientV2 = clientFactoryV2(ctx, &options)
 	}
 
 	rec := &Recorder{
 		project:     options.projectID,
+		projectTag:  options.projectTag,
+		detected:    make(map[string]string),
+		synchronous: options.synchronous,
+		converter:   options.converter,
+		spanKind:    options.spanKind,
+		validate:    options.validate,
+		aggregate:   options.aggregateSiblings,
+		ids:         options.idGenerator,
+		audit:       options.audit,
+		slo:         options.slo,
+		unsampled:   options.unsampled,
+		recent:      options.recent,
+		tracez:      options.tracez,
+		slowUpload:  options.slowUpload,
+		selfTracing: options.selfTracing,
+		maxEvents:   options.maxEvents,
+		eventPolicy: options.eventPolicy,
+		merge:       options.merge,
+		peerService: options.peerService,
+		prefix:      options.operationPrefix,
+		baggage:     options.baggage,
+		strict:      options.strict,
 		ctx:         ctx,
-		traceClient: c,
+		newClient:   options.newClient,
+		v2:          options.v2,
+		newClientV2: options.newClientV2,
 		log:         options.log,
+
+		clientOptions: Options{
+			credentials:   options.credentials,
+			keySource:     options.keySource,
+			clientOptions: options.clientOptions,
+		},
+		created: Options{
+			samplingRate: options.samplingRate,
+			filters:      options.filters,
+			labels:       options.labels,
+			debug:        options.debug,
+		},
+
+		maxAttempts:  options.maxAttempts,
+		retryBackoff: options.retryBackoff,
+		stopRetries:  make(chan struct{}),
+
+		bundlerOptions: options,
+		bundlers:       make(map[string]*traceBundler),
+	}
+	for _, d := range options.detectors {
+		for k, v := range rec.detect(d) {
+			rec.detected[k] = v
+		}
+	}
+	if options.safeMode {
+		blocklist := options.headerBlocklist
+		if blocklist == nil {
+			blocklist = DefaultHeaderBlocklist
+		}
+		rec.scrubbers = append(rec.scrubbers, safeLabels(blocklist))
+	}
+	rec.scrubbers = append(rec.scrubbers, options.scrubbers...)
+	if options.shared != nil {
+		rec.shared = options.shared.tb
+	}
+	if len(options.samplingRules) > 0 || options.debugHeader != "" {
+		rec.forced = newForcedTraces(options.samplingRules)
+	}
+	if options.maxOperations > 0 {
+		rec.names = newNameGuard(options.maxOperations)
+	}
+	if len(options.processors) > 0 {
+		rec.processor = Chain(options.processors...)
+	}
+	if options.latencyBuckets != nil {
+		rec.latency = newLatencyBuckets(options.latencyBuckets)
 	}
+	if options.maxSpansPerTrace > 0 {
+		rec.spanLimit = newSpanLimiter(options.maxSpansPerTrace, traceCountWindow)
+	}
+	if options.syntheticRoots || options.aggregateSiblings > 1 {
+		rec.uploaded = newUploadedSpans()
+		rec.synthetic = options.syntheticRoots
+	}
+	if options.fallback != nil {
+		rec.fallback = &fallback{exporter: options.fallback, after: options.fallbackAfter}
+	}
+	if options.dailyBudget > 0 {
+		rec.budget = newBudgeter(options.dailyBudget)
+	}
+	if options.verifyInterval > 0 {
+		rec.verifier = &exportVerifier{
+			interval:  options.verifyInterval,
+			onFailure: options.onVerifyFailure,
+			stop:      make(chan struct{}),
+			done:      make(chan struct{}),
+		}
+		if rec.verifier.onFailure == nil {
+			rec.verifier.onFailure = func(project, traceID string, err error) {
+				rec.log.Errorf("failed to verify upload of trace %s to project %s: %s", traceID, project, err)
+			}
+		}
+	}
+	if options.costAccounting {
+		rec.costs = newCostAccounting(options.costInterval, options.costReport)
+		if rec.costs.report == nil {
+			rec.costs.report = rec.logCosts
+		}
+	}
+	if options.rateLimit > 0 {
+		rec.limiter = newRateLimiter(options.rateLimit, options.rateBurst)
+	}
+	rec.settings.Store(rec.newSettings(&options))
 
-	bundler := bundler.NewBundler((*cloudtrace.Trace)(nil), func(bundle interface{}) {
-		traces := bundle.([]*cloudtrace.Trace)
-		err := rec.upload(traces)
-		if err != nil {
-			rec.log.Errorf("failed to upload %d traces to the Cloud Trace server. (err = %s)", len(traces), err)
+	if !options.lazyClient {
+		if options.keySource != nil {
+			if _, err := options.keySource.tokenSource(ctx); err != nil {
+				return nil, err
+			}
 		}
-	})
-	bundler.DelayThreshold = 2 * time.Second
-	bundler.BundleCountThreshold = 100
-	// We're not measuring bytes here, we're counting traces and spans as one "byte" each.
-	bundler.BundleByteThreshold = 1000
-	bundler.BundleByteLimit = 1000
-	bundler.BufferedByteLimit = 10000
-	rec.bundler = bundler
+		if _, err := rec.client(); err != nil {
+			return nil, err
+		}
+		if options.v2 {
+			if _, err := rec.clientV2(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if options.preflight {
+		if err := rec.Verify(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if rec.verifier != nil {
+		go rec.runVerifier()
+	}
+	if options.monitoringInterval > 0 {
+		rec.metrics = newMetricsWriter(ctx, &options)
+		go rec.runMetrics()
+	}
+	if rec.costs != nil && rec.costs.interval > 0 {
+		go rec.runCostReport()
+	}
 
 	return rec, nil
 }
 
 // RecordSpan writes Span to the GCLoud StackDriver.
-func (r *Recorder) RecordSpan(sp basictracer.RawSpan) {
-	if !sp.Context.Sampled {
+// Unless the synchronous upload is enabled, it never waits for the network,
+// and blocks at most for the wait set by WithBlockOnOverflow.
+// The span is converted before RecordSpan returns and none of its tags
+// or logs are referenced afterwards, so the caller may reuse or mutate them.
+func (r *Recorder) RecordSpan(sp RawSpan) {
+	if r.slo != nil {
+		r.checkSLO(sp)
+	}
+	if r.tracez != nil {
+		r.tracez.record(sp, sp.Context.TraceIDString())
+	}
+	forced := r.forced != nil && r.forced.check(sp.Context.TraceID, sp.Tags)
+	sampled := sp.Context.Sampled || forced
+	if !sampled && r.unsampled == nil && r.recent == nil {
+		atomic.AddUint64(&r.stats.unsampled, 1)
+		return
+	}
+
+	r.closeMu.RLock()
+	defer r.closeMu.RUnlock()
+	if r.closed {
+		atomic.AddUint64(&r.stats.closed, 1)
+		return
+	}
+	defer r.recoverPanic("recording span", 1)
+
+	set := r.currentSettings()
+	ov := spanOverrides(sp.Tags)
+	if !sampled {
+		atomic.AddUint64(&r.stats.unsampled, 1)
+		r.recordUnsampled(sp, set, ov)
+		return
+	}
+	if !forced && !inSample(sp.Context.TraceID, ov.boost(set.sampleBound)) {
+		atomic.AddUint64(&r.stats.unsampled, 1)
+		r.debugf("trace %016x dropped by sampling rate", sp.Context.TraceID)
+		if r.unsampled != nil || r.recent != nil {
+			r.recordUnsampled(sp, set, ov)
+		}
+		return
+	}
+	for _, f := range set.filters {
+		if !f(sp) {
+			atomic.AddUint64(&r.stats.filtered, 1)
+			r.debugf("span %016x dropped by filter", sp.Context.SpanID)
+			return
+		}
+	}
+	if r.spanLimit != nil && !r.spanLimit.allow(sp.Context.TraceID, sp.Context.SpanID, sp.ParentSpanID) {
+		atomic.AddUint64(&r.stats.traceLimited, 1)
+		r.debugf("span %016x dropped by limit of spans per trace", sp.Context.SpanID)
 		return
 	}
+	if r.limiter != nil && !r.limiter.allow() {
+		atomic.AddUint64(&r.stats.rateLimited, 1)
+		r.debugf("span %016x dropped by rate limit", sp.Context.SpanID)
+		return
+	}
+	if r.budget != nil && !r.budget.take(sp.Context.TraceID) {
+		atomic.AddUint64(&r.stats.budgetThrottled, 1)
+		r.debugf("span %016x dropped by daily budget", sp.Context.SpanID)
+		return
+	}
+
+	project, trace := r.convert(&sp, set, ov)
+	if trace == nil {
+		atomic.AddUint64(&r.stats.conversionFailed, 1)
+		r.debugf("span %016x dropped by converter", sp.Context.SpanID)
+		return
+	}
+	r.scrub(trace)
+	if r.processor != nil && !r.process(trace) {
+		atomic.AddUint64(&r.stats.filtered, 1)
+		r.debugf("span %016x dropped by processor", sp.Context.SpanID)
+		return
+	}
+	if r.names != nil {
+		r.bucketOperations(trace)
+	}
+	if r.strict != nil && !r.checkStrict(project, trace) {
+		r.debugf("span %016x dropped by strict mode", sp.Context.SpanID)
+		return
+	}
+	if r.recent != nil {
+		r.recent.add(trace, true)
+	}
+	r.enqueue(project, sp.Context.TraceID, trace, r.convertV2(trace, &sp))
+}
+
+// recordUnsampled keeps the span dropped by sampling in the recent traces,
+// and exports it with the exporter of unsampled spans, see WithRecentTraces
+// and WithUnsampledExporter.
+func (r *Recorder) recordUnsampled(sp RawSpan, set *settings, ov *Overrides) {
+	_, trace := r.convert(&sp, set, ov)
+	if trace == nil {
+		return
+	}
+	r.scrub(trace)
+	if r.recent != nil {
+		r.recent.add(trace, false)
+	}
+	if r.unsampled == nil {
+		return
+	}
+	if err := r.export(r.unsampled, trace.ProjectId, []*cloudtrace.Trace{trace}); err != nil {
+		r.log.Errorf("failed to export unsampled span %016x: %s", sp.Context.SpanID, err)
+	}
+}
+
+// convert converts the span into a trace uploaded to the project,
+// applying the overrides the span was started with if any. Logs of the span
+// over the limit of events are dropped, see WithMaxEvents.
+func (r *Recorder) convert(sp *RawSpan, set *settings, ov *Overrides) (string, *cloudtrace.Trace) {
+	dropped := r.sampleEvents(sp)
+	project := ov.project(r.project)
+	if r.converter == nil {
+		trace := convertSpan(*sp, project, r.projectTag, ov.defaults(set.labels), r.spanKind, r.merge)
+		r.annotate(trace, sp, dropped)
+		return trace.ProjectId, trace
+	}
+
+	trace := r.converter.ConvertSpan(*sp)
+	if trace == nil {
+		return "", nil
+	}
+	r.annotate(trace, sp, dropped)
+	if trace.ProjectId == "" {
+		trace.ProjectId = project
+	}
+	if ov != nil {
+		for _, s := range trace.Spans {
+			for k, v := range ov.Labels {
+				if s.Labels == nil {
+					s.Labels = make(map[string]string, len(ov.Labels))
+				}
+				if vv, ok := s.Labels[k]; ok {
+					v = r.merge.merge(v, vv)
+				}
+				s.Labels[k] = v
+			}
+		}
+	}
+	return trace.ProjectId, trace
+}
 
-	traceID := fmt.Sprintf("%016x%016x", sp.Context.TraceID, sp.Context.TraceID)
-	labels := convertTags(sp.Tags)
-	transposeLabels(labels)
-	addLogs(labels, sp.Logs)
+// annotate sets the labels derived from the span on the trace converted
+// from it, see WithMaxEvents, WithPeerService, WithLatencyBuckets,
+// WithBaggageLabels and WithV2API, and prefixes its name,
+// see WithOperationPrefix.
+func (r *Recorder) annotate(trace *cloudtrace.Trace, sp *RawSpan, droppedEvents int) {
+	if r.v2 {
+		addTypedLabels(trace, sp.Tags)
+	}
+	if r.prefix != "" {
+		prefixOperations(trace, r.prefix)
+	}
+	addDroppedEvents(trace, droppedEvents)
+	if r.peerService {
+		addPeerService(trace)
+	}
+	if r.latency != nil {
+		r.latency.label(trace, sp.Duration)
+	}
+	if r.baggage != nil {
+		r.baggage.label(trace, sp.Context.Baggage)
+	}
+}
+
+// convertSpan converts the span into a trace of the project, or of the project
+// set by the project tag. Default labels are added, merged with the merge
+// policy if set by the span. Invalid timestamps are corrected,
+// see TimestampWarningLabel.
+func convertSpan(sp RawSpan, project, projectTag string, defaults map[string]string, kind SpanKindFunc, merge labelMerge) *cloudtrace.Trace {
+	traceID := sp.Context.TraceIDString()
+	labels := convertTags(sp.Tags, len(sp.Logs)+len(defaults))
+	merge.joinLogs(labels, sp.Logs)
+	if projectTag != "" {
+		if p := labels[projectTag]; p != "" {
+			project = p
+		}
+		delete(labels, projectTag)
+	}
+	transposeLabels(labels, merge)
+	for k, v := range defaults {
+		if vv, ok := labels[k]; ok {
+			v = merge.merge(v, vv)
+		}
+		labels[k] = v
+	}
+	addLogs(labels, sp.Logs, sp.Start)
+	start, end, warning := spanTimes(&sp)
+	if warning != "" {
+		labels[TimestampWarningLabel] = warning
+	}
 
 	trace := &cloudtrace.Trace{
-		ProjectId: r.project,
+		ProjectId: project,
 		TraceId:   traceID,
 		Spans: []*cloudtrace.TraceSpan{
 			{
 				SpanId:       sp.Context.SpanID,
-				Kind:         convertSpanKind(sp.Tags),
+				Kind:         kind(sp.Tags),
 				Name:         sp.Operation,
-				StartTime:    sp.Start.Format(time.RFC3339Nano),
-				EndTime:      sp.Start.Add(sp.Duration).Format(time.RFC3339Nano),
+				StartTime:    formatTimestamp(start),
+				EndTime:      formatTimestamp(end),
 				ParentSpanId: sp.ParentSpanID,
 				Labels:       labels,
 			},
 		},
 	}
 
-	err := r.bundler.Add(trace, 2) // size = (1 trace + 1 span)
-	if err == bundler.ErrOverflow {
-		r.log.Errorf("trace upload bundle too full. uploading immediately")
-		err = r.upload([]*cloudtrace.Trace{trace})
+	return trace
+}
+
+// RecordTraceSpan buffers the span of the trace for upload the same way as
+// spans recorded with RecordSpan, for spans instrumented without OpenTracing
+// or imported. The span is uploaded as is, besides its name prefixed with
+// the operation prefix if any, default labels which are added, merged with
+// the merge policy if set by the span, and scrubbing of labels, e.g.
+// WithHashedLabels, and isn't subject to sampling or filters. It returns
+// ErrBufferFull if the span is dropped because the buffer is full, or
+// the error of the upload with WithSynchronousUpload. Spans dropped by
+// WithStrictMode are reported to its function only.
+func (r *Recorder) RecordTraceSpan(traceID string, span *cloudtrace.TraceSpan) error {
+	id, err := parseTraceID(traceID)
+	if err != nil {
+		return err
+	}
+
+	r.closeMu.RLock()
+	defer r.closeMu.RUnlock()
+	if r.closed {
+		return ErrRecorderClosed
+	}
+	defer r.recoverPanic("recording span", 1)
+
+	set := r.currentSettings()
+	labels := make(map[string]string, len(span.Labels)+len(set.labels))
+	for k, v := range set.labels {
+		labels[k] = v
+	}
+	for k, v := range span.Labels {
+		if native, ok := labels[k]; ok {
+			v = r.merge.merge(native, v)
+		}
+		labels[k] = v
+	}
+	sp := *span
+	sp.Labels = labels
+
+	trace := &cloudtrace.Trace{
+		ProjectId: r.project,
+		TraceId:   traceID,
+		Spans:     []*cloudtrace.TraceSpan{&sp},
+	}
+	if r.prefix != "" {
+		prefixOperations(trace, r.prefix)
+	}
+	r.scrub(trace)
+	if r.strict != nil && !r.checkStrict(r.project, trace) {
+		return nil
+	}
+	return r.enqueue(r.project, id, trace, r.convertV2(trace, nil))
+}
+
+// formatTraceID formats the trace identifier of the high and low 64 bits.
+// A 64-bit identifier, with zero high bits, is repeated to fill 128 bits.
+func formatTraceID(high, low uint64) string {
+	if high == 0 {
+		high = low
+	}
+	return fmt.Sprintf("%016x%016x", high, low)
+}
+
+// parseTraceID returns the lower 64 bits of the trace identifier.
+func parseTraceID(traceID string) (uint64, error) {
+	if len(traceID) != 32 {
+		return 0, ErrInvalidTraceID
+	}
+	if _, err := strconv.ParseUint(traceID[:16], 16, 64); err != nil {
+		return 0, ErrInvalidTraceID
+	}
+	id, err := strconv.ParseUint(traceID[16:], 16, 64)
+	if err != nil {
+		return 0, ErrInvalidTraceID
+	}
+	return id, nil
+}
+
+// enqueue buffers the trace for upload to the project, along with its span
+// converted for the v2 API if enabled. It returns the error of the upload
+// if synchronous, or ErrBufferFull or ErrRecorderClosed if the trace was
+// dropped. Errors are logged already.
+func (r *Recorder) enqueue(project string, traceID uint64, trace *cloudtrace.Trace, span *cloudtracev2.Span) error {
+	if r.synchronous {
+		err := r.upload(project, []*cloudtrace.Trace{trace}, newSpansV2(trace, span))
 		if err != nil {
-			r.log.Errorf("error uploading trace: %s", err)
+			r.logUploadError(err)
+		}
+		return err
+	}
+
+	err := r.bundlerFor(project).add(&bundledTrace{
+		rec:     r,
+		project: project,
+		traceID: traceID,
+		trace:   trace,
+		spanV2:  span,
+	})
+	if err != nil {
+		r.countDropped(trace, err)
+	}
+	if err == ErrBufferFull {
+		r.log.Errorf("trace upload buffer full. dropping trace %s", trace.TraceId)
+	} else if err != nil {
+		r.log.Errorf("trace upload bundler closed. dropping trace %s", trace.TraceId)
+	}
+	return err
+}
+
+// Flush uploads all the buffered spans and waits for uploads in
+// progress, as long as the context is not done. It returns an error
+// if any of the uploads failed meanwhile.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.closeMu.RLock()
+	closed := r.closed
+	r.closeMu.RUnlock()
+	if closed {
+		return ErrRecorderClosed
+	}
+
+	failures := atomic.LoadUint64(&r.failures)
+	if err := r.flushBundlers(ctx, false); err != nil {
+		return err
+	}
+	if atomic.LoadUint64(&r.failures) != failures {
+		return r.lastErr.Load().(error)
+	}
+	return nil
+}
+
+// Shutdown stops accepting spans, uploads all the buffered spans and waits
+// for uploads in progress, as long as the context is not done. Uploads
+// left once the context is done aren't retried.
+// RecordSpan does nothing once the Recorder is shut down.
+func (r *Recorder) Shutdown(ctx context.Context) error {
+	done := make(chan bool, 1)
+	go func() {
+		r.closeMu.Lock()
+		closed := r.closed
+		r.closed = true
+		r.closeMu.Unlock()
+		done <- closed
+	}()
+
+	select {
+	case closed := <-done:
+		if closed {
+			return ErrRecorderClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// The bundlers are flushed in background even if the context is done,
+	// failed uploads are not retried then.
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.stopRetriesOnce.Do(func() { close(r.stopRetries) })
+		case <-stopped:
+		}
+	}()
+	err := r.stopVerifier(ctx)
+	r.stopCostReport()
+	if merr := r.stopMetrics(ctx); merr != nil {
+		err = merr
+	}
+	if ferr := r.flushBundlers(ctx, true); ferr != nil {
+		err = ferr
+	}
+	return err
+}
+
+// Close implements io.Closer interface, it shuts down the Recorder
+// waiting for all the buffered spans to be uploaded.
+func (r *Recorder) Close() error {
+	return r.Shutdown(context.Background())
+}
+
+// Run blocks until the context is canceled, then shuts down the Recorder
+// waiting for all the buffered spans to be uploaded. It fits service
+// supervisors running components until one of them stops.
+func (r *Recorder) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return r.Shutdown(context.Background())
+}
+
+// flushBundlers flushes the bundlers, closing those owned by the Recorder
+// if stop is set. It returns once done or the context is done, the bundlers
+// are flushed in background then.
+func (r *Recorder) flushBundlers(ctx context.Context, stop bool) error {
+	bundlers := r.traceBundlers()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, tb := range bundlers {
+			if stop && tb != r.shared {
+				tb.close()
+			} else {
+				tb.flush()
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// bundlerFor returns the bundler of the project, creating it on first use.
+func (r *Recorder) bundlerFor(project string) *traceBundler {
+	if r.shared != nil {
+		return r.shared
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tb, ok := r.bundlers[project]; ok {
+		return tb
+	}
+	tb := newTraceBundler(&r.bundlerOptions)
+	r.bundlers[project] = tb
+
+	return tb
+}
+
+// traceBundlers returns all the bundlers used by the Recorder.
+func (r *Recorder) traceBundlers() []*traceBundler {
+	if r.shared != nil {
+		return []*traceBundler{r.shared}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bundlers := make([]*traceBundler, 0, len(r.bundlers))
+	for _, tb := range r.bundlers {
+		bundlers = append(bundlers, tb)
+	}
+	return bundlers
+}
+
+func (r *Recorder) upload(project string, traces []*cloudtrace.Trace, spans spansV2) error {
+	traces, duplicates := coalesce(traces)
+	if r.validate {
+		for _, w := range validateTraces(traces, duplicates) {
+			r.log.Errorf("invalid span: %s", w)
+		}
+	}
+	if r.aggregate > 1 {
+		aggregateSiblings(traces, r.aggregate, r.uploaded)
+	}
+	if r.synthetic {
+		synthesizeRoots(traces, r.uploaded)
+	}
+	r.uploaded.add(traces)
+	write := r.writer(project, spans)
+	if r.selfTracing {
+		method := "PatchTraces"
+		if r.v2 {
+			method = "BatchWriteSpans"
 		}
+		write = r.selfTraced(project, method, write)
+	}
+	if r.audit != nil {
+		write = r.audited(project, write)
+	}
+
+	var (
+		attempts int
+		exported bool
+		err      error
+	)
+	start := time.Now()
+	if r.fallback != nil {
+		attempts, exported, err = r.uploadWithFallback(project, write, traces)
+	} else {
+		attempts, err = r.send(write, traces)
+	}
+	if exported && err == nil {
+		// The traces aren't in Cloud Trace, so they're neither verified
+		// nor billed.
+		r.countFallback(traces)
+		r.debugf("exported %d traces of project %s with the fallback exporter", len(traces), project)
+		return nil
 	}
+	r.countUpload(project, traces, time.Since(start), err)
+	if err != nil {
+		var size int
+		for _, t := range traces {
+			size += traceSize(t)
+		}
+		err = &UploadError{
+			Project:      project,
+			Traces:       len(traces),
+			FirstTraceID: traces[0].TraceId,
+			LastTraceID:  traces[len(traces)-1].TraceId,
+			Bytes:        size,
+			Attempts:     attempts,
+			Err:          err,
+		}
+		r.lastErr.Store(err)
+		atomic.AddUint64(&r.failures, 1)
+		return err
+	}
+	r.debugf("uploaded %d traces to project %s", len(traces), project)
+	if r.verifier != nil {
+		r.verifier.sample(project, traces[len(traces)-1].TraceId)
+	}
+	if r.costs != nil {
+		r.costs.add(traces)
+	}
+
+	return nil
 }
 
-func (r *Recorder) upload(traces []*cloudtrace.Trace) error {
-	_, err := r.traceClient.Projects.PatchTraces(r.project, &cloudtrace.Traces{
+// writer returns the function uploading traces to the project with the API
+// of the Recorder. The spans converted for the v2 API when recorded are
+// uploaded as they are, other spans are converted on upload.
+func (r *Recorder) writer(project string, spans spansV2) writeFunc {
+	if r.v2 {
+		return func(traces []*cloudtrace.Trace) error {
+			return r.batchWrite(project, traces, spans)
+		}
+	}
+	return func(traces []*cloudtrace.Trace) error {
+		return r.patchTraces(project, traces)
+	}
+}
+
+func (r *Recorder) patchTraces(project string, traces []*cloudtrace.Trace) error {
+	c, err := r.client()
+	if err != nil {
+		return err
+	}
+	_, err = c.Projects.PatchTraces(project, &cloudtrace.Traces{
 		Traces: traces,
 	}).Context(context.Background()).Do()
 
 	return err
 }
 
-func convertTags(tags opentracing.Tags) map[string]string {
-	labels := make(map[string]string)
+// logUploadError logs the error with metadata of the failed upload,
+// as fields if the logger implements FieldLogger.
+func (r *Recorder) logUploadError(err error) {
+	ue, ok := err.(*UploadError)
+	if !ok {
+		r.log.Errorf("error uploading traces: %s", err)
+		return
+	}
+
+	fields := map[string]interface{}{
+		"project":        ue.Project,
+		"trace_count":    ue.Traces,
+		"first_trace_id": ue.FirstTraceID,
+		"last_trace_id":  ue.LastTraceID,
+		"payload_bytes":  ue.Bytes,
+		"attempt":        ue.Attempts,
+		"error":          ue.Err.Error(),
+	}
+	if l, ok := r.log.(FieldLogger); ok {
+		l.ErrorWithFields("failed to upload traces to the Cloud Trace server", fields)
+		return
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := bytes.NewBufferString("failed to upload traces to the Cloud Trace server.")
+	for _, k := range keys {
+		fmt.Fprintf(buf, " %s=%v", k, fields[k])
+	}
+	r.log.Errorf("%s", buf.String())
+}
+
+func (r *Recorder) debugf(msg string, args ...interface{}) {
+	if !r.currentSettings().debug {
+		return
+	}
+	if l, ok := r.log.(DebugLogger); ok {
+		l.Debugf(msg, args...)
+	}
+}
+
+// sampleBound returns the bound of trace identifiers kept with the sampling
+// rate, see inSample.
+func sampleBound(rate float64) uint64 {
+	if rate >= 1 {
+		return math.MaxUint64
+	}
+	if rate <= 0 {
+		return 0
+	}
+	return uint64(rate * math.MaxUint64)
+}
+
+// inSample reports whether the trace is kept with the bound of sampleBound:
+// identifiers lower than the bound are kept, all of them with the greatest
+// bound, none with the zero bound.
+func inSample(traceID, bound uint64) bool {
+	return bound == math.MaxUint64 || traceID < bound
+}
+
+// convertTags converts the tags into labels, the map is sized
+// for extra labels added later.
+func convertTags(tags opentracing.Tags, extra int) map[string]string {
+	labels := make(map[string]string, len(tags)+extra)
 	for k, v := range tags {
-		switch v := v.(type) {
-		case int:
-			labels[k] = strconv.Itoa(v)
-		case string:
-			labels[k] = v
+		if s, ok := formatTag(v); ok {
+			labels[k] = s
 		}
 	}
 	return labels
 }
 
+// SpanKindFunc resolves the Cloud Trace span kind from the span tags,
+// see WithSpanKindFunc.
+type SpanKindFunc func(tags opentracing.Tags) string
+
+// convertSpanKind resolves the span kind from the span.kind tag.
+// The API knows only RPC kinds, so producers are mapped as clients
+// and consumers as servers of asynchronous calls.
 func convertSpanKind(tags opentracing.Tags) string {
-	switch tags[string(ext.SpanKind)] {
-	case ext.SpanKindRPCServerEnum:
+	var kind string
+	switch v := tags[string(ext.SpanKind)].(type) {
+	case ext.SpanKindEnum:
+		kind = string(v)
+	case string:
+		kind = v
+	}
+
+	switch ext.SpanKindEnum(kind) {
+	case ext.SpanKindRPCServerEnum, ext.SpanKindConsumerEnum:
 		return "RPC_SERVER"
-	case ext.SpanKindRPCClientEnum:
+	case ext.SpanKindRPCClientEnum, ext.SpanKindProducerEnum:
 		return "RPC_CLIENT"
 	default:
 		return "SPAN_KIND_UNSPECIFIED"
 	}
 }
 
-// rewrite well-known opentracing.ext labels into those gcloud-native labels
-func transposeLabels(labels map[string]string) {
+// rewrite well-known opentracing.ext labels into those gcloud-native labels,
+// merged with the native labels set as well
+func transposeLabels(labels map[string]string, merge labelMerge) {
 	for k, t := range labelMap {
 		if vv, ok := labels[k]; ok {
+			if native, ok := labels[t]; ok {
+				vv = merge.merge(native, vv)
+			}
 			labels[t] = vv
 			delete(labels, k)
 		}
 	}
 }
 
-// copy opentracing events into gcloud trace labels
-func addLogs(target map[string]string, logs []opentracing.LogRecord) {
+// logTimeLayout is the layout of time.Time.String, without the monotonic clock reading.
+const logTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// formatTimestamp formats the time as RFC 3339 timestamp expected by the API,
+// using a buffer on the stack so the only allocation is the result.
+func formatTimestamp(t time.Time) string {
+	var buf [64]byte
+	return string(t.AppendFormat(buf[:0], time.RFC3339Nano))
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// copy opentracing events of the span started at the start time into gcloud trace labels
+func addLogs(target map[string]string, logs []opentracing.LogRecord, start time.Time) {
+	if len(logs) == 0 {
+		return
+	}
+
+	var ts [64]byte
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
 	for i, l := range logs {
-		buf := bytes.NewBufferString(l.Timestamp.String())
+		buf.Reset()
+		buf.Write(logTime(start, l.Timestamp).AppendFormat(ts[:0], logTimeLayout))
 		for j, f := range l.Fields {
 			buf.WriteString(f.Key())
 			buf.WriteString("=")
-			buf.WriteString(fmt.Sprint(f.Value()))
+			fmt.Fprint(buf, f.Value())
 			if j != len(l.Fields)+1 {
 				buf.WriteString(" ")
 			}
 		}
-		target[fmt.Sprintf("event_%d", i)] = buf.String()
+		target[eventKey(i)] = buf.String()
 	}
 }
@@ -0,0 +1,97 @@
+// Package redis provides a go-redis hook tracing commands as client spans
+// with an opentracing.Tracer, usually a *gcloudtracer.Tracer, e.g.
+//
+//	client := redis.NewClient(&redis.Options{Addr: addr})
+//	client.AddHook(gcloudredis.NewHook(tracer))
+//
+// Commands are traced with their names only, as their arguments may hold
+// keys or values of user data.
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/redis/go-redis/v9"
+)
+
+// PipelineLengthTag holds the number of commands of a pipeline.
+const PipelineLengthTag = "redis.pipeline_length"
+
+var _ redis.Hook = &Hook{}
+
+// Hook implements redis.Hook interface tracing commands of the client
+// in the request context.
+type Hook struct {
+	tracer opentracing.Tracer
+}
+
+// NewHook creates new hook starting spans with the tracer.
+func NewHook(tracer opentracing.Tracer) *Hook {
+	return &Hook{tracer: tracer}
+}
+
+// DialHook belongs to the redis.Hook interface, dials aren't traced.
+func (h *Hook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook traces the command.
+func (h *Hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		name := strings.ToUpper(cmd.Name())
+		sp, ctx := h.startSpan(ctx, "redis "+name, statement(cmd))
+		defer sp.Finish()
+		err := next(ctx, cmd)
+		setError(sp, err)
+		return err
+	}
+}
+
+// ProcessPipelineHook traces the pipeline as a single span.
+func (h *Hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		statements := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			statements[i] = statement(cmd)
+		}
+		sp, ctx := h.startSpan(ctx, "redis pipeline", strings.Join(statements, "\n"))
+		defer sp.Finish()
+		sp.SetTag(PipelineLengthTag, len(cmds))
+		err := next(ctx, cmds)
+		setError(sp, err)
+		return err
+	}
+}
+
+func (h *Hook) startSpan(ctx context.Context, operationName, stmt string) (opentracing.Span, context.Context) {
+	sp, ctx := opentracing.StartSpanFromContextWithTracer(ctx, h.tracer, operationName, ext.SpanKindRPCClient)
+	ext.Component.Set(sp, "go-redis")
+	ext.DBType.Set(sp, "redis")
+	ext.PeerService.Set(sp, "redis")
+	ext.DBStatement.Set(sp, stmt)
+	return sp, ctx
+}
+
+// statement returns the command name with its arguments redacted,
+// e.g. "SET ? ?".
+func statement(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) <= 1 {
+		return strings.ToUpper(cmd.Name())
+	}
+	return strings.ToUpper(cmd.Name()) + strings.Repeat(" ?", len(args)-1)
+}
+
+// setError tags the span as an error unless the key was just missing.
+func setError(sp opentracing.Span, err error) {
+	if err != nil && err != redis.Nil {
+		ext.Error.Set(sp, true)
+		sp.SetTag("error.message", err.Error())
+	}
+}
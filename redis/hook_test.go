@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHook(t *testing.T) {
+	t.Run("command=set", func(t *testing.T) {
+		tracer := mocktracer.New()
+		parent := tracer.StartSpan("parent")
+		ctx := opentracing.ContextWithSpan(context.Background(), parent)
+		var child opentracing.Span
+		process := NewHook(tracer).ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+			child = opentracing.SpanFromContext(ctx)
+			return nil
+		})
+
+		assert.NoError(t, process(ctx, redis.NewStatusCmd(ctx, "set", "user:1", "secret")))
+
+		sp := tracer.FinishedSpans()[0]
+		assert.Equal(t, child, opentracing.Span(sp))
+		assert.Equal(t, "redis SET", sp.OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, sp.ParentID)
+		assert.Equal(t, "SET ? ?", sp.Tags()["db.statement"])
+		assert.Equal(t, "redis", sp.Tags()["db.type"])
+		assert.Nil(t, sp.Tags()["error"])
+	})
+
+	t.Run("command=nil", func(t *testing.T) {
+		tracer := mocktracer.New()
+		process := NewHook(tracer).ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+			return redis.Nil
+		})
+
+		ctx := context.Background()
+		assert.Equal(t, redis.Nil, process(ctx, redis.NewStringCmd(ctx, "get", "user:1")))
+		assert.Nil(t, tracer.FinishedSpans()[0].Tags()["error"])
+	})
+
+	t.Run("command=error", func(t *testing.T) {
+		tracer := mocktracer.New()
+		process := NewHook(tracer).ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+			return errors.New("connection refused")
+		})
+
+		ctx := context.Background()
+		assert.Error(t, process(ctx, redis.NewStringCmd(ctx, "ping")))
+		tags := tracer.FinishedSpans()[0].Tags()
+		assert.Equal(t, "PING", tags["db.statement"])
+		assert.Equal(t, true, tags["error"])
+		assert.Equal(t, "connection refused", tags["error.message"])
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		tracer := mocktracer.New()
+		process := NewHook(tracer).ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+			return nil
+		})
+
+		ctx := context.Background()
+		assert.NoError(t, process(ctx, []redis.Cmder{
+			redis.NewStatusCmd(ctx, "set", "user:1", "secret"),
+			redis.NewIntCmd(ctx, "incr", "visits"),
+		}))
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "redis pipeline", spans[0].OperationName)
+		assert.Equal(t, "SET ? ?\nINCR ?", spans[0].Tags()["db.statement"])
+		assert.Equal(t, 2, spans[0].Tags()[PipelineLengthTag])
+	})
+}
@@ -0,0 +1,190 @@
+package gcloudtracer
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+// settings holds the options of the Recorder which can be changed at runtime.
+type settings struct {
+	sampleBound uint64
+	filters     []Filter
+	labels      map[string]string
+	debug       bool
+}
+
+func (r *Recorder) newSettings(o *Options) *settings {
+	labels := make(map[string]string, len(r.detected)+len(o.labels))
+	for k, v := range r.detected {
+		labels[k] = v
+	}
+	for k, v := range o.labels {
+		labels[k] = v
+	}
+	return &settings{
+		sampleBound: sampleBound(o.samplingRate),
+		filters:     o.filters,
+		labels:      labels,
+		debug:       o.debug,
+	}
+}
+
+func (r *Recorder) currentSettings() *settings {
+	return r.settings.Load().(*settings)
+}
+
+// Reload replaces sampling rate, filters, debug mode and default labels
+// of the Recorder with those of the options, without losing buffered spans.
+// The options are applied over the settings the Recorder was created with,
+// so filters and labels are added to those passed to NewRecorder, and
+// settings not specified by the options are kept. Settings of previous
+// reloads are replaced, other options are ignored.
+func (r *Recorder) Reload(opts ...Option) {
+	options := r.created
+	options.filters = append([]Filter(nil), r.created.filters...)
+	options.labels = make(map[string]string, len(r.created.labels))
+	for k, v := range r.created.labels {
+		options.labels[k] = v
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	r.settings.Store(r.newSettings(&options))
+}
+
+// WatchConfig reloads the Recorder from the config file every time the file
+// is modified or the process receives SIGHUP. The file is checked for
+// modifications every interval. The Cloud Trace clients are rebuilt only if
+// the credentials, their file content, or the endpoint change. It blocks
+// until the context is canceled. The interval must be positive.
+func (r *Recorder) WatchConfig(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid config watch interval %s, must be positive", interval)
+	}
+	modTime := func() time.Time {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The client is rebuilt only if the client options change.
+	var client clientConfig
+	if cfg, err := LoadConfig(path); err == nil {
+		client = newClientConfig(cfg)
+	}
+
+	last := modTime()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hup:
+		case <-ticker.C:
+			mt := modTime()
+			if mt.Equal(last) {
+				continue
+			}
+			last = mt
+		}
+
+		if err := r.reloadConfig(path, &client); err != nil {
+			r.log.Errorf("failed to reload config %s: %s", path, err)
+		}
+	}
+}
+
+// reloadConfig reloads the Recorder from the config file, rebuilding
+// the clients if the client options differ from the previous ones.
+func (r *Recorder) reloadConfig(path string, client *clientConfig) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	if cc := newClientConfig(cfg); cc != *client {
+		if err := r.rebuildClients(*client, cfg); err != nil {
+			return err
+		}
+		*client = cc
+		r.debugf("rebuilt clients with config %s", path)
+	}
+
+	// The client options are applied already.
+	cfg.Credentials, cfg.Endpoint = "", ""
+	opts, err := cfg.Options()
+	if err != nil {
+		return err
+	}
+	r.Reload(opts...)
+	r.debugf("reloaded config %s", path)
+	return nil
+}
+
+// clientConfig holds the client options of a config, and the digest of
+// the credentials file, so rotated keys are picked up.
+type clientConfig struct {
+	credentials string
+	digest      [sha256.Size]byte
+	endpoint    string
+}
+
+func newClientConfig(cfg *Config) clientConfig {
+	cc := clientConfig{credentials: cfg.Credentials, endpoint: cfg.Endpoint}
+	if cfg.Credentials != "" {
+		if b, err := ioutil.ReadFile(cfg.Credentials); err == nil {
+			cc.digest = sha256.Sum256(b)
+		}
+	}
+	return cc
+}
+
+// rebuildClients replaces the clients of the Recorder with ones created
+// with the client options of the config which differ from the previous
+// ones, applied over the credentials and client options of the Recorder.
+// Credentials or an endpoint removed from the config keep the current ones.
+func (r *Recorder) rebuildClients(prev clientConfig, cfg *Config) error {
+	var changed Config
+	if cc := newClientConfig(cfg); cc.credentials != prev.credentials || cc.digest != prev.digest {
+		changed.Credentials = cfg.Credentials
+	}
+	if cfg.Endpoint != prev.endpoint {
+		changed.Endpoint = cfg.Endpoint
+	}
+	opts, err := changed.Options()
+	if err != nil {
+		return err
+	}
+
+	r.clientMu.Lock()
+	defer r.clientMu.Unlock()
+	options := r.clientOptions
+	options.clientOptions = append([]option.ClientOption(nil), options.clientOptions...)
+	if changed.Credentials != "" {
+		// The key of the config takes precedence over the key source.
+		options.keySource = nil
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	r.clientOptions = options
+	r.newClient = clientFactory(r.ctx, &options)
+	r.newClientV2 = clientFactoryV2(r.ctx, &options)
+	r.traceClient, r.traceClientV2 = nil, nil
+	return nil
+}
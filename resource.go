@@ -0,0 +1,170 @@
+package gcloudtracer
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+const k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Detector returns labels describing the environment the process runs in.
+// It returns nil if the process doesn't run in the detected environment.
+type Detector func() map[string]string
+
+// DetectGKE detects GKE cluster name, location, namespace, pod and container.
+// Namespace, pod and container are read from POD_NAMESPACE, POD_NAME and
+// CONTAINER_NAME variables, which are usually exposed with the Downward API.
+func DetectGKE() map[string]string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	if metadata.OnGCE() {
+		if v, err := metadata.InstanceAttributeValue("cluster-name"); err == nil {
+			labels["g.co/r/k8s_container/cluster_name"] = strings.TrimSpace(v)
+		}
+		if v, err := metadata.InstanceAttributeValue("cluster-location"); err == nil {
+			labels["g.co/r/k8s_container/location"] = strings.TrimSpace(v)
+		}
+	}
+
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		if b, err := ioutil.ReadFile(k8sNamespaceFile); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		}
+	}
+	pod := os.Getenv("POD_NAME")
+	if pod == "" {
+		pod, _ = os.Hostname()
+	}
+	setLabel(labels, "g.co/r/k8s_container/namespace_name", namespace)
+	setLabel(labels, "g.co/r/k8s_container/pod_name", pod)
+	setLabel(labels, "g.co/r/k8s_container/container_name", os.Getenv("CONTAINER_NAME"))
+
+	return labels
+}
+
+// DetectCloudRun detects Cloud Run service, revision and region,
+// or Cloud Functions function name, entry point and region. Functions
+// are detected by FUNCTION_TARGET, also set by runtimes predating
+// K_SERVICE, which set FUNCTION_NAME instead.
+func DetectCloudRun() map[string]string {
+	service := os.Getenv("K_SERVICE")
+	target := os.Getenv("FUNCTION_TARGET")
+	if target != "" && service == "" {
+		service = os.Getenv("FUNCTION_NAME")
+	}
+	if service == "" && target == "" {
+		return nil
+	}
+
+	region := os.Getenv("FUNCTION_REGION")
+	if region == "" && metadata.OnGCE() {
+		// projects/<number>/regions/<region>
+		if v, err := metadata.Get("instance/region"); err == nil {
+			region = v[strings.LastIndex(v, "/")+1:]
+		}
+	}
+
+	labels := make(map[string]string)
+	if target != "" {
+		setLabel(labels, "g.co/r/cloud_function/function_name", service)
+		setLabel(labels, "g.co/r/cloud_function/entry_point", target)
+		setLabel(labels, "g.co/r/cloud_function/region", region)
+		return labels
+	}
+	setLabel(labels, "g.co/r/cloud_run_revision/service_name", service)
+	setLabel(labels, "g.co/r/cloud_run_revision/revision_name", os.Getenv("K_REVISION"))
+	setLabel(labels, "g.co/r/cloud_run_revision/configuration_name", os.Getenv("K_CONFIGURATION"))
+	setLabel(labels, "g.co/r/cloud_run_revision/location", region)
+	return labels
+}
+
+// requestScoped reports whether the process runs in Cloud Run, Cloud Functions
+// or App Engine standard environment, where CPU is throttled outside of
+// requests.
+func requestScoped() bool {
+	return os.Getenv("K_SERVICE") != "" || os.Getenv("FUNCTION_TARGET") != "" ||
+		(os.Getenv("GAE_SERVICE") != "" && os.Getenv("GAE_ENV") == "standard")
+}
+
+// DetectGCE detects instance identifier, zone and machine type
+// from the metadata server.
+func DetectGCE() map[string]string {
+	if !metadata.OnGCE() {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	if v, err := metadata.InstanceID(); err == nil {
+		setLabel(labels, "g.co/r/gce_instance/instance_id", v)
+	}
+	if v, err := metadata.Zone(); err == nil {
+		setLabel(labels, "g.co/r/gce_instance/zone", v)
+	}
+	// projects/<number>/machineTypes/<machine type>
+	if v, err := metadata.Get("instance/machine-type"); err == nil {
+		setLabel(labels, "g.co/r/gce_instance/machine_type", v[strings.LastIndex(v, "/")+1:])
+	}
+	return labels
+}
+
+// DetectAppEngine detects App Engine standard and flexible environment
+// service and version, using the labels the Cloud Trace console understands.
+func DetectAppEngine() map[string]string {
+	service := os.Getenv("GAE_SERVICE")
+	// GAE_ENV is set in the standard environment only,
+	// the flexible one sets GAE_INSTANCE instead.
+	if service == "" || (os.Getenv("GAE_ENV") == "" && os.Getenv("GAE_INSTANCE") == "") {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	version := os.Getenv("GAE_VERSION")
+	setLabel(labels, "g.co/gae/app/module", service)
+	setLabel(labels, "g.co/gae/app/version", version)
+	if version != "" {
+		labels["g.co/gae/app/module_version"] = service + ":" + version
+	}
+	return labels
+}
+
+// DetectBuildInfo detects the main module version, VCS revision and
+// Go version the binary was built with.
+func DetectBuildInfo() map[string]string {
+	labels := map[string]string{
+		"build/go_version": runtime.Version(),
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return labels
+	}
+	if v := info.Main.Version; v != "(devel)" {
+		setLabel(labels, "build/module_version", v)
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			setLabel(labels, "build/vcs_revision", s.Value)
+		case "vcs.modified":
+			if s.Value == "true" {
+				labels["build/vcs_modified"] = s.Value
+			}
+		}
+	}
+	return labels
+}
+
+func setLabel(labels map[string]string, key, value string) {
+	if value != "" {
+		labels[key] = value
+	}
+}
@@ -0,0 +1,145 @@
+package gcloudtracer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCloudRun(t *testing.T) {
+	t.Run("env=cloud_run", func(t *testing.T) {
+		t.Setenv("K_SERVICE", "api")
+		t.Setenv("K_REVISION", "api-00001")
+		t.Setenv("K_CONFIGURATION", "api")
+		t.Setenv("FUNCTION_REGION", "europe-west1")
+		assert.Equal(t, map[string]string{
+			"g.co/r/cloud_run_revision/service_name":       "api",
+			"g.co/r/cloud_run_revision/revision_name":      "api-00001",
+			"g.co/r/cloud_run_revision/configuration_name": "api",
+			"g.co/r/cloud_run_revision/location":           "europe-west1",
+		}, DetectCloudRun())
+		assert.True(t, requestScoped())
+	})
+
+	t.Run("env=cloud_functions", func(t *testing.T) {
+		t.Setenv("K_SERVICE", "")
+		t.Setenv("FUNCTION_TARGET", "Handle")
+		t.Setenv("FUNCTION_NAME", "handler")
+		t.Setenv("FUNCTION_REGION", "europe-west1")
+		assert.Equal(t, map[string]string{
+			"g.co/r/cloud_function/function_name": "handler",
+			"g.co/r/cloud_function/entry_point":   "Handle",
+			"g.co/r/cloud_function/region":        "europe-west1",
+		}, DetectCloudRun())
+		assert.True(t, requestScoped())
+	})
+
+	t.Run("env=none", func(t *testing.T) {
+		t.Setenv("K_SERVICE", "")
+		t.Setenv("FUNCTION_TARGET", "")
+		t.Setenv("GAE_SERVICE", "")
+		assert.Nil(t, DetectCloudRun())
+		assert.False(t, requestScoped())
+	})
+}
+
+func TestDetectAppEngine(t *testing.T) {
+	t.Setenv("K_SERVICE", "")
+	t.Setenv("FUNCTION_TARGET", "")
+
+	t.Run("env=standard", func(t *testing.T) {
+		t.Setenv("GAE_SERVICE", "default")
+		t.Setenv("GAE_VERSION", "v1")
+		t.Setenv("GAE_ENV", "standard")
+		assert.Equal(t, map[string]string{
+			"g.co/gae/app/module":         "default",
+			"g.co/gae/app/version":        "v1",
+			"g.co/gae/app/module_version": "default:v1",
+		}, DetectAppEngine())
+		assert.True(t, requestScoped())
+
+		var o Options
+		WithCloudRun()(&o)
+		assert.True(t, o.synchronous)
+		assert.Len(t, o.detectors, 2)
+	})
+
+	t.Run("env=flexible", func(t *testing.T) {
+		t.Setenv("GAE_SERVICE", "default")
+		t.Setenv("GAE_VERSION", "v1")
+		t.Setenv("GAE_ENV", "")
+		t.Setenv("GAE_INSTANCE", "instance")
+		assert.Equal(t, "default", DetectAppEngine()["g.co/gae/app/module"])
+		assert.False(t, requestScoped())
+
+		var o Options
+		WithCloudRun()(&o)
+		assert.False(t, o.synchronous)
+	})
+}
+
+// metadataServer serves the metadata attributes by path, e.g.
+// "instance/zone", as the metadata server of GCE. It must be set up before
+// metadata.OnGCE is first called, as its result is cached.
+func metadataServer(t *testing.T, attributes map[string]string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, ok := attributes[strings.TrimPrefix(r.URL.Path, "/computeMetadata/v1/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(v))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+}
+
+func TestDetectGKE(t *testing.T) {
+	metadataServer(t, map[string]string{
+		"instance/attributes/cluster-name":     "prod\n",
+		"instance/attributes/cluster-location": "europe-west1",
+	})
+
+	t.Run("env=gke", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+		t.Setenv("POD_NAMESPACE", "shop")
+		t.Setenv("POD_NAME", "api-7d9f")
+		t.Setenv("CONTAINER_NAME", "api")
+		assert.Equal(t, map[string]string{
+			"g.co/r/k8s_container/cluster_name":   "prod",
+			"g.co/r/k8s_container/location":       "europe-west1",
+			"g.co/r/k8s_container/namespace_name": "shop",
+			"g.co/r/k8s_container/pod_name":       "api-7d9f",
+			"g.co/r/k8s_container/container_name": "api",
+		}, DetectGKE())
+	})
+
+	t.Run("env=none", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "")
+		assert.Nil(t, DetectGKE())
+	})
+}
+
+func TestDetectGCE(t *testing.T) {
+	metadataServer(t, map[string]string{
+		"instance/id":           "1234",
+		"instance/zone":         "projects/42/zones/europe-west1-b",
+		"instance/machine-type": "projects/42/machineTypes/e2-small",
+	})
+
+	assert.Equal(t, map[string]string{
+		"g.co/r/gce_instance/instance_id":  "1234",
+		"g.co/r/gce_instance/zone":         "europe-west1-b",
+		"g.co/r/gce_instance/machine_type": "e2-small",
+	}, DetectGCE())
+}
+
+func TestDetectBuildInfo(t *testing.T) {
+	labels := DetectBuildInfo()
+	assert.Equal(t, runtime.Version(), labels["build/go_version"])
+	assert.NotContains(t, labels, "build/module_version", "test binaries are (devel)")
+}
@@ -0,0 +1,137 @@
+package gcloudtracer
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// coalesce merges traces sharing an identifier and drops duplicate spans,
+// keeping the first version recorded. Spans are sorted by start time.
+// Traces are never modified once coalesced, so every attempt uploads
+// identical payload and PatchTraces, an upsert, never leaves two versions
+// of a span visible. Dropped duplicates are returned as traces of a span,
+// so they can be reported.
+func coalesce(traces []*cloudtrace.Trace) (coalesced, duplicates []*cloudtrace.Trace) {
+	if len(traces) < 2 {
+		for _, t := range traces {
+			sortSpans(t.Spans)
+		}
+		return traces, nil
+	}
+
+	type spanKey struct {
+		traceID string
+		spanID  uint64
+	}
+	byID := make(map[string]*cloudtrace.Trace, len(traces))
+	seen := make(map[spanKey]struct{}, len(traces))
+	result := make([]*cloudtrace.Trace, 0, len(traces))
+	for _, t := range traces {
+		merged, ok := byID[t.TraceId]
+		if !ok {
+			merged = &cloudtrace.Trace{ProjectId: t.ProjectId, TraceId: t.TraceId}
+			byID[t.TraceId] = merged
+			result = append(result, merged)
+		}
+		for _, sp := range t.Spans {
+			k := spanKey{traceID: t.TraceId, spanID: sp.SpanId}
+			if _, dup := seen[k]; dup {
+				duplicates = append(duplicates, &cloudtrace.Trace{ProjectId: t.ProjectId, TraceId: t.TraceId, Spans: []*cloudtrace.TraceSpan{sp}})
+				continue
+			}
+			seen[k] = struct{}{}
+			merged.Spans = append(merged.Spans, sp)
+		}
+	}
+	for _, t := range result {
+		sortSpans(t.Spans)
+	}
+	return result, duplicates
+}
+
+// sortSpans sorts the spans by start time, then by identifier, so payloads
+// are reproducible and parents precede their children in big traces.
+// Labels need no sorting, JSON encoding sorts keys of maps.
+func sortSpans(spans []*cloudtrace.TraceSpan) {
+	if len(spans) < 2 {
+		return
+	}
+
+	starts := make(map[*cloudtrace.TraceSpan]time.Time, len(spans))
+	for _, s := range spans {
+		starts[s] = parseTimestamp(s.StartTime)
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		si, sj := starts[spans[i]], starts[spans[j]]
+		if !si.Equal(sj) {
+			return si.Before(sj)
+		}
+		return spans[i].SpanId < spans[j].SpanId
+	})
+}
+
+// writeFunc uploads the traces, see Recorder.writer.
+type writeFunc func(traces []*cloudtrace.Trace) error
+
+// send uploads the traces with retries and returns the number of attempts
+// made. When the API rejects a bundle as invalid, it is split in halves
+// uploaded separately, so only the invalid traces are dropped instead of
+// the whole bundle.
+func (r *Recorder) send(write writeFunc, traces []*cloudtrace.Trace) (int, error) {
+	attempts, err := r.sendWithRetries(write, traces)
+	if !isBadRequest(err) || len(traces) < 2 {
+		return attempts, err
+	}
+
+	half := len(traces) / 2
+	attempts, err = r.send(write, traces[:half])
+	if attempts2, err2 := r.send(write, traces[half:]); err == nil {
+		attempts, err = attempts2, err2
+	}
+	return attempts, err
+}
+
+func (r *Recorder) sendWithRetries(write writeFunc, traces []*cloudtrace.Trace) (int, error) {
+	backoff := r.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := write(traces)
+		if err == nil || attempt >= r.maxAttempts || !isRetryable(err) {
+			return attempt, err
+		}
+		r.debugf("retrying upload of %d traces in %s, attempt %d failed (err = %s)", len(traces), backoff, attempt, err)
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-r.ctx.Done():
+			t.Stop()
+			return attempt, err
+		case <-r.stopRetries:
+			t.Stop()
+			return attempt, err
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable reports whether the upload failed temporarily.
+func isRetryable(err error) bool {
+	switch err := err.(type) {
+	case *googleapi.Error:
+		return err.Code == http.StatusTooManyRequests || err.Code >= http.StatusInternalServerError
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+func isBadRequest(err error) bool {
+	if err, ok := err.(*googleapi.Error); ok {
+		return err.Code == http.StatusBadRequest
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package gcloudtracer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// RingBuffer is an Exporter keeping the last traces exported within
+// the window in memory, for example unsampled spans to be dumped once
+// an incident occurs, see WithUnsampledExporter.
+type RingBuffer struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries []ringEntry
+	next    int
+	full    bool
+}
+
+type ringEntry struct {
+	exported time.Time
+	trace    *cloudtrace.Trace
+}
+
+// NewRingBuffer creates new buffer of at most size traces exported within
+// the window, or of the last size traces if the window isn't positive.
+func NewRingBuffer(size int, window time.Duration) *RingBuffer {
+	return &RingBuffer{window: window, entries: make([]ringEntry, size)}
+}
+
+// Export implements Exporter interface, overwriting the oldest traces.
+func (b *RingBuffer) Export(ctx context.Context, traces []*cloudtrace.Trace) error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, t := range traces {
+		b.entries[b.next] = ringEntry{exported: now, trace: t}
+		b.next = (b.next + 1) % len(b.entries)
+		if b.next == 0 {
+			b.full = true
+		}
+	}
+	return nil
+}
+
+// Traces returns the buffered traces, the oldest first.
+func (b *RingBuffer) Traces() []*cloudtrace.Trace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, first := b.next, 0
+	if b.full {
+		n, first = len(b.entries), b.next
+	}
+	since := time.Now().Add(-b.window)
+	traces := make([]*cloudtrace.Trace, 0, n)
+	for i := 0; i < n; i++ {
+		e := b.entries[(first+i)%len(b.entries)]
+		if b.window <= 0 || e.exported.After(since) {
+			traces = append(traces, e.trace)
+		}
+	}
+	return traces
+}
+
+// Dump writes the buffered traces to the writer as JSON, one trace per line,
+// like WriterExporter.
+func (b *RingBuffer) Dump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, t := range b.Traces() {
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
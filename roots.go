@@ -0,0 +1,172 @@
+package gcloudtracer
+
+import (
+	"sync"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// SyntheticLabel marks the placeholder spans synthesized by the Recorder,
+// see WithSyntheticRoots.
+const SyntheticLabel = "synthetic"
+
+// syntheticRootName is the name of the placeholder spans.
+const syntheticRootName = "(missing parent)"
+
+// maxUploadedTraces bounds the number of traces whose uploaded spans
+// are remembered, see uploadedSpans.
+const maxUploadedTraces = 1000
+
+// uploadedSpans remembers the spans of the last traces uploaded, so parents
+// uploaded in previous bundles aren't replaced by placeholders, and spans
+// with children uploaded in previous bundles aren't aggregated.
+type uploadedSpans struct {
+	mu     sync.Mutex
+	traces map[string]*uploadedTrace
+	// order lists identifiers of the traces, the oldest first.
+	order []string
+}
+
+// uploadedTrace holds the identifiers of the spans of a trace uploaded,
+// and of their parents.
+type uploadedTrace struct {
+	spans   map[uint64]struct{}
+	parents map[uint64]struct{}
+}
+
+func newUploadedSpans() *uploadedSpans {
+	return &uploadedSpans{traces: make(map[string]*uploadedTrace)}
+}
+
+// has reports whether the span of the trace was uploaded.
+func (u *uploadedSpans) has(traceID string, spanID uint64) bool {
+	if u == nil {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	t, ok := u.traces[traceID]
+	if !ok {
+		return false
+	}
+	_, ok = t.spans[spanID]
+	return ok
+}
+
+// hasChildren reports whether a child of the span of the trace was uploaded.
+func (u *uploadedSpans) hasChildren(traceID string, spanID uint64) bool {
+	if u == nil {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	t, ok := u.traces[traceID]
+	if !ok {
+		return false
+	}
+	_, ok = t.parents[spanID]
+	return ok
+}
+
+// add remembers the spans of the traces besides placeholders, evicting
+// the oldest traces if full.
+func (u *uploadedSpans) add(traces []*cloudtrace.Trace) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, t := range traces {
+		ut := u.traces[t.TraceId]
+		if ut == nil {
+			if len(u.order) >= maxUploadedTraces {
+				delete(u.traces, u.order[0])
+				u.order[0] = ""
+				u.order = u.order[1:]
+			}
+			ut = &uploadedTrace{
+				spans:   make(map[uint64]struct{}, len(t.Spans)),
+				parents: make(map[uint64]struct{}),
+			}
+			u.traces[t.TraceId] = ut
+			u.order = append(u.order, t.TraceId)
+		}
+		for _, s := range t.Spans {
+			if s.Labels[SyntheticLabel] == "true" {
+				continue
+			}
+			ut.spans[s.SpanId] = struct{}{}
+			if s.ParentSpanId != 0 {
+				ut.parents[s.ParentSpanId] = struct{}{}
+			}
+		}
+	}
+}
+
+// synthesizeRoots adds a placeholder span to the traces without a root span
+// for every parent missing from the trace and not uploaded before. The
+// placeholder has the identifier of the missing parent, so the parent
+// replaces it if it's uploaded later.
+func synthesizeRoots(traces []*cloudtrace.Trace, uploaded *uploadedSpans) {
+	for _, t := range traces {
+		if len(t.Spans) == 0 {
+			continue
+		}
+		ids := make(map[uint64]struct{}, len(t.Spans))
+		for _, s := range t.Spans {
+			if s.ParentSpanId == 0 {
+				ids = nil
+				break
+			}
+			ids[s.SpanId] = struct{}{}
+		}
+		if ids == nil {
+			continue
+		}
+
+		// The placeholders span the whole trace.
+		start, end := t.Spans[0].StartTime, t.Spans[0].EndTime
+		for _, s := range t.Spans[1:] {
+			if parseTimestamp(s.StartTime).Before(parseTimestamp(start)) {
+				start = s.StartTime
+			}
+			if parseTimestamp(s.EndTime).After(parseTimestamp(end)) {
+				end = s.EndTime
+			}
+		}
+
+		roots := make(map[uint64]*cloudtrace.TraceSpan)
+		var order []uint64
+		for _, s := range t.Spans {
+			if _, ok := ids[s.ParentSpanId]; ok {
+				continue
+			}
+			if _, ok := roots[s.ParentSpanId]; ok {
+				continue
+			}
+			if uploaded.has(t.TraceId, s.ParentSpanId) {
+				continue
+			}
+			roots[s.ParentSpanId] = &cloudtrace.TraceSpan{
+				SpanId:    s.ParentSpanId,
+				Kind:      "SPAN_KIND_UNSPECIFIED",
+				Name:      syntheticRootName,
+				StartTime: start,
+				EndTime:   end,
+				Labels:    map[string]string{SyntheticLabel: "true"},
+			}
+			order = append(order, s.ParentSpanId)
+		}
+		for _, id := range order {
+			t.Spans = append(t.Spans, roots[id])
+		}
+		sortSpans(t.Spans)
+	}
+}
+
+// parseTimestamp parses the timestamp of a span, it's zero if invalid.
+func parseTimestamp(ts string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, ts)
+	return t
+}
@@ -0,0 +1,51 @@
+package gcloudtracer
+
+import (
+	"fmt"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// SamplingRule force samples the traces of spans with the tag,
+// see WithSamplingRules.
+type SamplingRule struct {
+	Tag string
+	// Value is matched with the tag value formatted by fmt.Sprint,
+	// the tag matches with any value if it's empty.
+	Value string
+}
+
+func (rule SamplingRule) matches(key string, value interface{}) bool {
+	return key == rule.Tag && (rule.Value == "" || fmt.Sprint(value) == rule.Value)
+}
+
+// forcedTraces remembers traces force sampled by the rules.
+type forcedTraces struct {
+	rules  []SamplingRule
+	traces *traceCounter
+}
+
+func newForcedTraces(rules []SamplingRule) *forcedTraces {
+	return &forcedTraces{rules: rules, traces: newTraceCounter(traceCountWindow)}
+}
+
+// match reports whether the tag matches a rule, forcing the trace if it does.
+func (f *forcedTraces) match(traceID uint64, key string, value interface{}) bool {
+	for _, rule := range f.rules {
+		if rule.matches(key, value) {
+			f.traces.inc(traceID)
+			return true
+		}
+	}
+	return false
+}
+
+// check reports whether the trace is forced, or the tags match a rule.
+func (f *forcedTraces) check(traceID uint64, tags opentracing.Tags) bool {
+	for k, v := range tags {
+		if f.match(traceID, k, v) {
+			return true
+		}
+	}
+	return f.traces.count(traceID) > 0
+}
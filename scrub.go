@@ -0,0 +1,257 @@
+package gcloudtracer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/opentracing/opentracing-go/ext"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
+)
+
+// labelScrubber returns the value of the label uploaded instead,
+// the label is dropped unless keep is true.
+type labelScrubber func(key, value string) (scrubbed string, keep bool)
+
+// DefaultHeaderBlocklist lists headers whose tags are never uploaded
+// in the safe mode, unless replaced by WithHeaderBlocklist.
+var DefaultHeaderBlocklist = []string{
+	"authorization",
+	"proxy-authorization",
+	"cookie",
+	"set-cookie",
+	"x-api-key",
+	"x-auth-token",
+}
+
+// sensitiveParams are query parameters of URLs whose values are redacted
+// in the safe mode.
+var sensitiveParams = map[string]struct{}{
+	"access_token":      {},
+	"api_key":           {},
+	"apikey":            {},
+	"auth":              {},
+	"client_secret":     {},
+	"id_token":          {},
+	"key":               {},
+	"password":          {},
+	"refresh_token":     {},
+	"secret":            {},
+	"sig":               {},
+	"signature":         {},
+	"token":             {},
+	"x-amz-credential":  {},
+	"x-amz-signature":   {},
+	"x-goog-credential": {},
+	"x-goog-signature":  {},
+}
+
+// redacted replaces values of sensitive query parameters.
+const redacted = "redacted"
+
+// safeLabels returns a scrubber of the safe mode, stripping credentials from
+// the http.url label and dropping labels of the blocked headers. A label is
+// of a header if its key is the header name, or ends with it after a dot,
+// a slash or an underscore, e.g. "http.request.header.authorization".
+func safeLabels(blocklist []string) labelScrubber {
+	return func(key, value string) (string, bool) {
+		for _, h := range blocklist {
+			if isHeaderKey(key, h) {
+				return "", false
+			}
+		}
+		if key == string(ext.HTTPUrl) || key == labelMap[string(ext.HTTPUrl)] {
+			return scrubURL(value), true
+		}
+		return value, true
+	}
+}
+
+func isHeaderKey(key, header string) bool {
+	n := len(key) - len(header)
+	if n < 0 || !strings.EqualFold(key[n:], header) {
+		return false
+	}
+	return n == 0 || key[n-1] == '.' || key[n-1] == '/' || key[n-1] == '_'
+}
+
+// scrubURL strips the user information from the URL, and redacts values
+// of its sensitive query parameters.
+func scrubURL(raw string) string {
+	if !strings.ContainsAny(raw, "@?") {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	changed := u.User != nil
+	u.User = nil
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, p := range params {
+			rawName := p
+			if j := strings.IndexByte(p, '='); j >= 0 {
+				rawName = p[:j]
+			}
+			name, err := url.QueryUnescape(rawName)
+			if err != nil {
+				name = rawName
+			}
+			if _, ok := sensitiveParams[strings.ToLower(name)]; ok {
+				params[i] = rawName + "=" + redacted
+				changed = true
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+	if !changed {
+		return raw
+	}
+	return u.String()
+}
+
+// hashLabels returns a scrubber replacing values of the labels of the keys
+// with their hex encoded HMAC-SHA256 keyed by the secret.
+func hashLabels(secret []byte, keys []string) labelScrubber {
+	hashed := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		hashed[k] = struct{}{}
+	}
+	return func(key, value string) (string, bool) {
+		if _, ok := hashed[key]; !ok {
+			return value, true
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil)), true
+	}
+}
+
+// scrub applies the scrubbers to the labels of the trace spans.
+func (r *Recorder) scrub(trace *cloudtrace.Trace) {
+	if len(r.scrubbers) == 0 {
+		return
+	}
+	for _, s := range trace.Spans {
+		for k, v := range s.Labels {
+			if scrubbed, ok := r.scrubLabel(k, v); ok {
+				s.Labels[k] = scrubbed
+			} else {
+				delete(s.Labels, k)
+			}
+		}
+	}
+}
+
+// scrubV2 applies the scrubbers to the attributes of the annotations of
+// the span, converted from log fields, the span attributes are converted
+// from scrubbed labels already. Attributes changed by the scrubbers are
+// uploaded as strings.
+func (r *Recorder) scrubV2(sp *cloudtracev2.Span) {
+	if len(r.scrubbers) == 0 || sp == nil || sp.TimeEvents == nil {
+		return
+	}
+	for _, te := range sp.TimeEvents.TimeEvent {
+		if te.Annotation == nil || te.Annotation.Attributes == nil {
+			continue
+		}
+		attrs := te.Annotation.Attributes.AttributeMap
+		for k, v := range attrs {
+			value := formatTyped(v)
+			if v.StringValue != nil {
+				value = v.StringValue.Value
+			}
+			scrubbed, ok := r.scrubLabel(k, value)
+			if !ok {
+				delete(attrs, k)
+			} else if scrubbed != value {
+				attrs[k] = stringValue(scrubbed)
+			}
+		}
+	}
+}
+
+func (r *Recorder) scrubLabel(key, value string) (string, bool) {
+	for _, s := range r.scrubbers {
+		var ok bool
+		if value, ok = s(key, value); !ok {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// obfuscateSQL returns a scrubber of the db.statement label, see ObfuscateSQL.
+func obfuscateSQL(key, value string) (string, bool) {
+	if key != string(ext.DBStatement) {
+		return value, true
+	}
+	return ObfuscateSQL(value), true
+}
+
+// ObfuscateSQL replaces string and numeric literals of the SQL statement
+// with ?, and removes its comments, so the shape of the query is kept
+// without the data embedded in it. Quoted identifiers are kept.
+func ObfuscateSQL(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// A quote is escaped by doubling it or by a backslash.
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+				} else if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					i++
+					break
+				}
+			}
+			b.WriteByte('?')
+		case c == '"' || c == '`':
+			j := strings.IndexByte(query[i+1:], c) + i + 2
+			if j < i+2 {
+				j = len(query)
+			}
+			b.WriteString(query[i:j])
+			i = j
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			i += j
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				i = len(query)
+			} else {
+				i += j + 4
+			}
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentifier(query[i-1])):
+			for i++; i < len(query) && (isIdentifier(query[i]) || query[i] == '.'); i++ {
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// isIdentifier reports whether the character may be a part of an identifier,
+// or of a placeholder like $1.
+func isIdentifier(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
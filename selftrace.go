@@ -0,0 +1,95 @@
+package gcloudtracer
+
+import (
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// SelfTracingComponent is the component tag of the spans of uploads
+// recorded by the Recorder, see WithSelfTracing.
+const SelfTracingComponent = "gcloudtracer"
+
+// Tags of the spans of uploads.
+const (
+	SelfTracingProjectTag = "gcloudtracer.project"
+	SelfTracingTracesTag  = "gcloudtracer.traces"
+	SelfTracingSpansTag   = "gcloudtracer.spans"
+)
+
+// selfTraced returns the write function recording a span of every write
+// of the method. Writes of only spans of uploads aren't traced, otherwise
+// every upload would be followed by an upload of its own span.
+func (r *Recorder) selfTraced(project, method string, write writeFunc) writeFunc {
+	return func(traces []*cloudtrace.Trace) error {
+		if onlySelfTraces(traces) {
+			return write(traces)
+		}
+		start := time.Now()
+		err := write(traces)
+
+		var spans int
+		for _, t := range traces {
+			spans += len(t.Spans)
+		}
+		_, traceID := r.ids.TraceID()
+		sp := RawSpan{
+			Context: SpanContext{
+				TraceID: traceID,
+				SpanID:  r.ids.SpanID(),
+				Sampled: true,
+			},
+			Operation: SelfTracingComponent + "/" + method,
+			Start:     start,
+			Duration:  time.Since(start),
+			Tags: opentracing.Tags{
+				string(ext.Component): SelfTracingComponent,
+				string(ext.SpanKind):  string(ext.SpanKindRPCClientEnum),
+				SelfTracingProjectTag: project,
+				SelfTracingTracesTag:  len(traces),
+				SelfTracingSpansTag:   spans,
+			},
+		}
+		if err != nil {
+			sp.Tags[string(ext.Error)] = true
+			sp.Tags["error.message"] = err.Error()
+		}
+		r.recordSelfSpan(sp)
+		return err
+	}
+}
+
+// recordSelfSpan records the span of an upload. A synchronous upload runs
+// within recordSpan, which holds closeMu already, so the span is uploaded
+// without taking it again.
+func (r *Recorder) recordSelfSpan(sp RawSpan) {
+	if !r.synchronous {
+		r.RecordSpan(sp)
+		return
+	}
+	set := r.currentSettings()
+	if !inSample(sp.Context.TraceID, set.sampleBound) {
+		return
+	}
+	project, trace := r.convert(&sp, set, spanOverrides(sp.Tags))
+	if trace == nil {
+		return
+	}
+	r.scrub(trace)
+	r.enqueue(project, sp.Context.TraceID, trace, r.convertV2(trace, &sp))
+}
+
+// onlySelfTraces reports whether all the spans of the traces are spans
+// of uploads.
+func onlySelfTraces(traces []*cloudtrace.Trace) bool {
+	for _, t := range traces {
+		for _, s := range t.Spans {
+			if s.Labels[string(ext.Component)] != SelfTracingComponent || s.Labels[SelfTracingProjectTag] == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package gcloudtracer
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FlushOnShutdown shuts down the Recorder when the process receives SIGTERM
+// or SIGINT, waiting up to the timeout for buffered spans to be uploaded.
+// The signal is sent on the returned channel afterwards, so the caller can
+// shut down the rest of the process and exit. A second signal isn't caught,
+// and terminates the process as usual. The returned function removes
+// the hook, it can be called more than once.
+func FlushOnShutdown(rec *Recorder, timeout time.Duration) (shutdown <-chan os.Signal, stop func()) {
+	sigs := make(chan os.Signal, 1)
+	out := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(sigs)
+			close(done)
+		})
+	}
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-sigs:
+			stop()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if err := rec.Shutdown(ctx); err != nil {
+				rec.log.Errorf("failed to flush traces on %s: %s", sig, err)
+			}
+			cancel()
+			out <- sig
+		}
+	}()
+
+	return out, stop
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+// +build !windows
+
+package gcloudtracer
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushOnShutdown(t *testing.T) {
+	var uploads int32
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&uploads, 1)
+		w.Write([]byte("{}"))
+	})
+	defer srv.Close()
+
+	t.Run("signal=sigterm", func(t *testing.T) {
+		shutdown, stop := FlushOnShutdown(rec, time.Second)
+		defer stop()
+		rec.RecordSpan(testSpan(1, 1))
+		assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+		select {
+		case sig := <-shutdown:
+			assert.Equal(t, syscall.SIGTERM, sig)
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal not handed back")
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&uploads))
+		assert.Equal(t, ErrRecorderClosed, rec.Flush(context.Background()))
+	})
+
+	t.Run("hook=stopped", func(t *testing.T) {
+		shutdown, stop := FlushOnShutdown(rec, time.Second)
+		stop()
+		select {
+		case <-shutdown:
+			t.Fatal("signal handed back without a signal")
+		case <-time.After(10 * time.Millisecond):
+		}
+		assert.NotPanics(t, stop)
+	})
+}
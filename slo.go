@@ -0,0 +1,31 @@
+package gcloudtracer
+
+import "time"
+
+// SLOFunc is called with a finished span slower than the threshold
+// of its operation, see WithSLO.
+type SLOFunc func(sp RawSpan, threshold time.Duration)
+
+// sloHook calls the function with spans over the thresholds.
+type sloHook struct {
+	thresholds map[string]time.Duration
+	breached   SLOFunc
+}
+
+// check calls the function if the span is slower than the threshold of its
+// operation, or the threshold of the empty operation if it has none.
+func (h *sloHook) check(sp RawSpan) {
+	threshold, ok := h.thresholds[sp.Operation]
+	if !ok {
+		threshold, ok = h.thresholds[""]
+	}
+	if ok && sp.Duration > threshold {
+		h.breached(sp, threshold)
+	}
+}
+
+// checkSLO runs the SLO hook, a panic is logged as the span not breaching it.
+func (r *Recorder) checkSLO(sp RawSpan) {
+	defer r.recoverPanic("checking SLO", 0)
+	r.slo.check(sp)
+}
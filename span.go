@@ -0,0 +1,228 @@
+package gcloudtracer
+
+import (
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// SpanContext is the context of a span started by the Tracer.
+type SpanContext struct {
+	// TraceIDHigh holds the high 64 bits of a 128-bit trace identifier,
+	// it's zero for a 64-bit one.
+	TraceIDHigh uint64
+	TraceID     uint64
+	SpanID      uint64
+	Sampled     bool
+	// Debug forces sampling of the trace by every Tracer it's propagated to,
+	// see WithDebugHeader.
+	Debug   bool
+	Baggage map[string]string
+}
+
+// ForeachBaggageItem belongs to the opentracing.SpanContext interface.
+func (c SpanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	for k, v := range c.Baggage {
+		if !handler(k, v) {
+			break
+		}
+	}
+}
+
+// TraceIDString returns the trace identifier as uploaded to Cloud Trace.
+func (c SpanContext) TraceIDString() string {
+	return formatTraceID(c.TraceIDHigh, c.TraceID)
+}
+
+// WithBaggageItem returns a copy of the context with the baggage item set.
+func (c SpanContext) WithBaggageItem(key, val string) SpanContext {
+	baggage := make(map[string]string, len(c.Baggage)+1)
+	for k, v := range c.Baggage {
+		baggage[k] = v
+	}
+	baggage[key] = val
+	c.Baggage = baggage
+	return c
+}
+
+// RawSpan is a finished span recorded by the Recorder.
+type RawSpan struct {
+	// Context is the context of the span, its baggage is uploaded
+	// if enabled, see WithBaggageLabels.
+	Context SpanContext
+	// ParentSpanID is zero for a root span.
+	ParentSpanID uint64
+	Operation    string
+	Start        time.Time
+	Duration     time.Duration
+	Tags         opentracing.Tags
+	Logs         []opentracing.LogRecord
+}
+
+// SpanRecorder records finished spans, the Recorder implements it.
+type SpanRecorder interface {
+	RecordSpan(sp RawSpan)
+}
+
+// span is a span of the Tracer, recorded once finished.
+// It's read-only afterwards, as the Recorder may still be converting it.
+type span struct {
+	tracer *Tracer
+
+	mu       sync.Mutex
+	raw      RawSpan
+	finished bool
+	// started is the operation the span is counted active of by Tracez.
+	started string
+}
+
+func (s *span) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *span) FinishWithOptions(opts opentracing.FinishOptions) {
+	finish := opts.FinishTime
+	if finish.IsZero() {
+		finish = time.Now()
+	}
+
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	for _, lr := range opts.LogRecords {
+		s.appendLog(lr)
+	}
+	for _, ld := range opts.BulkLogData {
+		s.appendLog(ld.ToLogRecord())
+	}
+	s.finished = true
+	s.raw.Duration = finish.Sub(s.raw.Start)
+	raw := s.raw
+	s.mu.Unlock()
+
+	if tz := s.tracer.tracez; tz != nil {
+		tz.finish(s.started)
+	}
+	s.tracer.rec.RecordSpan(raw)
+}
+
+func (s *span) Context() opentracing.SpanContext {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.raw.Context
+}
+
+func (s *span) SetOperationName(operationName string) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.finished {
+		s.raw.Operation = operationName
+	}
+	return s
+}
+
+func (s *span) SetTag(key string, value interface{}) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return s
+	}
+	s.applySamplingPriority(key, value)
+	s.applySamplingRules(key, value)
+	if prev, ok := s.raw.Tags[key]; ok {
+		value = s.tracer.rec.merge.joinTag(key, prev, value)
+	}
+	s.raw.Tags[key] = value
+	return s
+}
+
+// applySamplingRules samples the span and forces its trace if the tag
+// matches a sampling rule of the recorder.
+func (s *span) applySamplingRules(key string, value interface{}) {
+	if f := s.tracer.forced; f != nil && f.match(s.raw.Context.TraceID, key, value) {
+		s.raw.Context.Sampled = true
+	}
+}
+
+// applySamplingPriority samples the span if the tag is ext.SamplingPriority
+// with a positive value, or drops it if the value is zero.
+func (s *span) applySamplingPriority(key string, value interface{}) {
+	if key != string(ext.SamplingPriority) {
+		return
+	}
+	if v, ok := value.(uint16); ok {
+		s.raw.Context.Sampled = v > 0
+	}
+}
+
+func (s *span) LogFields(fields ...log.Field) {
+	lr := opentracing.LogRecord{Timestamp: time.Now(), Fields: fields}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendLog(lr)
+}
+
+func (s *span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := log.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(log.Error(err), log.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+// appendLog keeps the log unless the span is finished or has too many logs,
+// the caller holds the lock.
+func (s *span) appendLog(lr opentracing.LogRecord) {
+	if s.finished || len(s.raw.Logs) >= maxLogsPerSpan {
+		return
+	}
+	s.raw.Logs = append(s.raw.Logs, lr)
+}
+
+func (s *span) SetBaggageItem(key, val string) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return s
+	}
+	baggage := make(map[string]string, len(s.raw.Context.Baggage)+1)
+	for k, v := range s.raw.Context.Baggage {
+		baggage[k] = v
+	}
+	baggage[key] = val
+	s.raw.Context.Baggage = baggage
+	return s
+}
+
+func (s *span) BaggageItem(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.raw.Context.Baggage[key]
+}
+
+func (s *span) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+func (s *span) LogEvent(event string) {
+	s.LogFields(log.String("event", event))
+}
+
+func (s *span) LogEventWithPayload(event string, payload interface{}) {
+	s.LogFields(log.String("event", event), log.Object("payload", payload))
+}
+
+func (s *span) Log(ld opentracing.LogData) {
+	if ld.Timestamp.IsZero() {
+		ld.Timestamp = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendLog(ld.ToLogRecord())
+}
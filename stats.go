@@ -0,0 +1,211 @@
+package gcloudtracer
+
+import (
+	"sync/atomic"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// Reasons of spans dropped by the Recorder, see Stats.Drops.
+const (
+	DropUnsampled       = "unsampled"
+	DropFiltered        = "filtered"
+	DropTraceLimited    = "trace_limited"
+	DropRateLimited     = "rate_limited"
+	DropBudgetThrottled = "budget_throttled"
+	DropConversion      = "conversion_failed"
+	DropOverflow        = "overflow"
+	DropEvicted         = "evicted"
+	DropPanicked        = "panicked"
+	DropClosed          = "closed"
+	DropUploadFailed    = "upload_failed"
+	DropInvalid         = "invalid"
+)
+
+// Stats holds counters of the Recorder.
+type Stats struct {
+	// Unsampled is a number of spans dropped by the sampler of the tracer
+	// or the sampling rate, including those kept by WithUnsampledExporter
+	// or WithRecentTraces.
+	Unsampled uint64
+	// Filtered is a number of spans dropped by filters or processors.
+	Filtered uint64
+	// RateLimited is a number of spans dropped by the rate limit.
+	RateLimited uint64
+	// TraceLimited is a number of spans dropped by the limit of spans per trace.
+	TraceLimited uint64
+	// BudgetThrottled is a number of spans dropped by the daily budget.
+	BudgetThrottled uint64
+	// BudgetUsed is a number of spans accepted today within the daily budget.
+	BudgetUsed uint64
+	// Panicked is a number of spans dropped by panics recovered in the pipeline.
+	Panicked uint64
+	// Evicted is a number of buffered spans dropped to make room for newer ones,
+	// see EvictOldest.
+	Evicted uint64
+	// ConversionFailed is a number of spans dropped by the converter,
+	// see WithConverter.
+	ConversionFailed uint64
+	// Overflowed is a number of spans dropped because the buffer was full.
+	Overflowed uint64
+	// Closed is a number of spans recorded after the Recorder was closed.
+	Closed uint64
+	// Invalid is a number of spans violating constraints of Cloud Trace,
+	// see WithStrictMode.
+	Invalid uint64
+	// FailedSpans is a number of spans of uploads failed after all the attempts.
+	FailedSpans uint64
+	// Bucketed is a number of spans named OtherOperation because their
+	// operations are over the limit, see WithMaxOperationNames.
+	Bucketed uint64
+	// Uploads is a number of successful uploads.
+	Uploads uint64
+	// UploadFailures is a number of uploads failed after all the attempts.
+	UploadFailures uint64
+	// UploadedTraces is a number of traces uploaded successfully.
+	UploadedTraces uint64
+	// UploadedSpans is a number of spans uploaded successfully.
+	UploadedSpans uint64
+	// UploadedBytes is approximate size of the spans uploaded successfully.
+	UploadedBytes uint64
+	// UploadTime is the total time of uploads, including retries.
+	UploadTime time.Duration
+	// LastUploadTime is the time of the last upload, including retries.
+	LastUploadTime time.Duration
+	// SlowUploads is a number of uploads slower than the threshold set by
+	// WithSlowUploadThreshold.
+	SlowUploads uint64
+	// FallbackExports is a number of uploads written to the fallback exporter
+	// instead of Cloud Trace, see WithFallback. They aren't counted
+	// in Uploads.
+	FallbackExports uint64
+	// FallbackSpans is a number of spans written to the fallback exporter.
+	FallbackSpans uint64
+}
+
+// Stats returns current counters of the Recorder.
+func (r *Recorder) Stats() Stats {
+	s := Stats{
+		Unsampled:        atomic.LoadUint64(&r.stats.unsampled),
+		Filtered:         atomic.LoadUint64(&r.stats.filtered),
+		RateLimited:      atomic.LoadUint64(&r.stats.rateLimited),
+		TraceLimited:     atomic.LoadUint64(&r.stats.traceLimited),
+		BudgetThrottled:  atomic.LoadUint64(&r.stats.budgetThrottled),
+		Panicked:         atomic.LoadUint64(&r.stats.panicked),
+		Evicted:          atomic.LoadUint64(&r.stats.evicted),
+		ConversionFailed: atomic.LoadUint64(&r.stats.conversionFailed),
+		Overflowed:       atomic.LoadUint64(&r.stats.overflowed),
+		Closed:           atomic.LoadUint64(&r.stats.closed),
+		Invalid:          atomic.LoadUint64(&r.stats.invalid),
+		FailedSpans:      atomic.LoadUint64(&r.stats.failedSpans),
+		Bucketed:         atomic.LoadUint64(&r.stats.bucketed),
+		Uploads:          atomic.LoadUint64(&r.stats.uploads),
+		UploadFailures:   atomic.LoadUint64(&r.failures),
+		UploadedTraces:   atomic.LoadUint64(&r.stats.uploadedTraces),
+		UploadedSpans:    atomic.LoadUint64(&r.stats.uploadedSpans),
+		UploadedBytes:    atomic.LoadUint64(&r.stats.uploadedBytes),
+		UploadTime:       time.Duration(atomic.LoadInt64(&r.stats.uploadTime)),
+		LastUploadTime:   time.Duration(atomic.LoadInt64(&r.stats.lastUploadTime)),
+		SlowUploads:      atomic.LoadUint64(&r.stats.slowUploads),
+		FallbackExports:  atomic.LoadUint64(&r.stats.fallbackExports),
+		FallbackSpans:    atomic.LoadUint64(&r.stats.fallbackSpans),
+	}
+	if r.budget != nil {
+		s.BudgetUsed = r.budget.usage()
+	}
+	return s
+}
+
+// Drops returns the numbers of spans dropped by reason, see DropUnsampled.
+func (s Stats) Drops() map[string]uint64 {
+	return map[string]uint64{
+		DropUnsampled:       s.Unsampled,
+		DropFiltered:        s.Filtered,
+		DropTraceLimited:    s.TraceLimited,
+		DropRateLimited:     s.RateLimited,
+		DropBudgetThrottled: s.BudgetThrottled,
+		DropConversion:      s.ConversionFailed,
+		DropOverflow:        s.Overflowed,
+		DropEvicted:         s.Evicted,
+		DropPanicked:        s.Panicked,
+		DropClosed:          s.Closed,
+		DropUploadFailed:    s.FailedSpans,
+		DropInvalid:         s.Invalid,
+	}
+}
+
+// counters holds the counters of the Recorder updated atomically.
+type counters struct {
+	unsampled        uint64
+	filtered         uint64
+	rateLimited      uint64
+	traceLimited     uint64
+	budgetThrottled  uint64
+	panicked         uint64
+	evicted          uint64
+	conversionFailed uint64
+	overflowed       uint64
+	closed           uint64
+	invalid          uint64
+	failedSpans      uint64
+	bucketed         uint64
+	uploads          uint64
+	uploadedTraces   uint64
+	uploadedSpans    uint64
+	uploadedBytes    uint64
+	uploadTime       int64
+	lastUploadTime   int64
+	slowUploads      uint64
+	fallbackExports  uint64
+	fallbackSpans    uint64
+}
+
+// countDropped counts spans of the trace dropped because the buffer was full,
+// or the bundler was closed.
+func (r *Recorder) countDropped(trace *cloudtrace.Trace, err error) {
+	if err == ErrBufferFull {
+		atomic.AddUint64(&r.stats.overflowed, uint64(len(trace.Spans)))
+	} else {
+		atomic.AddUint64(&r.stats.closed, uint64(len(trace.Spans)))
+	}
+}
+
+// countEvicted counts spans evicted from the buffer.
+func (r *Recorder) countEvicted(spans int) {
+	atomic.AddUint64(&r.stats.evicted, uint64(spans))
+}
+
+// countUpload counts the upload of the traces which took the duration,
+// logging it if it's slower than the threshold.
+func (r *Recorder) countUpload(project string, traces []*cloudtrace.Trace, d time.Duration, err error) {
+	atomic.AddInt64(&r.stats.uploadTime, int64(d))
+	atomic.StoreInt64(&r.stats.lastUploadTime, int64(d))
+	var spans, size int
+	for _, t := range traces {
+		spans += len(t.Spans)
+		size += traceSize(t)
+	}
+	if r.slowUpload > 0 && d > r.slowUpload {
+		atomic.AddUint64(&r.stats.slowUploads, 1)
+		r.log.Errorf("slow upload of %d traces (%d spans, %d bytes) to project %s took %s", len(traces), spans, size, project, d)
+	}
+	if err != nil {
+		atomic.AddUint64(&r.stats.failedSpans, uint64(spans))
+		return
+	}
+	atomic.AddUint64(&r.stats.uploads, 1)
+	atomic.AddUint64(&r.stats.uploadedTraces, uint64(len(traces)))
+	atomic.AddUint64(&r.stats.uploadedSpans, uint64(spans))
+	atomic.AddUint64(&r.stats.uploadedBytes, uint64(size))
+}
+
+// countFallback counts the traces written to the fallback exporter.
+func (r *Recorder) countFallback(traces []*cloudtrace.Trace) {
+	var spans int
+	for _, t := range traces {
+		spans += len(t.Spans)
+	}
+	atomic.AddUint64(&r.stats.fallbackExports, 1)
+	atomic.AddUint64(&r.stats.fallbackSpans, uint64(spans))
+}
@@ -0,0 +1,137 @@
+package gcloudtracer
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go/ext"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
+)
+
+// Tags of the gRPC status of a span, the code is either a number
+// or a name like "NOT_FOUND".
+const (
+	GRPCStatusCodeTag    = "grpc.status_code"
+	GRPCStatusMessageTag = "grpc.status_message"
+)
+
+// Canonical status codes, see google.rpc.Code.
+const (
+	codeOK                = 0
+	codeUnknown           = 2
+	codeInvalidArgument   = 3
+	codeDeadlineExceeded  = 4
+	codeNotFound          = 5
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeUnavailable       = 14
+	codeUnauthenticated   = 16
+)
+
+var grpcCodes = map[string]int64{
+	"OK":                  0,
+	"CANCELLED":           1,
+	"UNKNOWN":             2,
+	"INVALID_ARGUMENT":    3,
+	"DEADLINE_EXCEEDED":   4,
+	"NOT_FOUND":           5,
+	"ALREADY_EXISTS":      6,
+	"PERMISSION_DENIED":   7,
+	"RESOURCE_EXHAUSTED":  8,
+	"FAILED_PRECONDITION": 9,
+	"ABORTED":             10,
+	"OUT_OF_RANGE":        11,
+	"UNIMPLEMENTED":       12,
+	"INTERNAL":            13,
+	"UNAVAILABLE":         14,
+	"DATA_LOSS":           15,
+	"UNAUTHENTICATED":     16,
+}
+
+// spanStatusV2 derives the status of the span from the gRPC status tags,
+// the HTTP status code or the error tag. It's nil for succeeded spans.
+func spanStatusV2(labels map[string]string, raw *RawSpan) *cloudtracev2.Status {
+	var tags map[string]interface{}
+	if raw != nil {
+		tags = raw.Tags
+	}
+
+	if code, ok := grpcCode(tags[GRPCStatusCodeTag], labels[GRPCStatusCodeTag]); ok {
+		if code == codeOK {
+			return nil
+		}
+		return &cloudtracev2.Status{Code: code, Message: labels[GRPCStatusMessageTag]}
+	}
+
+	if status, err := strconv.Atoi(labels[labelMap[string(ext.HTTPStatusCode)]]); err == nil {
+		code := httpCode(status)
+		if code == codeOK {
+			return nil
+		}
+		return &cloudtracev2.Status{Code: code, Message: http.StatusText(status)}
+	}
+
+	if isError(tags[string(ext.Error)], labels[string(ext.Error)]) {
+		return &cloudtracev2.Status{Code: codeUnknown}
+	}
+	return nil
+}
+
+// grpcCode returns the code of the tag, or of its label if the tag
+// isn't an integer, such as codes.Code.
+func grpcCode(tag interface{}, label string) (int64, bool) {
+	v := reflect.ValueOf(tag)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	}
+	if label == "" {
+		return 0, false
+	}
+	if code, err := strconv.ParseInt(label, 10, 64); err == nil {
+		return code, true
+	}
+	code, ok := grpcCodes[strings.ToUpper(label)]
+	return code, ok
+}
+
+// httpCode maps the HTTP status code to the canonical code.
+func httpCode(status int) int64 {
+	switch {
+	case status < 200:
+		return codeUnknown
+	case status < 400:
+		return codeOK
+	}
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidArgument
+	case http.StatusUnauthorized:
+		return codeUnauthenticated
+	case http.StatusForbidden:
+		return codePermissionDenied
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusTooManyRequests:
+		return codeResourceExhausted
+	case http.StatusNotImplemented:
+		return codeUnimplemented
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	case http.StatusGatewayTimeout:
+		return codeDeadlineExceeded
+	}
+	return codeUnknown
+}
+
+func isError(tag interface{}, label string) bool {
+	if v, ok := formatTag(tag); ok {
+		return v == "true"
+	}
+	return label == "true"
+}
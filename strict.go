@@ -0,0 +1,114 @@
+package gcloudtracer
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// Limits of Cloud Trace checked in the strict mode.
+const (
+	maxNameBytes         = 128
+	maxLabelKeyBytes     = 128
+	maxLabelValueBytes   = 16 * 1024
+	maxLabelValueBytesV2 = 256
+)
+
+// ViolationFunc is called in the strict mode with a span of the trace
+// violating constraints of Cloud Trace, and the reasons, see WithStrictMode.
+type ViolationFunc func(project, traceID string, span *cloudtrace.TraceSpan, reasons []string)
+
+// spanKinds are the kinds of spans known by the API.
+var spanKinds = map[string]bool{
+	"SPAN_KIND_UNSPECIFIED": true,
+	"RPC_SERVER":            true,
+	"RPC_CLIENT":            true,
+}
+
+// checkStrict reports the spans of the trace violating constraints of
+// Cloud Trace and removes them from the trace. It reports whether any
+// span is left.
+func (r *Recorder) checkStrict(project string, trace *cloudtrace.Trace) bool {
+	spans := trace.Spans[:0]
+	for _, s := range trace.Spans {
+		reasons := r.violations(trace.TraceId, s)
+		if len(reasons) == 0 {
+			spans = append(spans, s)
+			continue
+		}
+		atomic.AddUint64(&r.stats.invalid, 1)
+		r.strict(project, trace.TraceId, s, reasons)
+	}
+	trace.Spans = spans
+	return len(spans) > 0
+}
+
+// violations returns the reasons the span of the trace violates constraints
+// of Cloud Trace, or would be changed to fit them.
+func (r *Recorder) violations(traceID string, s *cloudtrace.TraceSpan) []string {
+	var reasons []string
+	if _, err := parseTraceID(traceID); err != nil {
+		reasons = append(reasons, fmt.Sprintf("trace id %q isn't 32 hexadecimal characters", traceID))
+	} else if traceID == "00000000000000000000000000000000" {
+		reasons = append(reasons, "trace id is zero")
+	}
+	if s.SpanId == 0 {
+		reasons = append(reasons, "span id is zero")
+	} else if s.ParentSpanId == s.SpanId {
+		reasons = append(reasons, fmt.Sprintf("span %016x is its own parent", s.SpanId))
+	}
+	if s.Name == "" {
+		reasons = append(reasons, "name is empty")
+	} else if len(s.Name) > maxNameBytes {
+		reasons = append(reasons, fmt.Sprintf("name %q is %d bytes, the limit is %d", abbreviate(s.Name), len(s.Name), maxNameBytes))
+	}
+	if s.Kind != "" && !spanKinds[s.Kind] {
+		reasons = append(reasons, fmt.Sprintf("kind %q is invalid", s.Kind))
+	}
+	start, startErr := time.Parse(time.RFC3339Nano, s.StartTime)
+	end, endErr := time.Parse(time.RFC3339Nano, s.EndTime)
+	if w, ok := s.Labels[TimestampWarningLabel]; ok {
+		reasons = append(reasons, "timestamps are invalid: "+w)
+	} else if startErr != nil {
+		reasons = append(reasons, fmt.Sprintf("start time %q is invalid", s.StartTime))
+	} else if endErr != nil {
+		reasons = append(reasons, fmt.Sprintf("end time %q is invalid", s.EndTime))
+	} else if end.Before(start) {
+		reasons = append(reasons, fmt.Sprintf("ends at %s before it starts at %s", s.EndTime, s.StartTime))
+	}
+
+	maxValue := maxLabelValueBytes
+	if r.v2 {
+		maxValue = maxLabelValueBytesV2
+		if len(s.Labels) > maxAttributesV2 {
+			reasons = append(reasons, fmt.Sprintf("%d labels, the limit of attributes is %d", len(s.Labels), maxAttributesV2))
+		}
+	}
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := s.Labels[k]
+		if len(k) > maxLabelKeyBytes {
+			reasons = append(reasons, fmt.Sprintf("label key %q is %d bytes, the limit is %d", abbreviate(k), len(k), maxLabelKeyBytes))
+		}
+		if len(v) > maxValue {
+			reasons = append(reasons, fmt.Sprintf("label %q is %d bytes, the limit is %d", abbreviate(k), len(v), maxValue))
+		}
+	}
+	return reasons
+}
+
+// abbreviate shortens the string to be quoted in a reason.
+func abbreviate(s string) string {
+	const max = 32
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
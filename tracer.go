@@ -1,16 +1,170 @@
 package gcloudtracer
 
 import (
-	basictracer "github.com/opentracing/basictracer-go"
+	"fmt"
+	"strings"
+	"time"
+
 	opentracing "github.com/opentracing/opentracing-go"
 	"golang.org/x/net/context"
 )
 
-// NewTracer creates new basictracer for GCloud StackDriver.
+// ReferencesTag is the tag listing references of a span started with more
+// than one reference or a follows_from reference, for example
+// "follows_from:<trace id>/<span id>". The tracer keeps just the first
+// reference as the parent, the tag keeps the others visible in the trace.
+const ReferencesTag = "references"
+
+// maxLogsPerSpan limits the number of logs kept by a span.
+const maxLogsPerSpan = 100
+
+// Tracer is an opentracing.Tracer recording finished spans with the Recorder.
+type Tracer struct {
+	rec        *Recorder
+	ids        IDGenerator
+	sample     func(traceID uint64) bool
+	traceID128 bool
+	forced     *forcedTraces
+	// debugHeader forces sampling of requests carrying it, see WithDebugHeader.
+	debugHeader string
+	tracez      *Tracez
+}
+
+// NewTracer creates new Tracer for GCloud StackDriver.
 func NewTracer(ctx context.Context, opts ...Option) (opentracing.Tracer, error) {
 	recorder, err := NewRecorder(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return basictracer.New(recorder), nil
+
+	options := defaultOptions()
+	for _, o := range opts {
+		o(&options)
+	}
+	return newTracer(recorder, &options), nil
+}
+
+func newTracer(rec *Recorder, o *Options) *Tracer {
+	t := &Tracer{
+		rec:         rec,
+		ids:         rec.ids,
+		sample:      o.sampler,
+		traceID128:  o.traceID128,
+		forced:      rec.forced,
+		debugHeader: o.debugHeader,
+		tracez:      o.tracez,
+	}
+	if t.sample == nil {
+		t.sample = func(uint64) bool { return true }
+	}
+	return t
+}
+
+// StartSpan starts a span, continuing the trace of the first reference
+// and setting ReferencesTag if needed.
+func (t *Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var sso opentracing.StartSpanOptions
+	for _, o := range opts {
+		o.Apply(&sso)
+	}
+
+	start := sso.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+	tags := make(opentracing.Tags, len(sso.Tags)+1)
+	for k, v := range sso.Tags {
+		tags[k] = v
+	}
+	if refs := formatReferences(sso.References); refs != "" {
+		tags[ReferencesTag] = refs
+	}
+
+	s := &span{
+		tracer: t,
+		raw: RawSpan{
+			Operation: operationName,
+			Start:     start,
+			Tags:      tags,
+		},
+	}
+	parent, ok := parentContext(sso.References)
+	// A context extracted from just the debug header has no trace yet.
+	if ok && parent.TraceID != 0 {
+		s.raw.Context = SpanContext{
+			TraceIDHigh: parent.TraceIDHigh,
+			TraceID:     parent.TraceID,
+			Sampled:     parent.Sampled,
+		}
+		s.raw.ParentSpanID = parent.SpanID
+		if len(parent.Baggage) > 0 {
+			s.raw.Context.Baggage = make(map[string]string, len(parent.Baggage))
+			for k, v := range parent.Baggage {
+				s.raw.Context.Baggage[k] = v
+			}
+		}
+	} else {
+		s.raw.Context.TraceIDHigh, s.raw.Context.TraceID = t.ids.TraceID()
+		if !t.traceID128 {
+			s.raw.Context.TraceIDHigh = 0
+		}
+		s.raw.Context.Sampled = t.sample(s.raw.Context.TraceID)
+	}
+	s.raw.Context.SpanID = t.ids.SpanID()
+	if ok && parent.Debug {
+		s.raw.Context.Debug = true
+		s.raw.Context.Sampled = true
+		if t.forced != nil {
+			t.forced.traces.inc(s.raw.Context.TraceID)
+		}
+	}
+
+	for k, v := range tags {
+		s.applySamplingPriority(k, v)
+		s.applySamplingRules(k, v)
+	}
+	if t.tracez != nil {
+		s.started = operationName
+		t.tracez.start(operationName)
+	}
+	return s
+}
+
+// parentContext returns the context of the first reference started by
+// this tracer.
+func parentContext(refs []opentracing.SpanReference) (SpanContext, bool) {
+	for _, ref := range refs {
+		if sc, ok := spanContext(ref.ReferencedContext); ok {
+			return sc, true
+		}
+	}
+	return SpanContext{}, false
+}
+
+// spanContext converts the context of a span started by this tracer.
+func spanContext(ctx opentracing.SpanContext) (SpanContext, bool) {
+	sc, ok := ctx.(SpanContext)
+	return sc, ok
+}
+
+// formatReferences returns the value of ReferencesTag, it's empty
+// for a span with no references or just the parent.
+func formatReferences(refs []opentracing.SpanReference) string {
+	if len(refs) == 0 || len(refs) == 1 && refs[0].Type == opentracing.ChildOfRef {
+		return ""
+	}
+
+	formatted := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		sc, ok := spanContext(ref.ReferencedContext)
+		if !ok {
+			continue
+		}
+		typ := "child_of"
+		if ref.Type == opentracing.FollowsFromRef {
+			typ = "follows_from"
+		}
+		formatted = append(formatted, fmt.Sprintf("%s:%s/%d", typ, formatTraceID(sc.TraceIDHigh, sc.TraceID), sc.SpanID))
+	}
+	return strings.Join(formatted, ",")
 }
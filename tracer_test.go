@@ -1,12 +1,24 @@
 package gcloudtracer
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/option"
 )
 
+var clientOpt = option.WithHTTPClient(http.DefaultClient)
+
 func TestTracer(t *testing.T) {
 	t.Run("tracer=success", func(t *testing.T) {
 		tracer, err := NewTracer(
@@ -27,3 +39,393 @@ func TestTracer(t *testing.T) {
 		assert.Nil(t, tracer)
 	})
 }
+
+func TestFormatReferences(t *testing.T) {
+	parent := SpanContext{TraceID: 1, SpanID: 2}
+	cause := SpanContext{TraceID: 3, SpanID: 4}
+
+	t.Run("refs=none", func(t *testing.T) {
+		assert.Empty(t, formatReferences(nil))
+	})
+
+	t.Run("refs=parent", func(t *testing.T) {
+		assert.Empty(t, formatReferences([]opentracing.SpanReference{opentracing.ChildOf(parent)}))
+	})
+
+	t.Run("refs=follows_from", func(t *testing.T) {
+		assert.Equal(t,
+			"follows_from:00000000000000010000000000000001/2",
+			formatReferences([]opentracing.SpanReference{opentracing.FollowsFrom(parent)}),
+		)
+	})
+
+	t.Run("refs=many", func(t *testing.T) {
+		assert.Equal(t,
+			"child_of:00000000000000010000000000000001/2,follows_from:00000000000000030000000000000003/4",
+			formatReferences([]opentracing.SpanReference{opentracing.ChildOf(parent), opentracing.FollowsFrom(cause)}),
+		)
+	})
+}
+
+func TestRandomIDGenerator(t *testing.T) {
+	g := newRandomIDGenerator()
+	seen := make(map[uint64]bool)
+	for i := 0; i < 1000; i++ {
+		high, low := g.TraceID()
+		span := g.SpanID()
+		for _, id := range []uint64{high, low, span} {
+			assert.NotZero(t, id)
+			assert.False(t, seen[id])
+			seen[id] = true
+		}
+	}
+}
+
+// sequentialIDs generates identifiers counting from one.
+type sequentialIDs struct {
+	next uint64
+}
+
+func (g *sequentialIDs) TraceID() (high, low uint64) {
+	return atomic.AddUint64(&g.next, 1), atomic.AddUint64(&g.next, 1)
+}
+
+func (g *sequentialIDs) SpanID() uint64 {
+	return atomic.AddUint64(&g.next, 1)
+}
+
+func TestTracerSpans(t *testing.T) {
+	var mu sync.Mutex
+	var spans []*cloudtrace.TraceSpan
+	var traceIDs []string
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		for _, tr := range req.Traces {
+			spans = append(spans, tr.Spans...)
+			for range tr.Spans {
+				traceIDs = append(traceIDs, tr.TraceId)
+			}
+		}
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithIDGenerator(&sequentialIDs{}))
+	defer srv.Close()
+
+	t.Run("trace_id=64bit", func(t *testing.T) {
+		spans, traceIDs = nil, nil
+		tracer := newTracer(rec, &Options{})
+		root := tracer.StartSpan("root")
+		child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()), opentracing.Tag{Key: "component", Value: "test"})
+		child.SetBaggageItem("user", "1")
+		child.LogKV("event", "done")
+		child.Finish()
+		child.SetTag("ignored", true)
+		root.Finish()
+
+		if assert.Len(t, spans, 2) {
+			assert.Equal(t, "child", spans[0].Name)
+			assert.Equal(t, uint64(4), spans[0].SpanId)
+			assert.Equal(t, uint64(3), spans[0].ParentSpanId)
+			assert.Equal(t, "test", spans[0].Labels["component"])
+			assert.NotContains(t, spans[0].Labels, "ignored")
+			assert.Contains(t, spans[0].Labels[eventKey(0)], "event=done")
+			assert.Equal(t, uint64(3), spans[1].SpanId)
+			assert.Equal(t, []string{"00000000000000020000000000000002", "00000000000000020000000000000002"}, traceIDs)
+		}
+		assert.Equal(t, "1", child.BaggageItem("user"))
+		assert.Empty(t, root.BaggageItem("user"))
+	})
+
+	t.Run("trace_id=128bit", func(t *testing.T) {
+		spans, traceIDs = nil, nil
+		tracer := newTracer(rec, &Options{traceID128: true})
+		tracer.StartSpan("root").Finish()
+		assert.Equal(t, []string{"00000000000000050000000000000006"}, traceIDs)
+	})
+
+	t.Run("sampled=false", func(t *testing.T) {
+		spans, traceIDs = nil, nil
+		tracer := newTracer(rec, &Options{sampler: func(uint64) bool { return false }})
+		root := tracer.StartSpan("root")
+		tracer.StartSpan("child", opentracing.ChildOf(root.Context())).Finish()
+		root.Finish()
+		tracer.StartSpan("forced", opentracing.Tag{Key: string(ext.SamplingPriority), Value: uint16(1)}).Finish()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "forced", spans[0].Name)
+		}
+	})
+}
+
+func TestTracerMultiValueLabels(t *testing.T) {
+	var spans []*cloudtrace.TraceSpan
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, tr := range req.Traces {
+			spans = append(spans, tr.Spans...)
+		}
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithMultiValueLabels("|", "retry.status", "attempt.status"))
+	defer srv.Close()
+	tracer := newTracer(rec, &Options{})
+
+	t.Run("source=tags", func(t *testing.T) {
+		spans = nil
+		sp := tracer.StartSpan("tags")
+		sp.SetTag("retry.status", 503)
+		sp.SetTag("retry.status", 200)
+		sp.SetTag("component", "a")
+		sp.SetTag("component", "b")
+		sp.Finish()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "503|200", spans[0].Labels["retry.status"])
+			assert.Equal(t, "b", spans[0].Labels["component"])
+		}
+	})
+
+	t.Run("source=logs", func(t *testing.T) {
+		spans = nil
+		sp := tracer.StartSpan("logs")
+		sp.LogKV("attempt.status", 503)
+		sp.LogKV("attempt.status", 503)
+		sp.LogKV("attempt.status", 200)
+		sp.SetTag("attempt.status", 200)
+		sp.Finish()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "503|503|200", spans[0].Labels["attempt.status"])
+		}
+	})
+}
+
+func TestSamplingRules(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		for _, tr := range req.Traces {
+			for _, s := range tr.Spans {
+				names = append(names, s.Name)
+			}
+		}
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithSamplingRate(0), WithIDGenerator(&sequentialIDs{}),
+		WithSamplingRules(SamplingRule{Tag: "debug", Value: "true"}, SamplingRule{Tag: "tenant.canary"}))
+	defer srv.Close()
+
+	t.Run("tracer=raw_spans", func(t *testing.T) {
+		names = nil
+		tagged := testSpan(7, 2)
+		tagged.Operation = "debugged"
+		tagged.Tags = opentracing.Tags{"debug": true}
+		rec.RecordSpan(tagged)
+		root := testSpan(7, 1)
+		root.Operation = "root"
+		rec.RecordSpan(root)
+		other := testSpan(8, 1)
+		other.Tags = opentracing.Tags{"debug": false}
+		rec.RecordSpan(other)
+		assert.Equal(t, []string{"debugged", "root"}, names)
+	})
+
+	t.Run("tracer=native", func(t *testing.T) {
+		names = nil
+		tracer := newTracer(rec, &Options{sampler: func(uint64) bool { return false }})
+		root := tracer.StartSpan("root")
+		root.SetTag("tenant.canary", "acme")
+		tracer.StartSpan("child", opentracing.ChildOf(root.Context())).Finish()
+		root.Finish()
+		tracer.StartSpan("dropped").Finish()
+		assert.Equal(t, []string{"child", "root"}, names)
+	})
+}
+
+func TestTracerPropagation(t *testing.T) {
+	tracer := &Tracer{}
+	sc := SpanContext{TraceIDHigh: 1, TraceID: 2, SpanID: 3, Sampled: true, Baggage: map[string]string{"user": "1"}}
+
+	t.Run("format=text_map", func(t *testing.T) {
+		carrier := opentracing.TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(sc, opentracing.TextMap, carrier))
+		assert.Equal(t, "00000000000000010000000000000002", carrier[fieldTraceID])
+		assert.NotContains(t, carrier, CloudTraceContextHeader)
+
+		extracted, err := tracer.Extract(opentracing.TextMap, carrier)
+		assert.NoError(t, err)
+		assert.Equal(t, sc, extracted)
+		assert.Equal(t, "00000000000000010000000000000002", extracted.(SpanContext).TraceIDString())
+	})
+
+	t.Run("format=http_headers", func(t *testing.T) {
+		carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+		assert.NoError(t, tracer.Inject(SpanContext{TraceID: 2, SpanID: 3}, opentracing.HTTPHeaders, carrier))
+		assert.Equal(t, "2", http.Header(carrier).Get(fieldTraceID))
+		assert.Equal(t, "00000000000000020000000000000002/3;o=0", http.Header(carrier).Get(CloudTraceContextHeader))
+	})
+
+	t.Run("header=cloud_trace_context", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(CloudTraceContextHeader, "105445aa7843bc8bf206b12000100000/123;o=1")
+		extracted, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+		assert.NoError(t, err)
+		assert.Equal(t, SpanContext{TraceIDHigh: 0x105445aa7843bc8b, TraceID: 0xf206b12000100000, SpanID: 123, Sampled: true}, extracted)
+	})
+
+	t.Run("format=binary", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, tracer.Inject(sc, opentracing.Binary, &buf))
+		extracted, err := tracer.Extract(opentracing.Binary, &buf)
+		assert.NoError(t, err)
+		assert.Equal(t, sc, extracted)
+
+		// TracerState{trace_id: 2, span_id: 3} written by basictracer.
+		basic := []byte{0, 0, 0, 18, 0x09, 2, 0, 0, 0, 0, 0, 0, 0, 0x11, 3, 0, 0, 0, 0, 0, 0, 0}
+		extracted, err = tracer.Extract(opentracing.Binary, bytes.NewReader(basic))
+		assert.NoError(t, err)
+		assert.Equal(t, SpanContext{TraceID: 2, SpanID: 3}, extracted)
+
+		buf.Reset()
+		assert.NoError(t, tracer.Inject(SpanContext{TraceID: 2, SpanID: 3}, opentracing.Binary, &buf))
+		assert.Equal(t, basic, buf.Bytes())
+
+		_, err = tracer.Extract(opentracing.Binary, bytes.NewReader(nil))
+		assert.Equal(t, opentracing.ErrSpanContextNotFound, err)
+		_, err = tracer.Extract(opentracing.Binary, bytes.NewReader(basic[:10]))
+		assert.Equal(t, opentracing.ErrSpanContextCorrupted, err)
+		assert.Equal(t, opentracing.ErrInvalidCarrier, tracer.Inject(sc, opentracing.Binary, opentracing.TextMapCarrier{}))
+	})
+
+	t.Run("carrier=empty", func(t *testing.T) {
+		_, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier{})
+		assert.Equal(t, opentracing.ErrSpanContextNotFound, err)
+	})
+
+	t.Run("carrier=corrupted", func(t *testing.T) {
+		_, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier{fieldTraceID: "x", fieldSpanID: "1", fieldSampled: "true"})
+		assert.Equal(t, opentracing.ErrSpanContextCorrupted, err)
+	})
+}
+
+func TestTracerDebugHeader(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		for _, tr := range req.Traces {
+			for _, s := range tr.Spans {
+				names = append(names, s.Name)
+			}
+		}
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithSamplingRate(0), WithDebugHeader("X-Trace-Debug"))
+	defer srv.Close()
+	tracer := newTracer(rec, &Options{sampler: func(uint64) bool { return false }, debugHeader: "X-Trace-Debug"})
+
+	t.Run("header=debug_only", func(t *testing.T) {
+		names = nil
+		h := http.Header{}
+		h.Set("X-Trace-Debug", "1")
+		sc, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+		assert.NoError(t, err)
+		root := tracer.StartSpan("root", opentracing.ChildOf(sc))
+		child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+
+		out := http.Header{}
+		assert.NoError(t, tracer.Inject(child.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out)))
+		assert.Equal(t, "1", out.Get("X-Trace-Debug"))
+		assert.Equal(t, "true", out.Get(fieldSampled))
+		child.Finish()
+		root.Finish()
+		assert.Equal(t, []string{"child", "root"}, names)
+	})
+
+	t.Run("header=with_context", func(t *testing.T) {
+		names = nil
+		h := http.Header{}
+		h.Set(fieldTraceID, "7")
+		h.Set(fieldSpanID, "1")
+		h.Set(fieldSampled, "false")
+		h.Set("X-Trace-Debug", "true")
+		sc, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+		assert.NoError(t, err)
+		assert.Equal(t, SpanContext{TraceID: 7, SpanID: 1, Debug: true}, sc)
+		tracer.StartSpan("server", opentracing.ChildOf(sc)).Finish()
+		assert.Equal(t, []string{"server"}, names)
+	})
+
+	t.Run("header=missing", func(t *testing.T) {
+		names = nil
+		h := http.Header{}
+		h.Set("X-Trace-Debug", "0")
+		_, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+		assert.Equal(t, opentracing.ErrSpanContextNotFound, err)
+		tracer.StartSpan("server").Finish()
+		assert.Empty(t, names)
+	})
+}
+
+func TestStartJobSpan(t *testing.T) {
+	var spans []*cloudtrace.TraceSpan
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtrace.Traces
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, tr := range req.Traces {
+			spans = append(spans, tr.Spans...)
+		}
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload())
+	defer srv.Close()
+	tracer := newTracer(rec, &Options{})
+	defer opentracing.SetGlobalTracer(opentracing.GlobalTracer())
+	opentracing.SetGlobalTracer(tracer)
+
+	t.Run("parent=enqueuer", func(t *testing.T) {
+		spans = nil
+		enqueue := tracer.StartSpan("enqueue")
+		carrier := opentracing.TextMapCarrier{}
+		assert.NoError(t, InjectJob(tracer, enqueue.Context(), carrier))
+		enqueue.Finish()
+
+		worker := tracer.StartSpan("worker")
+		ctx := opentracing.ContextWithSpan(context.Background(), worker)
+		sp, ctx := StartJobSpan(ctx, "send_email", append(ExtractJob(tracer, carrier), JobQueue("emails"), JobAttempt(2))...)
+		assert.Equal(t, sp, opentracing.SpanFromContext(ctx))
+		sp.Finish()
+		worker.Finish()
+
+		if assert.Len(t, spans, 3) {
+			assert.Equal(t, "send_email", spans[1].Name)
+			assert.Equal(t, spans[0].SpanId, spans[1].ParentSpanId)
+			assert.Equal(t, "RPC_SERVER", spans[1].Kind)
+			assert.Equal(t, "emails", spans[1].Labels[JobQueueTag])
+			assert.Equal(t, "2", spans[1].Labels[JobAttemptTag])
+			assert.Contains(t, spans[1].Labels, JobQueueLatencyTag)
+		}
+	})
+
+	t.Run("parent=context", func(t *testing.T) {
+		spans = nil
+		worker := tracer.StartSpan("worker")
+		ctx := opentracing.ContextWithSpan(context.Background(), worker)
+		sp, _ := StartJobSpan(ctx, "cleanup", JobEnqueuedAt(time.Now().Add(time.Hour)))
+		sp.Finish()
+		worker.Finish()
+
+		if assert.Len(t, spans, 2) {
+			assert.Equal(t, spans[1].SpanId, spans[0].ParentSpanId)
+			assert.Equal(t, "0s", spans[0].Labels[JobQueueLatencyTag])
+		}
+	})
+
+	t.Run("carrier=empty", func(t *testing.T) {
+		assert.Empty(t, ExtractJob(tracer, opentracing.TextMapCarrier{}))
+		assert.Empty(t, ExtractJob(tracer, opentracing.TextMapCarrier{JobEnqueuedAtField: "yesterday"}))
+	})
+}
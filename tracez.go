@@ -0,0 +1,202 @@
+package gcloudtracer
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// LatencyBuckets are the upper bounds of latency buckets of Tracez,
+// spans slower than the last bound are counted in the last bucket.
+var LatencyBuckets = []time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	100 * time.Second,
+}
+
+// maxTracezOperations bounds the number of operations summarized separately,
+// spans of other operations are summarized as OtherOperation.
+const maxTracezOperations = 1000
+
+// maxExemplars is a number of the last spans kept per latency bucket.
+const maxExemplars = 5
+
+// Exemplar is a span summarized by Tracez.
+type Exemplar struct {
+	TraceID  string        `json:"traceId"`
+	SpanID   uint64        `json:"spanId"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+// SpanBucket counts spans, keeping the last ones as exemplars.
+type SpanBucket struct {
+	Count     uint64     `json:"count"`
+	Exemplars []Exemplar `json:"exemplars,omitempty"`
+}
+
+func (b *SpanBucket) add(e Exemplar) {
+	b.Count++
+	if len(b.Exemplars) == maxExemplars {
+		copy(b.Exemplars, b.Exemplars[1:])
+		b.Exemplars = b.Exemplars[:maxExemplars-1]
+	}
+	b.Exemplars = append(b.Exemplars, e)
+}
+
+// OperationSummary summarizes spans of the operation.
+type OperationSummary struct {
+	Operation string `json:"operation"`
+	// Active is a number of spans started by the Tracer and not finished yet.
+	Active int64 `json:"active"`
+	// Latency holds finished spans by latency, see LatencyBuckets.
+	Latency []SpanBucket `json:"latency"`
+	// Errors holds finished spans with the error tag.
+	Errors SpanBucket `json:"errors"`
+}
+
+// Tracez summarizes spans by operation in memory like the tracez page of
+// OpenCensus zPages, see WithTracez. It's an http.Handler rendering the
+// summary, to inspect tracing of the instance without Cloud Trace.
+type Tracez struct {
+	mu  sync.Mutex
+	ops map[string]*OperationSummary
+}
+
+// NewTracez creates new Tracez.
+func NewTracez() *Tracez {
+	return &Tracez{ops: make(map[string]*OperationSummary)}
+}
+
+// operation returns the summary of the operation. The caller holds the lock.
+func (tz *Tracez) operation(name string) *OperationSummary {
+	op := tz.ops[name]
+	if op == nil {
+		if len(tz.ops) >= maxTracezOperations {
+			name = OtherOperation
+			if op = tz.ops[name]; op != nil {
+				return op
+			}
+		}
+		op = &OperationSummary{Operation: name, Latency: make([]SpanBucket, len(LatencyBuckets)+1)}
+		tz.ops[name] = op
+	}
+	return op
+}
+
+// start counts an active span of the operation.
+func (tz *Tracez) start(operation string) {
+	tz.mu.Lock()
+	defer tz.mu.Unlock()
+	tz.operation(operation).Active++
+}
+
+// finish counts an active span of the operation as finished.
+func (tz *Tracez) finish(operation string) {
+	tz.mu.Lock()
+	defer tz.mu.Unlock()
+	tz.operation(operation).Active--
+}
+
+// record summarizes the finished span of the trace.
+func (tz *Tracez) record(sp RawSpan, traceID string) {
+	e := Exemplar{TraceID: traceID, SpanID: sp.Context.SpanID, Start: sp.Start, Duration: sp.Duration}
+	bucket := sort.Search(len(LatencyBuckets), func(i int) bool { return sp.Duration < LatencyBuckets[i] })
+
+	tz.mu.Lock()
+	defer tz.mu.Unlock()
+	op := tz.operation(sp.Operation)
+	op.Latency[bucket].add(e)
+	if isError(sp.Tags[string(ext.Error)], "") {
+		op.Errors.add(e)
+	}
+}
+
+// Summaries returns copies of the summaries by operation name.
+func (tz *Tracez) Summaries() []OperationSummary {
+	tz.mu.Lock()
+	summaries := make([]OperationSummary, 0, len(tz.ops))
+	for _, op := range tz.ops {
+		s := *op
+		s.Latency = make([]SpanBucket, len(op.Latency))
+		for i, b := range op.Latency {
+			s.Latency[i] = SpanBucket{Count: b.Count, Exemplars: append([]Exemplar(nil), b.Exemplars...)}
+		}
+		s.Errors.Exemplars = append([]Exemplar(nil), op.Errors.Exemplars...)
+		summaries = append(summaries, s)
+	}
+	tz.mu.Unlock()
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Operation < summaries[j].Operation })
+	return summaries
+}
+
+// ServeHTTP renders the summaries, or the exemplars of the operation
+// of the "operation" query parameter. The summaries are rendered as JSON
+// instead if the "format" query parameter is "json".
+func (tz *Tracez) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	summaries := tz.Summaries()
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, summaries)
+		return
+	}
+
+	operation := r.URL.Query().Get("operation")
+	if operation == "" {
+		renderTemplate(w, tracezTemplate, tracezPage{Buckets: bucketNames(), Summaries: summaries})
+		return
+	}
+	for _, s := range summaries {
+		if s.Operation == operation {
+			renderTemplate(w, exemplarsTemplate, tracezPage{Buckets: bucketNames(), Summaries: []OperationSummary{s}})
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+type tracezPage struct {
+	Buckets   []string
+	Summaries []OperationSummary
+}
+
+// bucketNames returns the names of the latency buckets, e.g. ">=1ms".
+func bucketNames() []string {
+	names := make([]string, 0, len(LatencyBuckets)+1)
+	names = append(names, "<"+LatencyBuckets[0].String())
+	for i := 1; i < len(LatencyBuckets); i++ {
+		names = append(names, "["+LatencyBuckets[i-1].String()+", "+LatencyBuckets[i].String()+")")
+	}
+	return append(names, ">="+LatencyBuckets[len(LatencyBuckets)-1].String())
+}
+
+var tracezTemplate = template.Must(template.New("tracez").Parse(`<!DOCTYPE html>
+<html><head><title>Tracez</title></head><body>
+<h1>Tracez</h1>
+<table>
+<tr><th>Operation</th><th>Active</th>{{range .Buckets}}<th>{{.}}</th>{{end}}<th>Errors</th></tr>
+{{range .Summaries}}<tr><td><a href="?operation={{.Operation}}">{{.Operation}}</a></td><td>{{.Active}}</td>{{range .Latency}}<td>{{.Count}}</td>{{end}}<td>{{.Errors.Count}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+var exemplarsTemplate = template.Must(template.New("exemplars").Parse(`<!DOCTYPE html>
+<html><head><title>Tracez</title></head><body>
+{{$buckets := .Buckets}}{{range .Summaries}}{{$op := .}}<h1>{{.Operation}}</h1>
+<p>{{.Active}} active spans. <a href="?">All operations</a></p>
+<table>
+<tr><th>Bucket</th><th>Count</th><th>Trace</th><th>Span</th><th>Start</th><th>Duration</th></tr>
+{{range $i, $b := .Latency}}{{range .Exemplars}}<tr><td>{{index $buckets $i}}</td><td>{{$b.Count}}</td><td>{{.TraceID}}</td><td>{{printf "%016x" .SpanID}}</td><td>{{.Start}}</td><td>{{.Duration}}</td></tr>
+{{end}}{{end}}{{range .Errors.Exemplars}}<tr><td>errors</td><td>{{$op.Errors.Count}}</td><td>{{.TraceID}}</td><td>{{printf "%016x" .SpanID}}</td><td>{{.Start}}</td><td>{{.Duration}}</td></tr>
+{{end}}</table>
+{{end}}</body></html>
+`))
@@ -0,0 +1,122 @@
+package gcloudtracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracez(t *testing.T) {
+	tz := NewTracez()
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, WithSynchronousUpload(), WithTracez(tz))
+	defer srv.Close()
+	tracer := newTracer(rec, &Options{tracez: tz})
+
+	fast := testSpan(1, 1)
+	fast.Operation = "query"
+	fast.Duration = 50 * time.Microsecond
+	rec.RecordSpan(fast)
+	slow := testSpan(2, 1)
+	slow.Operation = "query"
+	slow.Duration = 2 * time.Second
+	slow.Context.Sampled = false
+	slow.Tags = opentracing.Tags{"error": true}
+	rec.RecordSpan(slow)
+
+	active := tracer.StartSpan("handle")
+	finished := tracer.StartSpan("handle")
+	finished.SetOperationName("renamed")
+	finished.Finish()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		tz.ServeHTTP(w, httptest.NewRequest("GET", "/debug/tracez"+query, nil))
+		return w
+	}
+
+	t.Run("view=summaries", func(t *testing.T) {
+		summaries := tz.Summaries()
+		if assert.Len(t, summaries, 3) {
+			assert.Equal(t, "handle", summaries[0].Operation)
+			assert.Equal(t, int64(1), summaries[0].Active)
+
+			assert.Equal(t, "query", summaries[1].Operation)
+			assert.Equal(t, uint64(1), summaries[1].Latency[1].Count)
+			assert.Equal(t, uint64(1), summaries[1].Latency[6].Count)
+			assert.Equal(t, uint64(1), summaries[1].Errors.Count)
+			if assert.Len(t, summaries[1].Errors.Exemplars, 1) {
+				assert.Equal(t, "00000000000000020000000000000002", summaries[1].Errors.Exemplars[0].TraceID)
+			}
+
+			assert.Equal(t, "renamed", summaries[2].Operation)
+			assert.Equal(t, int64(0), summaries[2].Active)
+			assert.Equal(t, uint64(1), summaries[2].Latency[0].Count)
+		}
+	})
+
+	t.Run("view=json", func(t *testing.T) {
+		var summaries []OperationSummary
+		assert.NoError(t, json.NewDecoder(get("?format=json").Body).Decode(&summaries))
+		assert.Len(t, summaries, 3)
+	})
+
+	t.Run("view=list", func(t *testing.T) {
+		w := get("")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `href="?operation=query"`)
+	})
+
+	t.Run("view=exemplars", func(t *testing.T) {
+		body := get("?operation=query").Body.String()
+		assert.Contains(t, body, "00000000000000010000000000000001")
+		assert.Contains(t, body, "<td>errors</td><td>1</td>")
+	})
+
+	t.Run("view=missing", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("?operation=missing").Code)
+	})
+
+	active.Finish()
+	assert.Equal(t, int64(0), tz.Summaries()[0].Active)
+}
+
+func TestSpanBucketExemplars(t *testing.T) {
+	var b SpanBucket
+	for i := 1; i <= maxExemplars+2; i++ {
+		b.add(Exemplar{SpanID: uint64(i)})
+	}
+	assert.Equal(t, uint64(maxExemplars+2), b.Count)
+	if assert.Len(t, b.Exemplars, maxExemplars) {
+		assert.Equal(t, uint64(3), b.Exemplars[0].SpanID)
+		assert.Equal(t, uint64(maxExemplars+2), b.Exemplars[maxExemplars-1].SpanID)
+	}
+}
+
+func TestTracezErrors(t *testing.T) {
+	for _, tc := range []struct {
+		tag    interface{}
+		errors uint64
+	}{
+		{true, 1},
+		{"true", 1},
+		{false, 0},
+		{"false", 0},
+		{nil, 0},
+	} {
+		t.Run(fmt.Sprintf("error=%#v", tc.tag), func(t *testing.T) {
+			tz := NewTracez()
+			sp := testSpan(1, 1)
+			sp.Tags = opentracing.Tags{"error": tc.tag}
+			tz.record(sp, "1")
+			assert.Equal(t, tc.errors, tz.Summaries()[0].Errors.Count)
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package gcloudtracer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
+)
+
+// Limits of the v2 API, spans exceeding them are rejected.
+const (
+	maxAttributesV2    = 32
+	maxLinksV2         = 128
+	maxAnnotationsV2   = 32
+	maxMessageEventsV2 = 128
+)
+
+// Fields of a log record uploaded as a message event with the v2 API,
+// instead of an annotation. The message type is "SENT" or "RECEIVED",
+// the id and sizes are integers.
+const (
+	MessageTypeField             = "message.type"
+	MessageIDField               = "message.id"
+	MessageUncompressedSizeField = "message.uncompressed_size"
+	MessageCompressedSizeField   = "message.compressed_size"
+)
+
+// spansV2 maps spans of traces to the spans converted for the v2 API.
+type spansV2 map[*cloudtrace.TraceSpan]*cloudtracev2.Span
+
+func newSpansV2(trace *cloudtrace.Trace, span *cloudtracev2.Span) spansV2 {
+	if span == nil {
+		return nil
+	}
+	return spansV2{trace.Spans[0]: span}
+}
+
+// clientFactoryV2 returns a function creating the Cloud Trace v2 client.
+func clientFactoryV2(ctx context.Context, o *Options) func() (*cloudtracev2.Service, error) {
+	opts := clientOptions(o)
+	return func() (*cloudtracev2.Service, error) {
+		return cloudtracev2.NewService(ctx, opts...)
+	}
+}
+
+// clientV2 returns the Cloud Trace v2 client, creating it on first use.
+func (r *Recorder) clientV2() (*cloudtracev2.Service, error) {
+	r.clientMu.Lock()
+	defer r.clientMu.Unlock()
+
+	if r.traceClientV2 != nil {
+		return r.traceClientV2, nil
+	}
+	c, err := r.newClientV2()
+	if err != nil {
+		return nil, err
+	}
+	r.traceClientV2 = c
+	return c, nil
+}
+
+// batchWrite uploads the traces to the project with the v2 API.
+func (r *Recorder) batchWrite(project string, traces []*cloudtrace.Trace, spans spansV2) error {
+	c, err := r.clientV2()
+	if err != nil {
+		return err
+	}
+
+	req := &cloudtracev2.BatchWriteSpansRequest{
+		Spans: make([]*cloudtracev2.Span, 0, countSpans(traces)),
+	}
+	for _, t := range traces {
+		for _, s := range t.Spans {
+			sp := spans[s]
+			if sp == nil {
+				sp = convertTraceSpanV2(project, t.TraceId, s, nil)
+			}
+			req.Spans = append(req.Spans, sp)
+		}
+	}
+	_, err = c.Projects.Traces.BatchWrite("projects/"+project, req).Context(context.Background()).Do()
+
+	return err
+}
+
+// convertV2 converts the span of the trace for the v2 API, if enabled.
+// The raw span is set if the trace was converted from it.
+func (r *Recorder) convertV2(trace *cloudtrace.Trace, raw *RawSpan) *cloudtracev2.Span {
+	if !r.v2 {
+		return nil
+	}
+	sp := convertTraceSpanV2(trace.ProjectId, trace.TraceId, trace.Spans[0], raw)
+	r.scrubV2(sp)
+	return sp
+}
+
+// convertTraceSpanV2 converts the span of the trace for the v2 API.
+// Labels become string attributes, besides ReferencesTag becoming links.
+// Logs of the raw span the trace was converted from become time events
+// instead of labels, and the labels of its integer and boolean tags
+// typed attributes.
+func convertTraceSpanV2(project, traceID string, s *cloudtrace.TraceSpan, raw *RawSpan) *cloudtracev2.Span {
+	spanID := fmt.Sprintf("%016x", s.SpanId)
+	sp := &cloudtracev2.Span{
+		Name:        "projects/" + project + "/traces/" + traceID + "/spans/" + spanID,
+		SpanId:      spanID,
+		DisplayName: &cloudtracev2.TruncatableString{Value: s.Name},
+		StartTime:   s.StartTime,
+		EndTime:     s.EndTime,
+		SpanKind:    convertSpanKindV2(s.Kind),
+	}
+	if s.ParentSpanId != 0 {
+		sp.ParentSpanId = fmt.Sprintf("%016x", s.ParentSpanId)
+	}
+
+	var logs []opentracing.LogRecord
+	var start time.Time
+	if raw != nil {
+		logs, start = raw.Logs, raw.Start
+	}
+	attrs := make(map[string]cloudtracev2.AttributeValue, len(s.Labels))
+	for k, v := range s.Labels {
+		if k == ReferencesTag {
+			sp.Links = parseLinks(v, traceID, s.ParentSpanId)
+			continue
+		}
+		attrs[k] = stringValue(v)
+	}
+	for i := range logs {
+		delete(attrs, eventKey(i))
+	}
+	if raw != nil {
+		// Tags are typed only if their labels are left as converted,
+		// so labels dropped or changed since aren't uploaded.
+		for k, v := range raw.Tags {
+			if t, ok := labelMap[k]; ok {
+				k = t
+			}
+			label, ok := s.Labels[k]
+			if !ok {
+				continue
+			}
+			if av, ok := typedValue(v); ok && formatTyped(av) == label {
+				attrs[k] = av
+			}
+		}
+	}
+	sp.Attributes = newAttributes(attrs)
+	sp.TimeEvents = convertLogsV2(logs, start)
+	sp.Status = spanStatusV2(s.Labels, raw)
+
+	return sp
+}
+
+func convertSpanKindV2(kind string) string {
+	switch kind {
+	case "RPC_SERVER":
+		return "SERVER"
+	case "RPC_CLIENT":
+		return "CLIENT"
+	default:
+		return "SPAN_KIND_UNSPECIFIED"
+	}
+}
+
+// stringAttributes converts the labels into attributes, see newAttributes.
+func stringAttributes(labels map[string]string) *cloudtracev2.Attributes {
+	values := make(map[string]cloudtracev2.AttributeValue, len(labels))
+	for k, v := range labels {
+		values[k] = stringValue(v)
+	}
+	return newAttributes(values)
+}
+
+// newAttributes returns the attributes, keeping the first ones by key
+// above the limit.
+func newAttributes(values map[string]cloudtracev2.AttributeValue) *cloudtracev2.Attributes {
+	if len(values) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := &cloudtracev2.Attributes{AttributeMap: make(map[string]cloudtracev2.AttributeValue, len(keys))}
+	for i, k := range keys {
+		if i >= maxAttributesV2 {
+			attrs.DroppedAttributesCount = int64(len(keys) - maxAttributesV2)
+			break
+		}
+		attrs.AttributeMap[k] = values[k]
+	}
+	return attrs
+}
+
+func stringValue(v string) cloudtracev2.AttributeValue {
+	return cloudtracev2.AttributeValue{StringValue: &cloudtracev2.TruncatableString{Value: v}}
+}
+
+// addTypedLabels sets labels for the integer tags having none, e.g. int64,
+// so they're processed and scrubbed as other labels before being uploaded
+// as typed attributes with the v2 API.
+func addTypedLabels(trace *cloudtrace.Trace, tags opentracing.Tags) {
+	for k, v := range tags {
+		if _, ok := formatTag(v); ok {
+			continue
+		}
+		av, ok := typedValue(v)
+		if !ok {
+			continue
+		}
+		if t, ok := labelMap[k]; ok {
+			k = t
+		}
+		for _, s := range trace.Spans {
+			if _, ok := s.Labels[k]; ok {
+				continue
+			}
+			if s.Labels == nil {
+				s.Labels = make(map[string]string, 1)
+			}
+			s.Labels[k] = formatTyped(av)
+		}
+	}
+}
+
+// formatTyped formats the typed attribute value as a label.
+func formatTyped(av cloudtracev2.AttributeValue) string {
+	if len(av.ForceSendFields) > 0 && av.ForceSendFields[0] == "BoolValue" {
+		return strconv.FormatBool(av.BoolValue)
+	}
+	return strconv.FormatInt(av.IntValue, 10)
+}
+
+// typedValue returns the attribute value of an integer or a boolean.
+// False and zero values are sent explicitly, as they are omitted otherwise.
+func typedValue(v interface{}) (cloudtracev2.AttributeValue, bool) {
+	if b, ok := v.(bool); ok {
+		return cloudtracev2.AttributeValue{BoolValue: b, ForceSendFields: []string{"BoolValue"}}, true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cloudtracev2.AttributeValue{IntValue: rv.Int(), ForceSendFields: []string{"IntValue"}}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cloudtracev2.AttributeValue{IntValue: int64(rv.Uint()), ForceSendFields: []string{"IntValue"}}, true
+	}
+	return cloudtracev2.AttributeValue{}, false
+}
+
+// convertLogsV2 converts the logs of the span started at the start time into
+// annotations, described by the "event" or "message" field, or into message
+// events if MessageTypeField is set.
+func convertLogsV2(logs []opentracing.LogRecord, start time.Time) *cloudtracev2.TimeEvents {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	events := &cloudtracev2.TimeEvents{}
+	var annotations, messages int
+	for _, l := range logs {
+		fields := make(map[string]interface{}, len(l.Fields))
+		for _, f := range l.Fields {
+			fields[f.Key()] = f.Value()
+		}
+
+		te := &cloudtracev2.TimeEvent{Time: formatTimestamp(logTime(start, l.Timestamp))}
+		if typ, ok := fields[MessageTypeField].(string); ok {
+			if messages >= maxMessageEventsV2 {
+				events.DroppedMessageEventsCount++
+				continue
+			}
+			messages++
+			te.MessageEvent = &cloudtracev2.MessageEvent{
+				Type:                  typ,
+				Id:                    int64Field(fields[MessageIDField]),
+				UncompressedSizeBytes: int64Field(fields[MessageUncompressedSizeField]),
+				CompressedSizeBytes:   int64Field(fields[MessageCompressedSizeField]),
+			}
+		} else {
+			if annotations >= maxAnnotationsV2 {
+				events.DroppedAnnotationsCount++
+				continue
+			}
+			annotations++
+			description := "log"
+			for _, k := range []string{"event", "message"} {
+				if v, ok := fields[k].(string); ok {
+					description = v
+					delete(fields, k)
+					break
+				}
+			}
+			attrs := make(map[string]cloudtracev2.AttributeValue, len(fields))
+			for k, v := range fields {
+				if av, ok := typedValue(v); ok {
+					attrs[k] = av
+				} else {
+					attrs[k] = stringValue(fmt.Sprint(v))
+				}
+			}
+			te.Annotation = &cloudtracev2.Annotation{
+				Description: &cloudtracev2.TruncatableString{Value: description},
+				Attributes:  newAttributes(attrs),
+			}
+		}
+		events.TimeEvent = append(events.TimeEvent, te)
+	}
+	return events
+}
+
+// int64Field returns the value of an integer field, or zero.
+func int64Field(v interface{}) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	}
+	return 0
+}
+
+// parseLinks converts the value of ReferencesTag into links,
+// besides the reference of the parent span.
+func parseLinks(refs, traceID string, parentID uint64) *cloudtracev2.Links {
+	links := &cloudtracev2.Links{}
+	for _, ref := range strings.Split(refs, ",") {
+		typ, ids := splitPair(ref, ":")
+		refTraceID, refSpanID := splitPair(ids, "/")
+		spanID, err := strconv.ParseUint(refSpanID, 10, 64)
+		if err != nil || len(refTraceID) != 32 {
+			continue
+		}
+		if refTraceID == traceID && spanID == parentID {
+			continue
+		}
+		if len(links.Link) >= maxLinksV2 {
+			links.DroppedLinksCount++
+			continue
+		}
+
+		link := &cloudtracev2.Link{
+			TraceId: refTraceID,
+			SpanId:  fmt.Sprintf("%016x", spanID),
+			Type:    "TYPE_UNSPECIFIED",
+			Attributes: stringAttributes(map[string]string{
+				"reference.type": typ,
+			}),
+		}
+		if typ == "child_of" {
+			link.Type = "PARENT_LINKED_SPAN"
+		}
+		links.Link = append(links.Link, link)
+	}
+	if len(links.Link) == 0 && links.DroppedLinksCount == 0 {
+		return nil
+	}
+	return links
+}
+
+func splitPair(s, sep string) (string, string) {
+	parts := strings.SplitN(s, sep, 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,176 @@
+package gcloudtracer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/stretchr/testify/assert"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	cloudtracev2 "google.golang.org/api/cloudtrace/v2"
+)
+
+func TestRecorderV2(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var spans []*cloudtracev2.Span
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtracev2.BatchWriteSpansRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		spans = append(spans, req.Spans...)
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}, WithV2API(), WithBundlerShards(1))
+	defer srv.Close()
+
+	sp := testSpan(1, 3)
+	sp.ParentSpanID = 2
+	sp.Tags = opentracing.Tags{
+		"component":        "queue",
+		"retry":            false,
+		"attempt":          int64(2),
+		"http.status_code": 200,
+		ReferencesTag: "child_of:00000000000000010000000000000001/2," +
+			"follows_from:00000000000000050000000000000005/6",
+	}
+	sp.Logs = []opentracing.LogRecord{{Timestamp: sp.Start, Fields: []log.Field{log.String("event", "sent")}}}
+	rec.RecordSpan(sp)
+	assert.NoError(t, rec.RecordTraceSpan("00000000000000010000000000000001", &cloudtrace.TraceSpan{
+		SpanId:    2,
+		Name:      "imported",
+		StartTime: formatTimestamp(sp.Start.Add(-time.Millisecond)),
+	}))
+	assert.NoError(t, rec.Flush(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/v2/projects/test_project/traces:batchWrite"}, paths)
+	// the parent starts first
+	if assert.Len(t, spans, 2) {
+		s := spans[1]
+		assert.Equal(t, "projects/test_project/traces/00000000000000010000000000000001/spans/0000000000000003", s.Name)
+		assert.Equal(t, "0000000000000003", s.SpanId)
+		assert.Equal(t, "0000000000000002", s.ParentSpanId)
+		assert.Equal(t, "test", s.DisplayName.Value)
+		assert.Equal(t, "queue", s.Attributes.AttributeMap["component"].StringValue.Value)
+		assert.NotContains(t, s.Attributes.AttributeMap, ReferencesTag)
+		if assert.Contains(t, s.Attributes.AttributeMap, "retry") {
+			assert.Nil(t, s.Attributes.AttributeMap["retry"].StringValue)
+		}
+		assert.Equal(t, int64(2), s.Attributes.AttributeMap["attempt"].IntValue)
+		assert.Equal(t, int64(200), s.Attributes.AttributeMap["trace.cloud.google.com/http/status_code"].IntValue)
+		assert.NotContains(t, s.Attributes.AttributeMap, "event_0")
+		if assert.NotNil(t, s.TimeEvents) && assert.Len(t, s.TimeEvents.TimeEvent, 1) {
+			assert.Equal(t, "sent", s.TimeEvents.TimeEvent[0].Annotation.Description.Value)
+		}
+		if assert.NotNil(t, s.Links) && assert.Len(t, s.Links.Link, 1) {
+			assert.Equal(t, "00000000000000050000000000000005", s.Links.Link[0].TraceId)
+			assert.Equal(t, "0000000000000006", s.Links.Link[0].SpanId)
+			assert.Equal(t, "TYPE_UNSPECIFIED", s.Links.Link[0].Type)
+		}
+
+		assert.Equal(t, "imported", spans[0].DisplayName.Value)
+		assert.Empty(t, spans[0].ParentSpanId)
+	}
+}
+
+func TestRecorderV2Processors(t *testing.T) {
+	var mu sync.Mutex
+	var spans []*cloudtracev2.Span
+	rec, srv := newTestRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		var req cloudtracev2.BatchWriteSpansRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		spans = append(spans, req.Spans...)
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}, WithV2API(), WithProcessors(DropLabels("user.id", "account.id"), RedactLabels("retry")))
+	defer srv.Close()
+
+	sp := testSpan(1, 1)
+	sp.Tags = opentracing.Tags{"user.id": 42, "account.id": int64(7), "retry": true, "attempt": int64(2)}
+	rec.RecordSpan(sp)
+	assert.NoError(t, rec.Flush(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, spans, 1) {
+		attrs := spans[0].Attributes.AttributeMap
+		assert.NotContains(t, attrs, "user.id")
+		assert.NotContains(t, attrs, "account.id")
+		assert.Equal(t, redacted, attrs["retry"].StringValue.Value)
+		assert.Equal(t, int64(2), attrs["attempt"].IntValue)
+	}
+}
+
+func TestStringAttributes(t *testing.T) {
+	labels := make(map[string]string)
+	for i := 0; i < maxAttributesV2+2; i++ {
+		labels[eventKey(i)] = "v"
+	}
+	attrs := stringAttributes(labels)
+	assert.Len(t, attrs.AttributeMap, maxAttributesV2)
+	assert.Equal(t, int64(2), attrs.DroppedAttributesCount)
+	assert.Nil(t, stringAttributes(nil))
+}
+
+func TestConvertLogsV2(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := convertLogsV2([]opentracing.LogRecord{
+		{Timestamp: now, Fields: []log.Field{log.String("event", "cache miss"), log.Int("shard", 3)}},
+		{Timestamp: now, Fields: []log.Field{
+			log.String(MessageTypeField, "SENT"),
+			log.Int(MessageIDField, 1),
+			log.Int(MessageUncompressedSizeField, 512),
+		}},
+	}, now)
+
+	if assert.Len(t, events.TimeEvent, 2) {
+		a := events.TimeEvent[0]
+		assert.Equal(t, "2018-01-02T03:04:05Z", a.Time)
+		assert.Equal(t, "cache miss", a.Annotation.Description.Value)
+		assert.Equal(t, int64(3), a.Annotation.Attributes.AttributeMap["shard"].IntValue)
+
+		m := events.TimeEvent[1].MessageEvent
+		assert.Equal(t, "SENT", m.Type)
+		assert.Equal(t, int64(1), m.Id)
+		assert.Equal(t, int64(512), m.UncompressedSizeBytes)
+	}
+	assert.Nil(t, convertLogsV2(nil, time.Time{}))
+}
+
+func TestSpanStatusV2(t *testing.T) {
+	for name, tc := range map[string]struct {
+		labels map[string]string
+		tags   opentracing.Tags
+		code   int64
+		ok     bool
+	}{
+		"http=200":           {labels: map[string]string{"trace.cloud.google.com/http/status_code": "200"}, ok: true},
+		"http=404":           {labels: map[string]string{"trace.cloud.google.com/http/status_code": "404"}, code: codeNotFound},
+		"http=500":           {labels: map[string]string{"trace.cloud.google.com/http/status_code": "500"}, code: codeUnknown},
+		"grpc=name":          {labels: map[string]string{GRPCStatusCodeTag: "unavailable"}, code: codeUnavailable},
+		"grpc=number":        {tags: opentracing.Tags{GRPCStatusCodeTag: uint32(7)}, code: codePermissionDenied},
+		"grpc=ok":            {labels: map[string]string{GRPCStatusCodeTag: "0"}, ok: true},
+		"error=true":         {tags: opentracing.Tags{"error": true}, code: codeUnknown},
+		"status=unspecified": {ok: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := testSpan(1, 1)
+			raw.Tags = tc.tags
+			status := spanStatusV2(tc.labels, &raw)
+			if tc.ok {
+				assert.Nil(t, status)
+			} else if assert.NotNil(t, status) {
+				assert.Equal(t, tc.code, status.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package gcloudtracer
+
+import (
+	"fmt"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+// validateTraces checks consistency of the spans of each trace and returns
+// a warning for every span with an unknown parent, ending before it starts,
+// or with an identifier used by another span of the trace. Duplicates are
+// the spans coalesce dropped, as their identifiers were used before.
+func validateTraces(traces, duplicates []*cloudtrace.Trace) []string {
+	var warnings []string
+	type spanKey struct {
+		traceID string
+		spanID  uint64
+	}
+	reported := make(map[spanKey]bool)
+	duplicate := func(traceID string, spanID uint64) {
+		if k := (spanKey{traceID: traceID, spanID: spanID}); !reported[k] {
+			reported[k] = true
+			warnings = append(warnings, fmt.Sprintf("trace %s: span %016x recorded more than once, span identifiers must be unique within a trace", traceID, spanID))
+		}
+	}
+	for _, t := range duplicates {
+		for _, s := range t.Spans {
+			duplicate(t.TraceId, s.SpanId)
+		}
+	}
+	for _, t := range traces {
+		ids := make(map[uint64]bool, len(t.Spans))
+		for _, s := range t.Spans {
+			if ids[s.SpanId] {
+				duplicate(t.TraceId, s.SpanId)
+			}
+			ids[s.SpanId] = true
+		}
+		for _, s := range t.Spans {
+			if _, ok := ids[s.ParentSpanId]; s.ParentSpanId != 0 && !ok {
+				warnings = append(warnings, fmt.Sprintf("trace %s: parent %016x of span %016x (%s) was not recorded, check that the parent span is finished and the context is propagated", t.TraceId, s.ParentSpanId, s.SpanId, s.Name))
+			}
+			if end := parseTimestamp(s.EndTime); end.Before(parseTimestamp(s.StartTime)) {
+				warnings = append(warnings, fmt.Sprintf("trace %s: span %016x (%s) ends at %s before it starts at %s, check the finish time and the clock", t.TraceId, s.SpanId, s.Name, s.EndTime, s.StartTime))
+			}
+		}
+	}
+	return warnings
+}
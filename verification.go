@@ -0,0 +1,110 @@
+package gcloudtracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// VerificationFunc is called with the uploaded trace which couldn't be read
+// back from the project, see WithExportVerification.
+type VerificationFunc func(project, traceID string, err error)
+
+// exportVerifier periodically reads back a recently uploaded trace.
+type exportVerifier struct {
+	interval  time.Duration
+	onFailure VerificationFunc
+
+	mu       sync.Mutex
+	project  string
+	traceID  string
+	uploaded time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// sample remembers the uploaded trace for verification, unless a trace
+// is waiting for it already.
+func (v *exportVerifier) sample(project, traceID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.traceID == "" {
+		v.project, v.traceID, v.uploaded = project, traceID, time.Now()
+	}
+}
+
+// due returns the sampled trace uploaded at least the interval ago,
+// so it had time to become visible.
+func (v *exportVerifier) due() (project, traceID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.traceID == "" || time.Since(v.uploaded) < v.interval {
+		return "", ""
+	}
+	project, traceID = v.project, v.traceID
+	v.traceID = ""
+	return project, traceID
+}
+
+// runVerifier verifies sampled traces every interval until the Recorder
+// is shut down.
+func (r *Recorder) runVerifier() {
+	v := r.verifier
+	defer close(v.done)
+	t := time.NewTicker(v.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-v.stop:
+			return
+		}
+		project, traceID := v.due()
+		if traceID == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), v.interval)
+		err := r.verifyTrace(ctx, project, traceID)
+		cancel()
+		if err != nil {
+			v.onFailure(project, traceID, err)
+		}
+	}
+}
+
+// verifyTrace reads the trace back from the project.
+func (r *Recorder) verifyTrace(ctx context.Context, project, traceID string) error {
+	c, err := r.client()
+	if err != nil {
+		return err
+	}
+	reader := &Reader{project: project, client: c}
+	_, err = reader.Get(ctx, traceID)
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return fmt.Errorf("%w: trace %s not found in project %s", ErrTraceNotVisible, traceID, project)
+	}
+	return err
+}
+
+// stopVerifier stops verification of uploaded traces, waiting for
+// the read-back in progress until the context is done.
+func (r *Recorder) stopVerifier(ctx context.Context) error {
+	if r.verifier == nil {
+		return nil
+	}
+	close(r.verifier.stop)
+	select {
+	case <-r.verifier.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
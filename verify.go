@@ -0,0 +1,40 @@
+package gcloudtracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// Verify checks credentials and permissions with an empty upload to the
+// project, so misconfiguration is reported when the Recorder starts rather
+// than when spans are uploaded in background.
+func (r *Recorder) Verify(ctx context.Context) error {
+	c, err := r.client()
+	if err != nil {
+		return err
+	}
+	_, err = c.Projects.PatchTraces(r.project, &cloudtrace.Traces{}).Context(ctx).Do()
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("failed to reach Cloud Trace: %w", err)
+	}
+	switch apiErr.Code {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: %s", ErrInvalidCredentials, apiErr.Message)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: permission trace.append missing on project %s", ErrPermissionDenied, r.project)
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: project %s not found", ErrInvalidProjectID, r.project)
+	default:
+		return fmt.Errorf("failed to verify Cloud Trace project %s: %w", r.project, err)
+	}
+}
@@ -0,0 +1,109 @@
+// Package zipkin provides a zipkin-go Reporter which feeds Zipkin spans
+// into the gcloudtracer Recorder, so services instrumented with zipkin-go
+// can swap their Zipkin backend for Cloud Trace.
+package zipkin
+
+import (
+	"context"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+)
+
+var _ reporter.Reporter = &Reporter{}
+
+// Reporter implements reporter.Reporter interface
+// used to write Zipkin spans through a span recorder.
+type Reporter struct {
+	recorder gcloudtracer.SpanRecorder
+}
+
+// NewReporter creates new Zipkin reporter backed by the recorder,
+// usually a *gcloudtracer.Recorder.
+func NewReporter(recorder gcloudtracer.SpanRecorder) *Reporter {
+	return &Reporter{recorder: recorder}
+}
+
+// Send converts Zipkin span and passes it to the recorder.
+func (r *Reporter) Send(span model.SpanModel) {
+	r.recorder.RecordSpan(ConvertSpan(span))
+}
+
+// Close implements reporter.Reporter interface.
+// It uploads spans buffered by the recorder, if it supports flushing.
+func (r *Reporter) Close() error {
+	if f, ok := r.recorder.(flusher); ok {
+		return f.Flush(context.Background())
+	}
+	return nil
+}
+
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// ConvertSpan converts Zipkin span into gcloudtracer.RawSpan.
+// The high bits of the trace identifier are zero unless the
+// tracer is configured with zipkin.WithTraceID128Bit.
+// Spans without a sampling decision are sampled.
+func ConvertSpan(span model.SpanModel) gcloudtracer.RawSpan {
+	tags := make(opentracing.Tags, len(span.Tags)+4)
+	for k, v := range span.Tags {
+		tags[k] = v
+	}
+	switch span.Kind {
+	case model.Server, model.Consumer:
+		tags[string(ext.SpanKind)] = ext.SpanKindRPCServerEnum
+	case model.Client, model.Producer:
+		tags[string(ext.SpanKind)] = ext.SpanKindRPCClientEnum
+	}
+	if span.Err != nil {
+		tags[string(ext.Error)] = "true"
+	}
+	if e := span.RemoteEndpoint; e != nil {
+		if e.ServiceName != "" {
+			tags[string(ext.PeerService)] = e.ServiceName
+		}
+		if e.IPv4 != nil {
+			tags[string(ext.PeerHostIPv4)] = e.IPv4.String()
+		} else if e.IPv6 != nil {
+			tags[string(ext.PeerHostIPv6)] = e.IPv6.String()
+		}
+		if e.Port != 0 {
+			tags[string(ext.PeerPort)] = e.Port
+		}
+	}
+
+	logs := make([]opentracing.LogRecord, 0, len(span.Annotations))
+	for _, a := range span.Annotations {
+		logs = append(logs, opentracing.LogRecord{
+			Timestamp: a.Timestamp,
+			Fields:    []otlog.Field{otlog.String("event", a.Value)},
+		})
+	}
+
+	var parentID uint64
+	if span.ParentID != nil {
+		parentID = uint64(*span.ParentID)
+	}
+	sampled := span.Sampled == nil || *span.Sampled || span.Debug
+
+	return gcloudtracer.RawSpan{
+		Context: gcloudtracer.SpanContext{
+			TraceIDHigh: span.TraceID.High,
+			TraceID:     span.TraceID.Low,
+			SpanID:      uint64(span.ID),
+			Sampled:     sampled,
+		},
+		ParentSpanID: parentID,
+		Operation:    span.Name,
+		Start:        span.Timestamp,
+		Duration:     span.Duration,
+		Tags:         tags,
+		Logs:         logs,
+	}
+}
@@ -0,0 +1,83 @@
+package zipkin
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	gcloudtracer "github.com/hellofresh/gcloud-opentracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	spans []gcloudtracer.RawSpan
+}
+
+func (r *recorder) RecordSpan(sp gcloudtracer.RawSpan) {
+	r.spans = append(r.spans, sp)
+}
+
+func TestConvertSpan(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	parentID := model.ID(1)
+	span := model.SpanModel{
+		SpanContext: model.SpanContext{
+			TraceID:  model.TraceID{High: 0x105445aa7843bc8b, Low: 0xf206b12000100000},
+			ID:       2,
+			ParentID: &parentID,
+		},
+		Name:           "get",
+		Kind:           model.Client,
+		Timestamp:      start,
+		Duration:       time.Second,
+		RemoteEndpoint: &model.Endpoint{ServiceName: "users", IPv4: net.IPv4(10, 0, 0, 1), Port: 8080},
+		Annotations:    []model.Annotation{{Timestamp: start, Value: "sent"}},
+		Tags:           map[string]string{"http.path": "/"},
+	}
+
+	sp := ConvertSpan(span)
+
+	t.Run("trace_id=128bit", func(t *testing.T) {
+		assert.Equal(t, gcloudtracer.SpanContext{TraceIDHigh: 0x105445aa7843bc8b, TraceID: 0xf206b12000100000, SpanID: 2, Sampled: true}, sp.Context)
+		assert.Equal(t, span.TraceID.String(), sp.Context.TraceIDString())
+		assert.Equal(t, uint64(1), sp.ParentSpanID)
+	})
+
+	t.Run("trace_id=64bit", func(t *testing.T) {
+		s := span
+		s.TraceID = model.TraceID{Low: 7}
+		assert.Equal(t, gcloudtracer.SpanContext{TraceID: 7, SpanID: 2, Sampled: true}, ConvertSpan(s).Context)
+	})
+
+	t.Run("span=fields", func(t *testing.T) {
+		assert.Equal(t, "get", sp.Operation)
+		assert.Equal(t, start, sp.Start)
+		assert.Equal(t, time.Second, sp.Duration)
+		assert.Equal(t, opentracing.Tags{
+			"http.path":              "/",
+			string(ext.SpanKind):     ext.SpanKindRPCClientEnum,
+			string(ext.PeerService):  "users",
+			string(ext.PeerHostIPv4): "10.0.0.1",
+			string(ext.PeerPort):     uint16(8080),
+		}, sp.Tags)
+		assert.Len(t, sp.Logs, 1)
+	})
+
+	t.Run("sampled=false", func(t *testing.T) {
+		s := span
+		sampled := false
+		s.Sampled = &sampled
+		assert.False(t, ConvertSpan(s).Context.Sampled)
+	})
+
+	t.Run("reporter=recorder", func(t *testing.T) {
+		rec := &recorder{}
+		r := NewReporter(rec)
+		r.Send(span)
+		assert.NoError(t, r.Close())
+		assert.Equal(t, []gcloudtracer.RawSpan{sp}, rec.spans)
+	})
+}